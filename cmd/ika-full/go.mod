@@ -6,8 +6,14 @@ require (
 	github.com/alx99/ika v0.0.40
 	github.com/alx99/ika/plugins/accesslog v0.0.1
 	github.com/alx99/ika/plugins/basicauth v0.0.3
+	github.com/alx99/ika/plugins/bodylimit v0.0.1
+	github.com/alx99/ika/plugins/external v0.0.1
+	github.com/alx99/ika/plugins/mirror v0.0.1
 	github.com/alx99/ika/plugins/reqmodifier v0.0.1
 	github.com/alx99/ika/plugins/requestid v0.1.0
+	github.com/alx99/ika/plugins/script v0.0.1
+	github.com/alx99/ika/plugins/trafficsplit v0.0.1
+	github.com/alx99/ika/plugins/wasm v0.0.1
 )
 
 require (
@@ -4,9 +4,15 @@ import (
 	"github.com/alx99/ika/gateway"
 	"github.com/alx99/ika/plugins/accesslog"
 	"github.com/alx99/ika/plugins/basicauth"
+	"github.com/alx99/ika/plugins/bodylimit"
+	"github.com/alx99/ika/plugins/external"
 	"github.com/alx99/ika/plugins/fail2ban"
+	"github.com/alx99/ika/plugins/mirror"
 	"github.com/alx99/ika/plugins/reqmodifier"
 	"github.com/alx99/ika/plugins/requestid"
+	"github.com/alx99/ika/plugins/script"
+	"github.com/alx99/ika/plugins/trafficsplit"
+	"github.com/alx99/ika/plugins/wasm"
 )
 
 func main() {
@@ -16,5 +22,11 @@ func main() {
 		gateway.WithPlugin(accesslog.Factory()),
 		gateway.WithPlugin(reqmodifier.Factory()),
 		gateway.WithPlugin(fail2ban.Factory()),
+		gateway.WithPlugin(trafficsplit.Factory()),
+		gateway.WithPlugin(mirror.Factory()),
+		gateway.WithPlugin(bodylimit.Factory()),
+		gateway.WithPlugin(wasm.Factory()),
+		gateway.WithPlugin(external.Factory()),
+		gateway.WithPlugin(script.Factory()),
 	)
 }
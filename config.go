@@ -0,0 +1,32 @@
+package ika
+
+import (
+	"context"
+	"errors"
+	"net/url"
+)
+
+// ErrConfigUnchanged is returned by ConfigSource.Load when the configuration
+// has not changed since it was last loaded.
+var ErrConfigUnchanged = errors.New("configuration unchanged")
+
+// ConfigSource provides the configuration of Ika.
+// Ika loads the configuration from the source at startup and
+// then polls it periodically, applying every new configuration without a restart.
+type ConfigSource interface {
+	// Load returns the YAML or JSON encoded configuration.
+	// It returns ErrConfigUnchanged if the configuration has not changed since the previous successful call,
+	// or since the last call to Commit if the source implements ConfigCommitter.
+	Load(ctx context.Context) ([]byte, error)
+}
+
+// ConfigCommitter is implemented by ConfigSources which need to know whether a loaded configuration was applied.
+// Commit is called once the configuration returned by the previous call to Load is in use.
+// A configuration that failed to apply, for example because a plugin could not be started,
+// is not committed, so the source should return it again instead of ErrConfigUnchanged.
+type ConfigCommitter interface {
+	Commit()
+}
+
+// ConfigSourceFactory creates the ConfigSource for a configuration URL.
+type ConfigSourceFactory func(u *url.URL) (ConfigSource, error)
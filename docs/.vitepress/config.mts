@@ -25,6 +25,7 @@ export default defineConfig({
             { text: "Why Ika", link: "/guide/why-ika" },
             { text: "Motivation", link: "/guide/motivation" },
             { text: "Getting Started", link: "/guide/getting-started" },
+            { text: "Upstream Errors", link: "/guide/errors" },
             { text: "Showcase", link: "/guide/showcase" },
           ],
         },
@@ -39,6 +40,12 @@ export default defineConfig({
             { text: "Request ID", link: "/plugins/request-id" },
             { text: "Request Modifier", link: "/plugins/request-modifier" },
             { text: "Fail2Ban", link: "/plugins/fail2ban" },
+            { text: "Traffic Split", link: "/plugins/traffic-split" },
+            { text: "Mirror", link: "/plugins/mirror" },
+            { text: "Body Limit", link: "/plugins/body-limit" },
+            { text: "WebAssembly", link: "/plugins/wasm" },
+            { text: "External", link: "/plugins/external" },
+            { text: "Script", link: "/plugins/script" },
           ],
         },
       ],
@@ -0,0 +1,121 @@
+package gateway
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/alx99/ika/internal/config"
+	iika "github.com/alx99/ika/internal/ika"
+	"github.com/alx99/ika/request"
+)
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [flags] [command]\n\n", os.Args[0])
+	fmt.Fprintln(out, "Commands:")
+	fmt.Fprintln(out, "  routes                                        Print every registered route and exit.")
+	fmt.Fprintln(out, "  match <method> <url> [-H hdr] [-server name]  Print which route would handle a request and exit.")
+	fmt.Fprintln(out, "  schema                                        Print the JSON Schema of the configuration file and exit.")
+	fmt.Fprintln(out, "\nFlags:")
+	flag.PrintDefaults()
+}
+
+func runCommand(name string, args []string, cfg config.ComptimeOpts) error {
+	ctx := context.Background()
+
+	switch name {
+	case "routes":
+		if len(args) > 0 {
+			return fmt.Errorf("routes: unexpected arguments: %s", strings.Join(args, " "))
+		}
+		return iika.PrintRoutes(ctx, os.Stdout, *configPath, cfg, *format)
+
+	case "match":
+		req, err := parseMatchArgs(ctx, args)
+		if err != nil {
+			return fmt.Errorf("match: %w", err)
+		}
+		return iika.PrintMatch(ctx, os.Stdout, *configPath, cfg, *format, req)
+
+	case "schema":
+		if len(args) > 0 {
+			return fmt.Errorf("schema: unexpected arguments: %s", strings.Join(args, " "))
+		}
+		return iika.PrintSchema(os.Stdout, cfg)
+
+	default:
+		return fmt.Errorf("unknown command %q", name)
+	}
+}
+
+// headerFlags collects repeated -H flags.
+type headerFlags []string
+
+func (h *headerFlags) String() string { return strings.Join(*h, ", ") }
+
+func (h *headerFlags) Set(v string) error {
+	*h = append(*h, v)
+	return nil
+}
+
+// parseMatchArgs parses "<method> <url> [-H 'Name: value']... [-server name]" into a request.
+// Flags may appear before, between or after the positional arguments.
+func parseMatchArgs(ctx context.Context, args []string) (*http.Request, error) {
+	fs := flag.NewFlagSet("match", flag.ContinueOnError)
+	var headers headerFlags
+	fs.Var(&headers, "H", "Request header in the form 'Name: value'. May be repeated.")
+	server := fs.String("server", "", "Name of the server receiving the request.")
+
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	if len(positional) != 2 {
+		return nil, fmt.Errorf("expected <method> <url>, got %d argument(s)", len(positional))
+	}
+
+	u, err := url.Parse(positional[1])
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("url %q must be absolute", positional[1])
+	}
+
+	if *server != "" {
+		ctx = request.WithServer(ctx, *server)
+	}
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(positional[0]), u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.RequestURI = u.RequestURI()
+
+	for _, h := range headers {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid header %q", h)
+		}
+		req.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	if host := req.Header.Get("Host"); host != "" {
+		req.Host = host
+		req.Header.Del("Host")
+	}
+
+	return req, nil
+}
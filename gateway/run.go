@@ -1,9 +1,12 @@
 package gateway
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/alx99/ika"
 
@@ -13,19 +16,26 @@ import (
 
 var (
 	printVersion = flag.Bool("version", false, "Print the version and exit.")
-	configPath   = flag.String("config", "ika.yaml", "Path to the configuration file.")
+	configPath   = flag.String("config", "ika.yaml", "Path or URL of the configuration.")
+	pollInterval = flag.Duration("poll-interval", 0, "Interval at which the configuration is checked for changes. 0 disables reloading.")
+	configCache  = flag.String("config-cache", "", "Where the last good remote configuration is cached. Defaults to the user cache directory, - disables caching.")
 	validate     = flag.Bool("validate", false, "Validate the configuration file and exit.")
+	format       = flag.String("format", "text", "Output format of -validate and commands: text or json.")
+
+	upgradeBinary  = flag.String("upgrade-binary", "", "Binary started on SIGUSR2 to take over the listeners. Defaults to the path the running binary was started from.")
+	upgradeTimeout = flag.Duration("upgrade-timeout", 30*time.Second, "How long to wait for the process started on SIGUSR2 to be ready before abandoning the upgrade.")
 )
 
 // Run runs Ika gateway.
 func Run(opts ...Option) {
+	flag.Usage = usage
 	flag.Parse()
 	if *printVersion {
 		fmt.Println("0.0.1")
 		os.Exit(0)
 	}
 
-	cfg := config.ComptimeOpts{Validate: *validate}
+	cfg := config.ComptimeOpts{}
 	for _, opt := range opts {
 		if err := opt(&cfg); err != nil {
 			fmt.Fprintf(os.Stderr, "failed to apply option: %s\n", err)
@@ -33,7 +43,31 @@ func Run(opts ...Option) {
 		}
 	}
 
-	iika.Run(*configPath, cfg)
+	if *validate {
+		valid, err := iika.Validate(context.Background(), os.Stdout, *configPath, cfg, *format)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to validate: %s\n", err)
+			os.Exit(1)
+		}
+		if !valid {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if flag.NArg() > 0 {
+		if err := runCommand(flag.Arg(0), flag.Args()[1:], cfg); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	iika.Run(
+		iika.Source{URI: *configPath, PollInterval: *pollInterval, CachePath: *configCache},
+		iika.Upgrade{Binary: *upgradeBinary, Timeout: *upgradeTimeout},
+		cfg,
+	)
 }
 
 // Option represents an option for Run.
@@ -53,3 +87,31 @@ func WithPlugin(factory ika.PluginFactory) Option {
 		return nil
 	}
 }
+
+// WithErrorHandler sets the error handler writing the responses of failed requests,
+// in place of ika.DefaultErrorHandler. It is used for every namespace and server,
+// after the error pages and ErrorHook plugins configured for them.
+func WithErrorHandler(h ika.ErrorHandler) Option {
+	return func(cfg *config.ComptimeOpts) error {
+		if cfg.ErrorHandler != nil {
+			return errors.New("error handler already registered")
+		}
+		cfg.ErrorHandler = h
+		return nil
+	}
+}
+
+// WithConfigSource registers a configuration source for URLs with the given scheme.
+// When -config is such a URL, the configuration is loaded from the source created by factory.
+func WithConfigSource(scheme string, factory ika.ConfigSourceFactory) Option {
+	return func(cfg *config.ComptimeOpts) error {
+		if cfg.ConfigSources == nil {
+			cfg.ConfigSources = make(map[string]ika.ConfigSourceFactory)
+		}
+		if _, ok := cfg.ConfigSources[scheme]; ok {
+			return fmt.Errorf("configuration source %q already registered", scheme)
+		}
+		cfg.ConfigSources[scheme] = factory
+		return nil
+	}
+}
@@ -9,7 +9,7 @@ import (
 	"slices"
 	"strings"
 
-	"github.com/alx99/ika/internal/http/request"
+	"github.com/alx99/ika/request"
 )
 
 const (
@@ -18,10 +18,14 @@ const (
 
 	// ScopeNamespace indicates that the plugin is injected at the namespace scope.
 	ScopeNamespace
+
+	// ScopeServer indicates that the plugin is injected as a hook of a server,
+	// running for every request the server receives.
+	ScopeServer
 )
 
 // InjectionLevel represents the granularity at which a plugin is injected.
-// It determines whether a plugin is applied at a route or namespace scope.
+// It determines whether a plugin is applied at a route, namespace or server scope.
 type InjectionLevel uint8
 
 // ErrorHandler is a function that handles errors that occur during request processing.
@@ -36,6 +40,39 @@ type PluginFactory interface {
 	New(ctx context.Context, ictx InjectionContext, config map[string]any) (Plugin, error)
 }
 
+// ConfigSchemaProvider can optionally be implemented by a PluginFactory
+// to describe the configuration accepted by its plugins as a JSON Schema.
+// The schema is published as part of the configuration schema and
+// plugin configurations are validated against it before New is called.
+type ConfigSchemaProvider interface {
+	// ConfigSchema returns the JSON Schema of the plugin configuration.
+	ConfigSchema() map[string]any
+}
+
+// DependencyProvider can optionally be implemented by a PluginFactory
+// to declare the plugins its plugins depend on or have to run before or after.
+// The declarations are validated against the chain of every route the plugins
+// are part of when the configuration is loaded.
+type DependencyProvider interface {
+	// Dependencies returns the dependencies of the plugins produced by the factory.
+	Dependencies() Dependencies
+}
+
+// Dependencies declares how a plugin is ordered relative to other plugins in the chain of a request.
+// The chain consists of the hooks, request modifiers and middlewares of a namespace
+// followed by the ones of the route, or of the hooks of a server.
+// Plugins are referred to by name.
+type Dependencies struct {
+	// Requires lists the plugins that must run before the plugin.
+	Requires []string
+
+	// After lists the plugins that must run before the plugin if they are part of the chain.
+	After []string
+
+	// Before lists the plugins that must run after the plugin if they are part of the chain.
+	Before []string
+}
+
 // InjectionContext contains information about the context in which a plugin is injected.
 type InjectionContext struct {
 	// Namespace specifies the target namespace for plugin injection.
@@ -49,7 +86,7 @@ type InjectionContext struct {
 	// TODO: provide mux pattern
 
 	// Scope indicates the injection level at which the plugin is applied.
-	// It can be either ScopeRoute or ScopeNamespace.
+	// It can be ScopeRoute, ScopeNamespace or ScopeServer.
 	Scope InjectionLevel
 
 	// Logger is the logger allocated for the plugin.
@@ -57,6 +94,9 @@ type InjectionContext struct {
 }
 
 // Plugin is the common interface for all plugins in Ika.
+// A plugin is created once per declaration in the configuration and shared by everything
+// the declaration applies to, such as all mounts of a route, and is used for all the
+// interfaces it implements.
 type Plugin interface {
 	// Teardown releases any resources allocated by the plugin.
 	Teardown(ctx context.Context) error
@@ -75,6 +115,7 @@ type Middleware interface {
 	Plugin
 
 	// Handler wraps the given HTTP handler with additional plugin-specific logic.
+	// It is called once for every route and mount the plugin applies to, and must not store next in the plugin.
 	Handler(next Handler) Handler
 }
 
@@ -95,6 +136,50 @@ type OnRequestHook interface {
 	Middleware
 }
 
+// ErrorHook enables plugins to handle the errors of requests, for example to
+// translate them into their own response format or to report them to an error tracker.
+type ErrorHook interface {
+	Plugin
+
+	// ErrorHandler wraps the given error handler, which writes the error response as configured otherwise.
+	// It may handle the error itself or pass it on, possibly replaced by another error.
+	ErrorHandler(next ErrorHandler) ErrorHandler
+}
+
+// Starter enables plugins to start work once Ika is serving requests, such as background goroutines.
+type Starter interface {
+	Plugin
+
+	// Start is called once all servers are listening, or, for plugins created by a configuration reload,
+	// before the new configuration is applied. ctx is cancelled when the plugin is torn down.
+	// Start must not block. An error stops Ika from starting, or the new configuration from being applied.
+	Start(ctx context.Context) error
+}
+
+// Readier enables plugins to report whether they are ready to serve requests,
+// as reflected by the readiness endpoint of servers.
+type Readier interface {
+	Plugin
+
+	// Ready returns nil if the plugin is ready, or an error describing why it is not.
+	Ready() error
+}
+
+// Reloader enables plugins to apply a new configuration in place, keeping their state across
+// configuration reloads instead of being replaced by a new instance.
+//
+// The instance is taken over by the router built for the new configuration. Its other methods,
+// such as Handler, are called again while the previous router still serves requests,
+// so they must not modify the plugin.
+type Reloader interface {
+	Plugin
+
+	// Reload applies config, which has been validated against the schema of the plugin.
+	// It is only called if the configuration of the plugin changed.
+	// If the new configuration of Ika cannot be applied, Reload is called again with the previous one.
+	Reload(ctx context.Context, config map[string]any) error
+}
+
 // Handler is similar to http.Handler but its ServeHTTP method may return an error.
 type Handler interface {
 	ServeHTTP(w http.ResponseWriter, r *http.Request) error
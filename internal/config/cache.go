@@ -0,0 +1,51 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+)
+
+// DefaultCachePath returns the path at which the last good configuration loaded from uri is cached.
+// It is empty if the user has no cache directory.
+func DefaultCachePath(uri string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(uri))
+	return filepath.Join(dir, "ika", "config-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// WriteCache atomically replaces the cached configuration at path with data.
+// The file is only readable by the current user since configurations may contain credentials.
+func WriteCache(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // no-op after a successful rename
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// ReadCache reads the configuration cached at path.
+func ReadCache(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	return Parse(data)
+}
@@ -0,0 +1,201 @@
+package config
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+var unmarshalerType = reflect.TypeFor[json.Unmarshaler]()
+
+// unknownField is the message of problems reporting fields unknown to Ika.
+const unknownField = "unknown field"
+
+// check walks the decoded JSON value v and compares it against the Go type t,
+// reporting every mismatch instead of stopping at the first one like [json.Unmarshal] does.
+func check(path Path, v any, t reflect.Type) Problems {
+	if v == nil {
+		return nil // null leaves the field untouched
+	}
+
+	if reflect.PointerTo(t).Implements(unmarshalerType) {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return Problems{{Path: path, Message: err.Error()}}
+		}
+		target := reflect.New(t).Interface().(json.Unmarshaler)
+		if err := target.UnmarshalJSON(raw); err != nil {
+			return Problems{{Path: path, Message: err.Error()}}
+		}
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return check(path, v, t.Elem())
+
+	case reflect.Interface:
+		return nil
+
+	case reflect.Struct:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return typeMismatch(path, "object", v)
+		}
+		fields := jsonFields(t)
+
+		var problems Problems
+		for _, key := range slices.Sorted(maps.Keys(obj)) {
+			field, ok := fields[key]
+			if !ok {
+				problems = append(problems, Problem{Path: path.Field(key), Message: unknownField})
+				continue
+			}
+			problems = append(problems, check(path.Field(key), obj[key], field.Type)...)
+		}
+		return problems
+
+	case reflect.Map:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return typeMismatch(path, "object", v)
+		}
+		var problems Problems
+		for _, key := range slices.Sorted(maps.Keys(obj)) {
+			problems = append(problems, check(path.Field(key), obj[key], t.Elem())...)
+		}
+		return problems
+
+	case reflect.Slice, reflect.Array:
+		arr, ok := v.([]any)
+		if !ok {
+			return typeMismatch(path, "array", v)
+		}
+		var problems Problems
+		for i := range arr {
+			problems = append(problems, check(path.Index(i), arr[i], t.Elem())...)
+		}
+		return problems
+
+	case reflect.String:
+		if _, ok := v.(string); !ok {
+			return typeMismatch(path, "string", v)
+		}
+
+	case reflect.Bool:
+		if _, ok := v.(bool); !ok {
+			return typeMismatch(path, "boolean", v)
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := v.(float64)
+		if !ok || n != math.Trunc(n) {
+			return typeMismatch(path, "integer", v)
+		}
+
+	case reflect.Float32, reflect.Float64:
+		if _, ok := v.(float64); !ok {
+			return typeMismatch(path, "number", v)
+		}
+	}
+
+	return nil
+}
+
+// walkPlugins calls fn with the path and value of every plugin declared in v,
+// the decoded JSON value of type t.
+func walkPlugins(path Path, v any, t reflect.Type, fn func(Path, map[string]any)) {
+	switch t.Kind() {
+	case reflect.Pointer:
+		walkPlugins(path, v, t.Elem(), fn)
+
+	case reflect.Struct:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return
+		}
+		if t == reflect.TypeFor[Plugin]() {
+			fn(path, obj)
+			return
+		}
+		fields := jsonFields(t)
+		for _, key := range slices.Sorted(maps.Keys(obj)) {
+			if field, ok := fields[key]; ok {
+				walkPlugins(path.Field(key), obj[key], field.Type, fn)
+			}
+		}
+
+	case reflect.Map:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return
+		}
+		for _, key := range slices.Sorted(maps.Keys(obj)) {
+			walkPlugins(path.Field(key), obj[key], t.Elem(), fn)
+		}
+
+	case reflect.Slice, reflect.Array:
+		arr, _ := v.([]any)
+		for i := range arr {
+			walkPlugins(path.Index(i), arr[i], t.Elem(), fn)
+		}
+	}
+}
+
+// splitUnknown separates the problems reporting unknown fields from the others.
+func splitUnknown(problems Problems) (other, unknown Problems) {
+	for _, p := range problems {
+		if p.Message == unknownField {
+			unknown = append(unknown, p)
+		} else {
+			other = append(other, p)
+		}
+	}
+	return other, unknown
+}
+
+// jsonFields returns the struct fields of t keyed by their JSON name,
+// including fields promoted from embedded structs.
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField, t.NumField())
+	for _, field := range reflect.VisibleFields(t) {
+		if !field.IsExported() || field.Anonymous {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		fields[cmp.Or(name, field.Name)] = field
+	}
+	return fields
+}
+
+func typeMismatch(path Path, want string, got any) Problems {
+	return Problems{{Path: path, Message: fmt.Sprintf("expected %s, got %s", want, jsonTypeName(got))}}
+}
+
+func jsonTypeName(v any) string {
+	switch v := v.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	}
+	return "null"
+}
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/alx99/ika"
+	"github.com/matryer/is"
+)
+
+func TestParse_problems(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		data string
+		want Problems
+	}{
+		{
+			name: "valid",
+			data: `{"servers":[{"addr":":8080","readTimeout":"5s"}],"namespaces":{"ns":{"mounts":["/"],"routes":{"/a":{"methods":["GET"]}}}}}`,
+		},
+		{
+			name: "no servers",
+			data: `{"namespaces":{}}`,
+			want: Problems{{Path: "$.servers", Message: "at least one server must be specified"}},
+		},
+		{
+			name: "every problem is reported",
+			data: `{
+				"servers": [{"addr": 8080, "readTimeout": "5x"}],
+				"ika": {"unknown": true},
+				"namespaces": {"ns": {"mounts": "/", "routes": {"/a b": {"methods": ["GET", "FOO"]}}}}
+			}`,
+			want: Problems{
+				{Path: "$.namespaces.ns.mounts", Message: "expected array, got string"},
+				{Path: "$.namespaces.ns.routes['/a b'].methods[1]", Message: "invalid method: FOO"},
+				{Path: "$.servers[0].addr", Message: "expected string, got integer"},
+				{Path: "$.servers[0].readTimeout", Message: `time: unknown unit "x" in duration "5x"`},
+			},
+		},
+		{
+			name: "route match",
+			data: `{"servers":[{"addr":":8080"}],"namespaces":{"ns":{"routes":{"/a":{"match":{
+				"headers": {"X-Tenant": "acme", "X-Beta": {"regex": "^(1|true)$"}},
+				"query": {"q": {"regex": "("}},
+				"cookies": {"c": {"value": "a", "regex": "b"}}
+			}}}}}}`,
+			want: Problems{
+				{Path: "$.namespaces.ns.routes['/a'].match.cookies.c", Message: "exactly one of value and regex must be set"},
+				{Path: "$.namespaces.ns.routes['/a'].match.query.q", Message: "error parsing regexp: missing closing ): `(`"},
+			},
+		},
+		{
+			name: "transport TLS",
+			data: `{"servers":[{"addr":":8080"}],"namespaces":{"ns":{"transport":{"tls":{"minVersion":"1.5","caFile":1}}}}}`,
+			want: Problems{
+				{Path: "$.namespaces.ns.transport.tls.caFile", Message: "expected string, got integer"},
+				{Path: "$.namespaces.ns.transport.tls.minVersion", Message: "invalid TLS version: 1.5"},
+			},
+		},
+		{
+			name: "socket mode",
+			data: `{"servers":[{"addr":"unix:/run/ika.sock","socketMode":"0999"}]}`,
+			want: Problems{{Path: "$.servers[0].socketMode", Message: "invalid file mode: 0999"}},
+		},
+		{
+			name: "server names",
+			data: `{"servers":[{"addr":":8080"},{"addr":":9000","name":"admin"},{"addr":":9001","name":"admin"}],
+				"namespaces":{"ns":{"servers":[":8080","public"]}}}`,
+			want: Problems{
+				{Path: "$.servers[2].name", Message: `duplicate server name "admin"`},
+				{Path: "$.namespaces.ns.servers[1]", Message: `unknown server "public"`},
+			},
+		},
+		{
+			name: "readiness path",
+			data: `{"servers":[{"addr":":8080","readinessPath":"readyz"}]}`,
+			want: Problems{{Path: "$.servers[0].readinessPath", Message: `readiness path "readyz" must start with /`}},
+		},
+		{
+			name: "error format",
+			data: `{"servers":[{"addr":":8080"}],"namespaces":{"ns":{"errorPages":{"format":"xml"}}}}`,
+			want: Problems{{Path: "$.namespaces.ns.errorPages.format", Message: "invalid error format: xml"}},
+		},
+		{
+			name: "fractional integer",
+			data: `{"servers":[{"addr":":8080","maxHeaderBytes":1.5}]}`,
+			want: Problems{{Path: "$.servers[0].maxHeaderBytes", Message: "expected integer, got number"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			is := is.New(t)
+
+			_, err := Parse([]byte(tt.data))
+			if tt.want == nil {
+				is.NoErr(err) // config should be valid
+				return
+			}
+
+			var problems Problems
+			is.True(errors.As(err, &problems)) // error should be Problems
+			is.Equal(problems, tt.want)
+		})
+	}
+}
+
+func TestUnknownFields(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	data := []byte(`{
+		"servers": [{"addr": ":8080", "adress": ":9090"}],
+		"ika": {"unknown": true},
+		"namespaces": {"ns": {
+			"mounts": [""],
+			"middlewares": [{"name": "schema-plugin", "config": {"limit": 1, "limt": 2}}],
+			"routes": {"/a": {"hooks": []}}
+		}}
+	}`)
+
+	_, err := Parse(data)
+	is.NoErr(err) // unknown fields are ignored when parsing
+	is.Equal(UnknownFields(data, map[string]ika.PluginFactory{"schema-plugin": schemaFactory{}}), Problems{
+		{Path: "$.ika.unknown", Message: "unknown field"},
+		{Path: "$.namespaces.ns.routes['/a'].hooks", Message: "unknown field"},
+		{Path: "$.servers[0].adress", Message: "unknown field"},
+		{Path: "$.namespaces.ns.middlewares[0].config.limt", Message: "unknown field"},
+	})
+}
+
+func TestPath(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	is.Equal(RootPath.Field("namespaces").Field("my-ns").Field("routes").Field("/{id}").Field("middlewares").Index(2),
+		Path("$.namespaces.my-ns.routes['/{id}'].middlewares[2]"))
+	is.Equal(RootPath.Field("it's"), Path(`$['it\'s']`))
+}
@@ -3,12 +3,13 @@ package config
 import (
 	"encoding/json"
 	"errors"
-	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"reflect"
 	"time"
 
+	"github.com/alx99/ika"
 	"sigs.k8s.io/yaml"
 )
 
@@ -19,37 +20,87 @@ type Config struct {
 }
 
 func Read(path string) (Config, error) {
-	cfg := Config{}
-
-	f, err := os.Open(path)
+	data, err := ReadFile(path)
 	if err != nil {
-		return cfg, err
+		return Config{}, err
 	}
+	return Parse(data)
+}
 
-	data, err := io.ReadAll(f)
+// ReadFile reads the configuration file at path and returns its content as JSON.
+func ReadFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return cfg, err
+		return nil, err
 	}
 
 	if ext := filepath.Ext(path); ext == ".yaml" {
 		data, err = yaml.YAMLToJSONStrict(data)
 		if err != nil {
-			return cfg, err
+			return nil, err
 		}
 	}
 
-	defer f.Close()
+	return data, nil
+}
+
+// Parse parses the JSON encoded configuration.
+// If the configuration is invalid, the returned error is of type [Problems]
+// and contains every problem that was found.
+// Fields unknown to Ika are ignored, see [UnknownFields].
+func Parse(data []byte) (Config, error) {
+	cfg := Config{}
+
+	var raw any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return cfg, Problems{{Path: RootPath, Message: err.Error()}}
+	}
+
+	problems, _ := splitUnknown(check(RootPath, raw, reflect.TypeFor[Config]()))
+	if len(problems) > 0 {
+		return cfg, problems
+	}
+
 	if err := json.Unmarshal(data, &cfg); err != nil {
-		return cfg, err
+		return cfg, Problems{{Path: RootPath, Message: err.Error()}}
 	}
 
 	if len(cfg.Servers) < 1 {
-		return cfg, errors.New("at least one server must be specified")
+		return cfg, Problems{{Path: RootPath.Field("servers"), Message: "at least one server must be specified"}}
+	}
+
+	if problems := checkServers(cfg); len(problems) > 0 {
+		return cfg, problems
 	}
 
 	return cfg, nil
 }
 
+// UnknownFields returns a problem for every field of the JSON encoded configuration
+// which is unknown to Ika or to the plugin created by factories it configures, such as
+// a misspelled option. [Parse] and [ValidatePluginConfig] ignore them, so they are
+// reported as warnings when Ika runs, and as problems by -validate.
+func UnknownFields(data []byte, factories map[string]ika.PluginFactory) Problems {
+	var raw any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil
+	}
+	_, unknown := splitUnknown(check(RootPath, raw, reflect.TypeFor[Config]()))
+
+	walkPlugins(RootPath, raw, reflect.TypeFor[Config](), func(path Path, plugin map[string]any) {
+		name, _ := plugin["name"].(string)
+		factory, ok := factories[name]
+		if !ok {
+			return
+		}
+		cfg, _ := plugin["config"].(map[string]any)
+		problems, _ := pluginConfigProblems(factory, path.Field("config"), cfg)
+		_, u := splitUnknown(problems)
+		unknown = append(unknown, u...)
+	})
+	return unknown
+}
+
 type Duration time.Duration
 
 func (d *Duration) LogValue() slog.Value {
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// ErrorPages customizes the error responses written when a request fails,
+// for example because the upstream cannot be reached.
+// The settings of a route take precedence over the ones of its namespace.
+type ErrorPages struct {
+	// Format is the format of error responses without a page, see ErrorFormat.
+	Format ErrorFormat `json:"format"`
+	// HideDetail omits the detail of 5xx responses, which may reveal internals of the gateway and its upstreams.
+	HideDetail *bool `json:"hideDetail"`
+	// RequestIDHeader is the request header the request ID is read from, X-Request-ID by default.
+	RequestIDHeader string `json:"requestIDHeader"`
+	// Pages are the templated bodies of error responses, by status code such as "404"
+	// or by range such as "5xx" or "500-504". The most specific page is used.
+	Pages map[string]ErrorPage `json:"pages"`
+}
+
+// IsZero reports whether p does not change the default error responses.
+func (p ErrorPages) IsZero() bool {
+	return p.Format == "" && p.HideDetail == nil && p.RequestIDHeader == "" && len(p.Pages) == 0
+}
+
+// ErrorPage is the body of an error response.
+type ErrorPage struct {
+	// ContentType is the content type of the response, "text/html; charset=utf-8" by default.
+	// HTML templates escape the values they insert.
+	ContentType string `json:"contentType"`
+	// Body is a Go template of the body. Status, Title, Detail, Type, RequestID, Method and Path
+	// of the failed request are available to it.
+	Body string `json:"body"`
+	// File is the path of a file containing the template, instead of Body.
+	File string `json:"file"`
+}
+
+// ErrorFormat is the format of error responses:
+//   - "legacy" writes JSON or plain text, depending on the Accept header of the request.
+//   - "problem" writes RFC 7807 application/problem+json.
+//
+// Defaults to legacy.
+type ErrorFormat string
+
+const (
+	ErrorFormatLegacy  ErrorFormat = "legacy"
+	ErrorFormatProblem ErrorFormat = "problem"
+)
+
+var errorFormats = []ErrorFormat{ErrorFormatLegacy, ErrorFormatProblem}
+
+func (f *ErrorFormat) UnmarshalJSON(data []byte) error {
+	var tmp string
+	if err := json.Unmarshal(data, &tmp); err != nil {
+		return err
+	}
+
+	if !slices.Contains(errorFormats, ErrorFormat(tmp)) {
+		return fmt.Errorf("invalid error format: %s", tmp)
+	}
+
+	*f = ErrorFormat(tmp)
+	return nil
+}
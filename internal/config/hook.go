@@ -1,14 +1,22 @@
 package config
 
 import (
+	"cmp"
 	"iter"
+	"slices"
 )
 
 type (
 	Plugin struct {
-		Name    string         `json:"name"`
-		Enabled *bool          `json:"enabled"`
-		Config  map[string]any `json:"config"`
+		Name    string `json:"name"`
+		Enabled *bool  `json:"enabled"`
+		// Priority orders the plugin within the list it is declared in.
+		// Plugins with a higher priority run first, plugins with the same priority in the order they are declared.
+		Priority int `json:"priority"`
+		// IgnoreOrder reports the plugins the plugin has to run before or after, but does not,
+		// as warnings instead of errors. Plugins it requires must still run earlier.
+		IgnoreOrder bool           `json:"ignoreOrder"`
+		Config      map[string]any `json:"config"`
 	}
 	Plugins []Plugin
 )
@@ -26,6 +34,40 @@ func (p Plugins) Enabled() iter.Seq[Plugin] {
 	}
 }
 
+// EnabledIndexed returns an iterator that yields all enabled plugins
+// together with their index in p.
+func (p Plugins) EnabledIndexed() iter.Seq2[int, Plugin] {
+	return func(yield func(int, Plugin) bool) {
+		for i, plugin := range p {
+			if plugin.Enabled == nil || *plugin.Enabled {
+				if !yield(i, plugin) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Ordered returns an iterator that yields all enabled plugins together with
+// their index in p, in the order they run in as set by their priority.
+func (p Plugins) Ordered() iter.Seq2[int, Plugin] {
+	indices := make([]int, 0, len(p))
+	for i := range p.EnabledIndexed() {
+		indices = append(indices, i)
+	}
+	slices.SortStableFunc(indices, func(a, b int) int {
+		return cmp.Compare(p[b].Priority, p[a].Priority)
+	})
+
+	return func(yield func(int, Plugin) bool) {
+		for _, i := range indices {
+			if !yield(i, p[i]) {
+				return
+			}
+		}
+	}
+}
+
 // Names returns an iterator that yields all enabled plugin names.
 func (p Plugins) Names() iter.Seq[string] {
 	return func(yield func(string) bool) {
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"regexp"
+
+	"github.com/alx99/ika/jsonschema"
+)
+
+// Match restricts a route to requests with matching headers, query parameters and cookies.
+// Every condition must be satisfied for the route to handle a request.
+type Match struct {
+	Headers map[string]ValueMatch `json:"headers"`
+	Query   map[string]ValueMatch `json:"query"`
+	Cookies map[string]ValueMatch `json:"cookies"`
+}
+
+// IsZero reports whether m has no conditions.
+func (m Match) IsZero() bool {
+	return len(m.Headers) == 0 && len(m.Query) == 0 && len(m.Cookies) == 0
+}
+
+// ValueMatch matches a single value, either exactly or against a regular expression.
+// It is written either as a string, which is matched exactly, or as an object
+// with one of the fields value or regex.
+type ValueMatch struct {
+	Value string `json:"value,omitempty"`
+	Regex string `json:"regex,omitempty"`
+}
+
+func (v *ValueMatch) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err == nil {
+		*v = ValueMatch{Value: value}
+		return nil
+	}
+
+	type alias ValueMatch
+	var tmp alias
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&tmp); err != nil {
+		return err
+	}
+
+	if (tmp.Value == "") == (tmp.Regex == "") {
+		return errors.New("exactly one of value and regex must be set")
+	}
+	if tmp.Regex != "" {
+		if _, err := regexp.Compile(tmp.Regex); err != nil {
+			return err
+		}
+	}
+
+	*v = ValueMatch(tmp)
+	return nil
+}
+
+func (*ValueMatch) JSONSchema() *jsonschema.Schema {
+	return &jsonschema.Schema{AnyOf: []*jsonschema.Schema{
+		{Type: "string"},
+		{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"value": {Type: "string"},
+				"regex": {Type: "string"},
+			},
+			AdditionalProperties: jsonschema.False(),
+		},
+	}}
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -9,24 +10,24 @@ import (
 
 type Method string
 
+var validMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodConnect,
+	http.MethodOptions,
+	http.MethodTrace,
+}
+
 func (m *Method) UnmarshalJSON(data []byte) error {
 	var tmp string
 	if err := json.Unmarshal(data, &tmp); err != nil {
 		return err
 	}
 
-	validMethods := []string{
-		http.MethodGet,
-		http.MethodHead,
-		http.MethodPost,
-		http.MethodPut,
-		http.MethodPatch,
-		http.MethodDelete,
-		http.MethodConnect,
-		http.MethodOptions,
-		http.MethodTrace,
-	}
-
 	if !slices.Contains(validMethods, tmp) {
 		return fmt.Errorf("invalid method: %s", tmp)
 	}
@@ -34,3 +35,32 @@ func (m *Method) UnmarshalJSON(data []byte) error {
 	*m = Method(tmp)
 	return nil
 }
+
+// TLSVersion is a TLS protocol version such as "1.2".
+type TLSVersion string
+
+var tlsVersions = map[TLSVersion]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func (v *TLSVersion) UnmarshalJSON(data []byte) error {
+	var tmp string
+	if err := json.Unmarshal(data, &tmp); err != nil {
+		return err
+	}
+
+	if _, ok := tlsVersions[TLSVersion(tmp)]; !ok {
+		return fmt.Errorf("invalid TLS version: %s", tmp)
+	}
+
+	*v = TLSVersion(tmp)
+	return nil
+}
+
+// ID returns the version as one of the tls.Version constants, or 0 if it is unset.
+func (v TLSVersion) ID() uint16 {
+	return tlsVersions[v]
+}
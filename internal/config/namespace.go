@@ -2,12 +2,18 @@ package config
 
 type (
 	Namespace struct {
-		Transport    Transport `json:"transport"`
-		Mounts       []string  `json:"mounts"`
-		Routes       Routes    `json:"routes"`
-		Middlewares  Plugins   `json:"middlewares"`
-		ReqModifiers Plugins   `json:"reqModifiers"`
-		Hooks        Plugins   `json:"hooks"`
+		Transport Transport `json:"transport"`
+		// BufferSize is the size of the buffers responses are copied with, 32KiB by default.
+		BufferSize   int      `json:"bufferSize"`
+		Mounts       []string `json:"mounts"`
+		Routes       Routes   `json:"routes"`
+		Middlewares  Plugins  `json:"middlewares"`
+		ReqModifiers Plugins  `json:"reqModifiers"`
+		Hooks        Plugins  `json:"hooks"`
+		// Servers are the names of the servers the routes are served on, all servers if it is empty.
+		Servers []string `json:"servers"`
+		// ErrorPages customizes the error responses of the routes of the namespace.
+		ErrorPages ErrorPages `json:"errorPages"`
 	}
 	Namespaces map[string]Namespace
 )
@@ -3,6 +3,8 @@ package config
 import "github.com/alx99/ika"
 
 type ComptimeOpts struct {
-	Plugins  map[string]ika.PluginFactory
-	Validate bool
+	Plugins       map[string]ika.PluginFactory
+	ConfigSources map[string]ika.ConfigSourceFactory
+	// ErrorHandler writes error responses in place of ika.DefaultErrorHandler.
+	ErrorHandler ika.ErrorHandler
 }
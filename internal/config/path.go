@@ -2,9 +2,42 @@ package config
 
 type (
 	Route struct {
-		Methods      []Method `json:"methods"`
-		Middlewares  Plugins  `json:"middlewares"`
-		ReqModifiers Plugins  `json:"reqModifiers"`
+		Methods      []Method  `json:"methods"`
+		Match        Match     `json:"match"`
+		Upgrade      Upgrade   `json:"upgrade"`
+		Streaming    Streaming `json:"streaming"`
+		Middlewares  Plugins   `json:"middlewares"`
+		ReqModifiers Plugins   `json:"reqModifiers"`
+		// ErrorPages customizes the error responses of the route.
+		ErrorPages ErrorPages `json:"errorPages"`
 	}
 	Routes map[string]Route
+
+	// Upgrade controls requests that upgrade the connection to another protocol, such as WebSockets.
+	// Upgrades to any protocol are allowed by default.
+	Upgrade struct {
+		// Disabled rejects upgrade requests with 403 Forbidden.
+		Disabled bool `json:"disabled"`
+		// Protocols limits upgrades to the listed protocols, such as websocket.
+		Protocols []string `json:"protocols"`
+		// IdleTimeout closes upgraded connections that carry no data for this long.
+		IdleTimeout Duration `json:"idleTimeout"`
+		// MaxLifetime closes upgraded connections once they have been open for this long.
+		MaxLifetime Duration `json:"maxLifetime"`
+	}
+
+	// Streaming controls how responses are streamed to the client, e.g. for server-sent events and long polling.
+	Streaming struct {
+		// FlushInterval is how often the response is flushed to the client while it is copied from the upstream.
+		// Responses are buffered if it is unset, except server-sent events and responses of unknown length,
+		// which are always flushed immediately.
+		FlushInterval Duration `json:"flushInterval"`
+		// FlushImmediately flushes the response after every write.
+		FlushImmediately bool `json:"flushImmediately"`
+		// DisableWriteTimeout lifts the write timeout of the server for every response of the route.
+		DisableWriteTimeout bool `json:"disableWriteTimeout"`
+		// DetectEventStream lifts the write timeout of the server for server-sent events (text/event-stream).
+		// It is enabled by default.
+		DetectEventStream *bool `json:"detectEventStream"`
+	}
 )
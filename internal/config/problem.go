@@ -0,0 +1,91 @@
+package config
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RootPath is the path to the root of the configuration.
+const RootPath Path = "$"
+
+// Path is a JSONPath pointing to a field in the configuration,
+// e.g. $.namespaces.api.routes['/users'].middlewares[0].
+type Path string
+
+var identRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// Field returns the path to the named field of the object at p.
+func (p Path) Field(name string) Path {
+	if identRe.MatchString(name) {
+		return p + "." + Path(name)
+	}
+	return p + "['" + Path(strings.ReplaceAll(name, "'", `\'`)) + "']"
+}
+
+// Index returns the path to the i-th element of the array at p.
+func (p Path) Index(i int) Path {
+	return p + "[" + Path(strconv.Itoa(i)) + "]"
+}
+
+// Problem describes a single issue found in the configuration.
+type Problem struct {
+	Path    Path   `json:"path"`
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	return string(p.Path) + ": " + p.Message
+}
+
+// Problems is a list of issues found in the configuration.
+type Problems []Problem
+
+func (p Problems) Error() string {
+	msgs := make([]string, len(p))
+	for i := range p {
+		msgs[i] = p[i].String()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// PathError records an error together with the configuration path that caused it.
+type PathError struct {
+	Path Path
+	Err  error
+}
+
+func (e *PathError) Error() string {
+	return string(e.Path) + ": " + e.Err.Error()
+}
+
+func (e *PathError) Unwrap() error {
+	return e.Err
+}
+
+// ToProblems converts an error into Problems.
+// Joined errors are flattened and errors without a path are reported on the root.
+func ToProblems(err error) Problems {
+	if err == nil {
+		return nil
+	}
+
+	var problems Problems
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, err := range joined.Unwrap() {
+			problems = append(problems, ToProblems(err)...)
+		}
+		return problems
+	}
+
+	if errors.As(err, &problems) {
+		return problems
+	}
+
+	var pathErr *PathError
+	if errors.As(err, &pathErr) {
+		return Problems{{Path: pathErr.Path, Message: pathErr.Err.Error()}}
+	}
+	return Problems{{Path: RootPath, Message: err.Error()}}
+}
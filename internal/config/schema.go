@@ -0,0 +1,160 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+
+	"github.com/alx99/ika"
+	"github.com/alx99/ika/jsonschema"
+)
+
+// Schema returns the JSON Schema of the configuration.
+// The config of plugins created by factories implementing
+// [ika.ConfigSchemaProvider] is described by the schema they provide.
+func Schema(factories map[string]ika.PluginFactory) (*jsonschema.Schema, error) {
+	plugin, err := pluginSchema(factories)
+	if err != nil {
+		return nil, err
+	}
+
+	r := jsonschema.Reflector{Types: map[reflect.Type]*jsonschema.Schema{
+		reflect.TypeFor[Plugin](): {Ref: "#/$defs/plugin"},
+	}}
+
+	s := r.Reflect(Config{})
+	s.Schema = jsonschema.Draft
+	s.Title = "Ika configuration"
+	s.Required = []string{"servers"}
+	s.Defs = map[string]*jsonschema.Schema{"plugin": plugin}
+	return s, nil
+}
+
+// PluginConfigSchema returns the schema of the plugin config provided by the factory.
+// It returns nil if the factory does not provide one.
+func PluginConfigSchema(factory ika.PluginFactory) (*jsonschema.Schema, error) {
+	provider, ok := factory.(ika.ConfigSchemaProvider)
+	if !ok {
+		return nil, nil
+	}
+	s, err := jsonschema.FromMap(provider.ConfigSchema())
+	if err != nil {
+		return nil, fmt.Errorf("invalid config schema of plugin %q: %w", factory.Name(), err)
+	}
+	return s, nil
+}
+
+// ValidatePluginConfig validates the config of a plugin declared at path
+// against the schema provided by its factory. The returned error is of type [Problems].
+// Fields unknown to the plugin are ignored, see [UnknownFields].
+func ValidatePluginConfig(factory ika.PluginFactory, path Path, cfg map[string]any) error {
+	problems, err := pluginConfigProblems(factory, path, cfg)
+	if err != nil {
+		return err
+	}
+	if problems, _ = splitUnknown(problems); len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+// pluginConfigProblems returns every problem of the config of a plugin declared at path,
+// including the fields unknown to the plugin.
+func pluginConfigProblems(factory ika.PluginFactory, path Path, cfg map[string]any) (Problems, error) {
+	s, err := PluginConfigSchema(factory)
+	if err != nil || s == nil {
+		return nil, err
+	}
+
+	// Normalize the config into its JSON representation
+	var v any = map[string]any{}
+	if cfg != nil {
+		data, err := json.Marshal(cfg)
+		if err != nil {
+			return nil, &PathError{Path: path, Err: err}
+		}
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, &PathError{Path: path, Err: err}
+		}
+	}
+
+	var problems Problems
+	for _, e := range jsonschema.Validate(s, v) {
+		if e.Message == jsonschema.UnknownProperty {
+			e.Message = unknownField
+		}
+		p := path
+		for _, elem := range e.Path {
+			switch elem := elem.(type) {
+			case int:
+				p = p.Index(elem)
+			case string:
+				p = p.Field(elem)
+			}
+		}
+		problems = append(problems, Problem{Path: p, Message: e.Message})
+	}
+	return problems, nil
+}
+
+func pluginSchema(factories map[string]ika.PluginFactory) (*jsonschema.Schema, error) {
+	s := jsonschema.Reflect(Plugin{})
+	s.Required = []string{"name"}
+
+	for _, name := range slices.Sorted(maps.Keys(factories)) {
+		s.Properties["name"].Enum = append(s.Properties["name"].Enum, name)
+
+		cfgSchema, err := PluginConfigSchema(factories[name])
+		if err != nil {
+			return nil, err
+		}
+		if cfgSchema == nil {
+			continue
+		}
+
+		s.AllOf = append(s.AllOf, &jsonschema.Schema{
+			If: &jsonschema.Schema{
+				Properties: map[string]*jsonschema.Schema{"name": {Const: name}},
+			},
+			Then: &jsonschema.Schema{
+				Properties: map[string]*jsonschema.Schema{"config": cfgSchema},
+			},
+		})
+	}
+
+	return s, nil
+}
+
+func (*Duration) JSONSchema() *jsonschema.Schema {
+	return jsonschema.Duration()
+}
+
+func (*ErrorFormat) JSONSchema() *jsonschema.Schema {
+	s := &jsonschema.Schema{Type: "string"}
+	for _, format := range errorFormats {
+		s.Enum = append(s.Enum, string(format))
+	}
+	return s
+}
+
+func (*FileMode) JSONSchema() *jsonschema.Schema {
+	return &jsonschema.Schema{Type: "string", Pattern: `^0?[0-7]{3}$`}
+}
+
+func (*Method) JSONSchema() *jsonschema.Schema {
+	s := &jsonschema.Schema{Type: "string"}
+	for _, method := range validMethods {
+		s.Enum = append(s.Enum, method)
+	}
+	return s
+}
+
+func (*TLSVersion) JSONSchema() *jsonschema.Schema {
+	s := &jsonschema.Schema{Type: "string"}
+	for _, version := range slices.Sorted(maps.Keys(tlsVersions)) {
+		s.Enum = append(s.Enum, string(version))
+	}
+	return s
+}
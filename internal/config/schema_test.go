@@ -0,0 +1,70 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/alx99/ika"
+	"github.com/alx99/ika/jsonschema"
+	"github.com/matryer/is"
+)
+
+type schemaFactory struct{}
+
+func (schemaFactory) Name() string { return "schema-plugin" }
+
+func (schemaFactory) New(context.Context, ika.InjectionContext, map[string]any) (ika.Plugin, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (schemaFactory) ConfigSchema() map[string]any {
+	return map[string]any{
+		"type":                 "object",
+		"properties":           map[string]any{"limit": map[string]any{"type": "integer"}},
+		"additionalProperties": false,
+	}
+}
+
+func TestSchema_examples(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	s, err := Schema(nil)
+	is.NoErr(err)
+
+	examples, err := filepath.Glob("../../docs/example/configs/*.yaml")
+	is.NoErr(err)
+	is.True(len(examples) > 0) // examples exist
+
+	for _, example := range examples {
+		data, err := ReadFile(example)
+		is.NoErr(err)
+
+		var v any
+		is.NoErr(json.Unmarshal(data, &v))
+		is.Equal(jsonschema.Validate(s, v), nil) // example must satisfy the schema
+	}
+}
+
+func TestValidatePluginConfig(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	path := RootPath.Field("namespaces").Field("ns").Field("middlewares").Index(0).Field("config")
+
+	is.NoErr(ValidatePluginConfig(schemaFactory{}, path, map[string]any{"limit": 10}))
+
+	err := ValidatePluginConfig(schemaFactory{}, path, map[string]any{"limit": "10", "other": true})
+	var problems Problems
+	is.True(errors.As(err, &problems)) // error should be Problems
+	is.Equal(problems, Problems{
+		{Path: path.Field("limit"), Message: "expected integer, got string"},
+	}) // unknown fields are not problems of the plugin config
+
+	s, err := Schema(map[string]ika.PluginFactory{"schema-plugin": schemaFactory{}})
+	is.NoErr(err)
+	is.Equal(len(s.Defs["plugin"].AllOf), 1) // plugin config schema is embedded
+}
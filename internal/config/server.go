@@ -1,6 +1,21 @@
 package config
 
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
 type Server struct {
+	// Name identifies the server in the servers of a namespace, the address is used if it is empty.
+	Name string `json:"name"`
+	// Addr is the address to listen on: host:port for TCP, unix:/path/to.sock for a Unix domain socket,
+	// or systemd:name for a socket passed by systemd socket activation, selected by its FileDescriptorName or index.
 	Addr                         string   `json:"addr"`
 	DisableGeneralOptionsHandler bool     `json:"disableGeneralOptionsHandler"`
 	ReadTimeout                  Duration `json:"readTimeout"`
@@ -8,4 +23,91 @@ type Server struct {
 	WriteTimeout                 Duration `json:"writeTimeout"`
 	IdleTimeout                  Duration `json:"idleTimeout"`
 	MaxHeaderBytes               int      `json:"maxHeaderBytes"`
+	// SocketMode is the file mode of a Unix domain socket, such as "0660".
+	SocketMode    FileMode      `json:"socketMode"`
+	ProxyProtocol ProxyProtocol `json:"proxyProtocol"`
+	// Hooks run for every request the server receives, before it is routed.
+	Hooks Plugins `json:"hooks"`
+	// ReadinessPath is the path readiness probes are answered on, such as /readyz, before hooks run.
+	ReadinessPath string `json:"readinessPath"`
+}
+
+// ServerName returns the name namespaces refer to the server by.
+func (s Server) ServerName() string {
+	return cmp.Or(s.Name, s.Addr)
+}
+
+// ProxyProtocol configures the parsing of PROXY protocol headers sent by load balancers,
+// which carry the address of the client the balancer accepted the connection from.
+type ProxyProtocol struct {
+	// TrustedSources are the IP addresses and CIDR ranges of the balancers allowed to send headers.
+	TrustedSources []string `json:"trustedSources"`
+	// TrustUnixPeers allows every peer connecting over a Unix domain socket to send headers.
+	// Unix domain sockets have no peer address to check TrustedSources against,
+	// so access to them must be restricted by their file mode instead.
+	TrustUnixPeers bool `json:"trustUnixPeers"`
+	// HeaderTimeout is how long to wait for the header once a connection is accepted, 5s by default.
+	HeaderTimeout Duration `json:"headerTimeout"`
+}
+
+// Enabled reports whether PROXY protocol headers are accepted from any source.
+func (p ProxyProtocol) Enabled() bool {
+	return len(p.TrustedSources) > 0 || p.TrustUnixPeers
+}
+
+// FileMode is a file mode written in octal, such as "0660".
+type FileMode string
+
+func (m *FileMode) UnmarshalJSON(data []byte) error {
+	var tmp string
+	if err := json.Unmarshal(data, &tmp); err != nil {
+		return err
+	}
+
+	if _, err := strconv.ParseUint(tmp, 8, 32); err != nil {
+		return fmt.Errorf("invalid file mode: %s", tmp)
+	}
+
+	*m = FileMode(tmp)
+	return nil
+}
+
+// Mode returns the file mode, or 0 if it is unset.
+func (m FileMode) Mode() fs.FileMode {
+	mode, _ := strconv.ParseUint(string(m), 8, 32)
+	return fs.FileMode(mode) & fs.ModePerm
+}
+
+// checkServers reports servers sharing a name, invalid readiness paths
+// and namespaces referring to servers that do not exist.
+func checkServers(cfg Config) Problems {
+	var problems Problems
+	names := make(map[string]bool, len(cfg.Servers))
+	for i, s := range cfg.Servers {
+		if s.ReadinessPath != "" && !strings.HasPrefix(s.ReadinessPath, "/") {
+			problems = append(problems, Problem{
+				Path:    RootPath.Field("servers").Index(i).Field("readinessPath"),
+				Message: fmt.Sprintf("readiness path %q must start with /", s.ReadinessPath),
+			})
+		}
+		if names[s.ServerName()] {
+			problems = append(problems, Problem{
+				Path:    RootPath.Field("servers").Index(i).Field("name"),
+				Message: fmt.Sprintf("duplicate server name %q", s.ServerName()),
+			})
+		}
+		names[s.ServerName()] = true
+	}
+
+	for _, nsName := range slices.Sorted(maps.Keys(cfg.Namespaces)) {
+		for i, name := range cfg.Namespaces[nsName].Servers {
+			if !names[name] {
+				problems = append(problems, Problem{
+					Path:    RootPath.Field("namespaces").Field(nsName).Field("servers").Index(i),
+					Message: fmt.Sprintf("unknown server %q", name),
+				})
+			}
+		}
+	}
+	return problems
 }
@@ -0,0 +1,157 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/alx99/ika"
+	"sigs.k8s.io/yaml"
+)
+
+// maxRemoteConfigSize limits the size of configurations fetched over HTTP.
+const maxRemoteConfigSize = 16 << 20
+
+// OpenSource returns the source of the configuration at uri.
+// uri is either a path to a local file, a file:// or http(s):// URL,
+// or a URL whose scheme has a factory registered in factories.
+func OpenSource(uri string, factories map[string]ika.ConfigSourceFactory) (ika.ConfigSource, error) {
+	u, err := url.Parse(uri)
+	// single letter schemes are Windows drive letters
+	if err != nil || len(u.Scheme) <= 1 {
+		return &fileSource{path: uri}, nil
+	}
+
+	if factory, ok := factories[u.Scheme]; ok {
+		return factory(u)
+	}
+
+	switch u.Scheme {
+	case "file":
+		return &fileSource{path: u.Path}, nil
+	case "http", "https":
+		return &httpSource{url: u.String(), client: &http.Client{Timeout: 30 * time.Second}}, nil
+	}
+	return nil, fmt.Errorf("unsupported configuration source %q", u.Scheme)
+}
+
+// IsLocal reports whether src reads the configuration from a local file.
+func IsLocal(src ika.ConfigSource) bool {
+	_, ok := src.(*fileSource)
+	return ok
+}
+
+// Load loads the configuration from src.
+// Besides the configuration, it returns its JSON encoding.
+// If the source reports that the configuration is unchanged, [ika.ErrConfigUnchanged] is returned.
+func Load(ctx context.Context, src ika.ConfigSource) (Config, []byte, error) {
+	data, err := src.Load(ctx)
+	if err != nil {
+		return Config{}, nil, err
+	}
+
+	// JSON is valid YAML, this accepts both
+	data, err = yaml.YAMLToJSONStrict(data)
+	if err != nil {
+		return Config{}, nil, Problems{{Path: RootPath, Message: err.Error()}}
+	}
+
+	cfg, err := Parse(data)
+	return cfg, data, err
+}
+
+// changeDetector remembers the checksum of the last committed configuration.
+type changeDetector struct {
+	sum       [sha256.Size]byte
+	pending   [sha256.Size]byte
+	committed bool
+}
+
+// changed reports whether data differs from the committed configuration.
+func (d *changeDetector) changed(data []byte) bool {
+	d.pending = sha256.Sum256(data)
+	return !d.committed || d.pending != d.sum
+}
+
+// Commit remembers the checksum of the configuration passed to changed last.
+func (d *changeDetector) Commit() {
+	d.sum, d.committed = d.pending, true
+}
+
+type fileSource struct {
+	path string
+	changeDetector
+}
+
+func (s *fileSource) Load(context.Context) ([]byte, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	if !s.changed(data) {
+		return nil, ika.ErrConfigUnchanged
+	}
+	return data, nil
+}
+
+// httpSource fetches the configuration over HTTP.
+// Conditional requests are made using the ETag of the committed configuration.
+type httpSource struct {
+	url    string
+	client *http.Client
+	etag   string
+	// pendingETag is the ETag of the last response, which becomes etag once committed
+	pendingETag string
+	changeDetector
+}
+
+func (s *httpSource) Load(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/yaml, application/json;q=0.9, */*;q=0.8")
+	if s.etag != "" {
+		req.Header.Set("If-None-Match", s.etag)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil, ika.ErrConfigUnchanged
+	default:
+		return nil, fmt.Errorf("GET %s: unexpected status %s", s.url, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteConfigSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("GET %s: %w", s.url, err)
+	}
+	if len(data) > maxRemoteConfigSize {
+		return nil, fmt.Errorf("GET %s: configuration exceeds %d bytes", s.url, maxRemoteConfigSize)
+	}
+
+	s.pendingETag = resp.Header.Get("ETag")
+	// servers that do not send an ETag may still serve the same configuration
+	if !s.changed(data) {
+		s.etag = s.pendingETag // the committed configuration under a new ETag
+		return nil, ika.ErrConfigUnchanged
+	}
+	return data, nil
+}
+
+func (s *httpSource) Commit() {
+	s.etag = s.pendingETag
+	s.changeDetector.Commit()
+}
@@ -0,0 +1,152 @@
+package config
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alx99/ika"
+	"github.com/matryer/is"
+)
+
+const testConfig = "servers:\n  - addr: :8080\n"
+
+func TestOpenSource(t *testing.T) {
+	t.Parallel()
+
+	custom := &fileSource{path: "custom"}
+	factories := map[string]ika.ConfigSourceFactory{
+		"custom": func(*url.URL) (ika.ConfigSource, error) { return custom, nil },
+	}
+
+	tests := []struct {
+		uri     string
+		want    ika.ConfigSource
+		wantErr bool
+	}{
+		{uri: "ika.yaml", want: &fileSource{path: "ika.yaml"}},
+		{uri: "/etc/ika/ika.yaml", want: &fileSource{path: "/etc/ika/ika.yaml"}},
+		{uri: `C:\ika\ika.yaml`, want: &fileSource{path: `C:\ika\ika.yaml`}},
+		{uri: "file:///etc/ika.yaml", want: &fileSource{path: "/etc/ika.yaml"}},
+		{uri: "custom://config", want: custom},
+		{uri: "ftp://config", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			t.Parallel()
+			is := is.New(t)
+
+			src, err := OpenSource(tt.uri, factories)
+			if tt.wantErr {
+				is.True(err != nil) // expected an error
+				return
+			}
+			is.NoErr(err)
+			is.Equal(src, tt.want) // unexpected source
+		})
+	}
+}
+
+func TestIsLocal(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	src, err := OpenSource("ika.yaml", nil)
+	is.NoErr(err)
+	is.True(IsLocal(src)) // paths are local
+
+	src, err = OpenSource("https://example.com/ika.yaml", nil)
+	is.NoErr(err)
+	is.True(!IsLocal(src)) // http sources are remote
+}
+
+func TestFileSource(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	path := filepath.Join(t.TempDir(), "ika.yaml")
+	is.NoErr(os.WriteFile(path, []byte(testConfig), 0o600))
+
+	src, err := OpenSource(path, nil)
+	is.NoErr(err)
+
+	cfg, data, err := Load(t.Context(), src)
+	is.NoErr(err)
+	is.Equal(cfg.Servers[0].Addr, ":8080")
+	is.Equal(string(data), `{"servers":[{"addr":":8080"}]}`) // data is converted to JSON
+
+	_, _, err = Load(t.Context(), src)
+	is.NoErr(err) // configuration was not committed
+
+	src.(ika.ConfigCommitter).Commit()
+	_, _, err = Load(t.Context(), src)
+	is.True(errors.Is(err, ika.ErrConfigUnchanged)) // file was not modified
+
+	is.NoErr(os.WriteFile(path, []byte(testConfig+"namespaces: {}\n"), 0o600))
+	_, _, err = Load(t.Context(), src)
+	is.NoErr(err) // file was modified
+}
+
+func TestHTTPSource(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	body := testConfig
+	etag := `"1"`
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	src, err := OpenSource(srv.URL, nil)
+	is.NoErr(err)
+
+	cfg, _, err := Load(t.Context(), src)
+	is.NoErr(err)
+	is.Equal(cfg.Servers[0].Addr, ":8080")
+	src.(ika.ConfigCommitter).Commit()
+
+	_, _, err = Load(t.Context(), src)
+	is.True(errors.Is(err, ika.ErrConfigUnchanged)) // server replied 304
+
+	body, etag = testConfig+"namespaces: {}\n", `"2"`
+	_, _, err = Load(t.Context(), src)
+	is.NoErr(err) // new ETag
+	_, _, err = Load(t.Context(), src)
+	is.NoErr(err) // configuration was not committed, so the old ETag is sent
+	is.Equal(requests, 4)
+	src.(ika.ConfigCommitter).Commit()
+
+	// same content without an ETag is reported as unchanged
+	etag = ""
+	_, _, err = Load(t.Context(), src)
+	is.True(errors.Is(err, ika.ErrConfigUnchanged))
+}
+
+func TestCache(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	path := filepath.Join(t.TempDir(), "cache", "config.json")
+	is.NoErr(WriteCache(path, []byte(`{"servers":[{"addr":":8080"}]}`)))
+
+	info, err := os.Stat(path)
+	is.NoErr(err)
+	is.Equal(info.Mode().Perm(), os.FileMode(0o600)) // cache may contain credentials
+
+	cfg, err := ReadCache(path)
+	is.NoErr(err)
+	is.Equal(cfg.Servers[0].Addr, ":8080")
+}
@@ -13,6 +13,46 @@ type Transport struct {
 	WriteBufferSize        int      `json:"writeBufferSize"`
 	ReadBufferSize         int      `json:"readBufferSize"`
 	Dialer                 Dialer   `json:"dialer"`
+	TLS                    TLS      `json:"tls"`
+	Proxy                  Proxy    `json:"proxy"`
+	Resolver               Resolver `json:"resolver"`
+}
+
+// Proxy configures an outbound proxy that connections to upstreams are made through.
+type Proxy struct {
+	// URL is the address of the proxy, the schemes http, https and socks5 are supported.
+	URL string `json:"url"`
+	// NoProxy lists the upstreams that are connected to directly.
+	// Entries are host names, which also match their subdomains, IP addresses or CIDR ranges,
+	// optionally followed by a port. A leading dot only matches subdomains and "*" matches everything.
+	NoProxy []string `json:"noProxy"`
+}
+
+// Resolver configures how the host names of upstreams are resolved.
+type Resolver struct {
+	// Servers are the DNS servers to query instead of the ones of the system, as host or host:port.
+	Servers []string `json:"servers"`
+	// Hosts maps host names to the addresses they resolve to, taking precedence over DNS.
+	Hosts map[string][]string `json:"hosts"`
+	// CacheTTL is how long resolved addresses are reused. Zero disables caching.
+	CacheTTL Duration `json:"cacheTTL"`
+}
+
+// TLS configures the TLS connections to upstreams.
+// Certificate files are reloaded when they change.
+type TLS struct {
+	// CAFile is a PEM bundle of the certificate authorities trusted to sign upstream certificates.
+	// The system certificate pool is used if it is unset.
+	CAFile string `json:"caFile"`
+	// CertFile and KeyFile are the PEM encoded client certificate and key presented to upstreams.
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+	// ServerName overrides the name used to verify upstream certificates and sent with SNI.
+	ServerName string `json:"serverName"`
+	// MinVersion is the minimum TLS version, 1.2 by default.
+	MinVersion TLSVersion `json:"minVersion"`
+	// InsecureSkipVerify disables the verification of upstream certificates.
+	InsecureSkipVerify bool `json:"insecureSkipVerify"`
 }
 
 type Dialer struct {
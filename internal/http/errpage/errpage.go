@@ -0,0 +1,275 @@
+// Package errpage writes the error responses of namespaces and routes as configured by config.ErrorPages.
+package errpage
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"log/slog"
+	"maps"
+	"mime"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/alx99/ika"
+	"github.com/alx99/ika/internal/config"
+	"github.com/alx99/ika/request"
+)
+
+const (
+	defaultContentType     = "text/html; charset=utf-8"
+	defaultRequestIDHeader = "X-Request-ID"
+)
+
+// Data is the data available to the templates of error pages.
+type Data struct {
+	Status    int
+	Title     string
+	Detail    string
+	Type      string
+	RequestID string
+	Method    string
+	Path      string
+}
+
+// Pages writes error responses.
+type Pages struct {
+	format          config.ErrorFormat
+	hideDetail      bool
+	requestIDHeader string
+	// pages are ordered from the most to the least specific status range
+	pages []page
+}
+
+type page struct {
+	from, to    int
+	contentType string
+	tmpl        interface {
+		Execute(w io.Writer, data any) error
+	}
+}
+
+// Merge returns the settings of ns overridden by the ones set in route.
+func Merge(ns, route config.ErrorPages) config.ErrorPages {
+	merged := config.ErrorPages{
+		Format:          cmp.Or(route.Format, ns.Format),
+		HideDetail:      cmp.Or(route.HideDetail, ns.HideDetail),
+		RequestIDHeader: cmp.Or(route.RequestIDHeader, ns.RequestIDHeader),
+	}
+	if len(ns.Pages)+len(route.Pages) > 0 {
+		merged.Pages = maps.Clone(ns.Pages)
+		if merged.Pages == nil {
+			merged.Pages = make(map[string]config.ErrorPage, len(route.Pages))
+		}
+		maps.Copy(merged.Pages, route.Pages)
+	}
+	return merged
+}
+
+// New returns the error pages configured by cfg at path.
+// It returns nil if cfg does not change the default error responses.
+func New(path config.Path, cfg config.ErrorPages) (*Pages, error) {
+	if cfg.IsZero() {
+		return nil, nil
+	}
+
+	p := &Pages{
+		format:          cmp.Or(cfg.Format, config.ErrorFormatLegacy),
+		hideDetail:      cfg.HideDetail != nil && *cfg.HideDetail,
+		requestIDHeader: cmp.Or(cfg.RequestIDHeader, defaultRequestIDHeader),
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(cfg.Pages)) {
+		path := path.Field("pages").Field(key)
+		pg, err := newPage(key, cfg.Pages[key])
+		if err != nil {
+			return nil, &config.PathError{Path: path, Err: err}
+		}
+		p.pages = append(p.pages, pg)
+	}
+	slices.SortStableFunc(p.pages, func(a, b page) int {
+		return cmp.Compare(a.to-a.from, b.to-b.from)
+	})
+
+	return p, nil
+}
+
+func newPage(key string, cfg config.ErrorPage) (page, error) {
+	from, to, err := parseStatusRange(key)
+	if err != nil {
+		return page{}, err
+	}
+
+	if (cfg.Body == "") == (cfg.File == "") {
+		return page{}, errors.New("exactly one of body and file must be set")
+	}
+	body := cfg.Body
+	if cfg.File != "" {
+		b, err := os.ReadFile(cfg.File)
+		if err != nil {
+			return page{}, err
+		}
+		body = string(b)
+	}
+
+	pg := page{from: from, to: to, contentType: cmp.Or(cfg.ContentType, defaultContentType)}
+	mediaType, _, err := mime.ParseMediaType(pg.contentType)
+	if err != nil {
+		return page{}, fmt.Errorf("invalid content type %q: %w", pg.contentType, err)
+	}
+	if strings.HasSuffix(mediaType, "html") {
+		pg.tmpl, err = htmltemplate.New(key).Option("missingkey=error").Parse(body)
+	} else {
+		pg.tmpl, err = texttemplate.New(key).Option("missingkey=error").Parse(body)
+	}
+	if err != nil {
+		return page{}, err
+	}
+	return pg, nil
+}
+
+// parseStatusRange parses a status code such as "404", or a range such as "5xx" or "500-504".
+func parseStatusRange(key string) (int, int, error) {
+	invalid := fmt.Errorf("invalid status %q, expected a code such as 404 or a range such as 5xx or 500-504", key)
+
+	var from, to int
+	switch {
+	case len(key) == 3 && strings.HasSuffix(strings.ToLower(key), "xx"):
+		class, err := strconv.Atoi(key[:1])
+		if err != nil {
+			return 0, 0, invalid
+		}
+		from, to = class*100, class*100+99
+	case strings.Contains(key, "-"):
+		a, b, _ := strings.Cut(key, "-")
+		var errA, errB error
+		from, errA = strconv.Atoi(strings.TrimSpace(a))
+		to, errB = strconv.Atoi(strings.TrimSpace(b))
+		if errA != nil || errB != nil {
+			return 0, 0, invalid
+		}
+	default:
+		code, err := strconv.Atoi(key)
+		if err != nil {
+			return 0, 0, invalid
+		}
+		from, to = code, code
+	}
+
+	if from < 100 || to > 599 || from > to {
+		return 0, 0, invalid
+	}
+	return from, to, nil
+}
+
+// Handler returns an error handler writing error responses as configured.
+// Errors written in the legacy format are passed to next, with the detail removed if it is hidden.
+func (p *Pages) Handler(log *slog.Logger, next ika.ErrorHandler) ika.ErrorHandler {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		data := p.data(w, r, err)
+
+		for _, pg := range p.pages {
+			if data.Status < pg.from || data.Status > pg.to {
+				continue
+			}
+			var body bytes.Buffer
+			if err := pg.tmpl.Execute(&body, data); err != nil {
+				log.LogAttrs(r.Context(), slog.LevelError, "Error rendering error page", slog.String("error", err.Error()))
+				break
+			}
+			writeBody(log, w, r, data.Status, pg.contentType, body.Bytes())
+			return
+		}
+
+		switch p.format {
+		case config.ErrorFormatProblem:
+			writeProblem(log, w, r, data)
+		default:
+			next(w, r, &problemError{data: data, err: err})
+		}
+	}
+}
+
+func (p *Pages) data(w http.ResponseWriter, r *http.Request, err error) Data {
+	data := Data{
+		Status:    http.StatusInternalServerError,
+		RequestID: cmp.Or(r.Header.Get(p.requestIDHeader), w.Header().Get(p.requestIDHeader)),
+		Method:    r.Method,
+		Path:      request.GetPath(r),
+	}
+
+	if err, ok := err.(interface{ Status() int }); ok {
+		data.Status = cmp.Or(err.Status(), data.Status)
+	}
+	if err, ok := err.(interface{ TypeURI() string }); ok {
+		data.Type = err.TypeURI()
+	}
+	if err, ok := err.(interface{ Title() string }); ok {
+		data.Title = err.Title()
+	}
+	if err, ok := err.(interface{ Detail() string }); ok {
+		data.Detail = err.Detail()
+	}
+	data.Title = cmp.Or(data.Title, http.StatusText(data.Status))
+
+	if p.hideDetail && data.Status >= 500 {
+		data.Detail = ""
+	}
+	return data
+}
+
+// writeProblem writes data as an RFC 7807 problem details object.
+func writeProblem(log *slog.Logger, w http.ResponseWriter, r *http.Request, data Data) {
+	body, err := json.Marshal(struct {
+		Type      string `json:"type"`
+		Title     string `json:"title"`
+		Status    int    `json:"status"`
+		Detail    string `json:"detail,omitzero"`
+		Instance  string `json:"instance,omitzero"`
+		RequestID string `json:"requestId,omitzero"`
+	}{
+		Type:      cmp.Or(data.Type, "about:blank"),
+		Title:     data.Title,
+		Status:    data.Status,
+		Detail:    data.Detail,
+		Instance:  data.Path,
+		RequestID: data.RequestID,
+	})
+	if err != nil {
+		log.LogAttrs(r.Context(), slog.LevelError, "Error encoding error response", slog.String("error", err.Error()))
+		return
+	}
+	writeBody(log, w, r, data.Status, "application/problem+json", append(body, '\n'))
+}
+
+func writeBody(log *slog.Logger, w http.ResponseWriter, r *http.Request, status int, contentType string, body []byte) {
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", contentType)
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	if _, err := w.Write(body); err != nil {
+		log.LogAttrs(r.Context(), slog.LevelError, "Error writing error response", slog.String("error", err.Error()))
+	}
+}
+
+// problemError passes the data of an error response to the next error handler.
+type problemError struct {
+	data Data
+	err  error
+}
+
+func (e *problemError) Error() string   { return e.err.Error() }
+func (e *problemError) Unwrap() error   { return e.err }
+func (e *problemError) Status() int     { return e.data.Status }
+func (e *problemError) TypeURI() string { return e.data.Type }
+func (e *problemError) Title() string   { return e.data.Title }
+func (e *problemError) Detail() string  { return e.data.Detail }
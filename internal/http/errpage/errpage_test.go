@@ -0,0 +1,204 @@
+package errpage
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alx99/ika"
+	"github.com/alx99/ika/internal/config"
+	"github.com/matryer/is"
+)
+
+type httpError struct {
+	status int
+	detail string
+}
+
+func (e httpError) Error() string  { return e.detail }
+func (e httpError) Status() int    { return e.status }
+func (e httpError) Detail() string { return e.detail }
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	file := filepath.Join(t.TempDir(), "404.html")
+	if err := os.WriteFile(file, []byte("<h1>{{.Title}}</h1>"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		cfg     config.ErrorPages
+		wantNil bool
+		wantErr string
+	}{
+		{name: "empty", wantNil: true},
+		{name: "code", cfg: config.ErrorPages{Pages: map[string]config.ErrorPage{"404": {Body: "x"}}}},
+		{name: "class", cfg: config.ErrorPages{Pages: map[string]config.ErrorPage{"5XX": {Body: "x"}}}},
+		{name: "range", cfg: config.ErrorPages{Pages: map[string]config.ErrorPage{"500-504": {Body: "x"}}}},
+		{name: "file", cfg: config.ErrorPages{Pages: map[string]config.ErrorPage{"404": {File: file}}}},
+		{
+			name:    "invalid status",
+			cfg:     config.ErrorPages{Pages: map[string]config.ErrorPage{"600": {Body: "x"}}},
+			wantErr: `$.errorPages.pages['600']: invalid status "600", expected a code such as 404 or a range such as 5xx or 500-504`,
+		},
+		{
+			name:    "inverted range",
+			cfg:     config.ErrorPages{Pages: map[string]config.ErrorPage{"504-500": {Body: "x"}}},
+			wantErr: `$.errorPages.pages['504-500']: invalid status "504-500", expected a code such as 404 or a range such as 5xx or 500-504`,
+		},
+		{
+			name:    "body and file",
+			cfg:     config.ErrorPages{Pages: map[string]config.ErrorPage{"404": {Body: "x", File: file}}},
+			wantErr: "$.errorPages.pages['404']: exactly one of body and file must be set",
+		},
+		{
+			name:    "invalid template",
+			cfg:     config.ErrorPages{Pages: map[string]config.ErrorPage{"404": {Body: "{{.Status"}}},
+			wantErr: `$.errorPages.pages['404']: template: 404:1: unclosed action`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			is := is.New(t)
+
+			p, err := New(config.RootPath.Field("errorPages"), tt.cfg)
+			if tt.wantErr != "" {
+				is.True(err != nil) // expected an error
+				is.Equal(err.Error(), tt.wantErr)
+				return
+			}
+			is.NoErr(err)
+			is.Equal(p == nil, tt.wantNil)
+		})
+	}
+}
+
+func TestPages_Write(t *testing.T) {
+	t.Parallel()
+
+	hide := true
+	pages := map[string]config.ErrorPage{
+		"5xx":     {Body: "<p>{{.Status}} {{.Title}}: {{.Detail}} ({{.RequestID}})</p>"},
+		"502":     {ContentType: "text/plain", Body: "{{.Method}} {{.Path}}: {{.Detail}}"},
+		"400-404": {ContentType: "application/json", Body: `{"error":"{{.Title}}"}`},
+	}
+
+	tests := []struct {
+		name            string
+		cfg             config.ErrorPages
+		err             error
+		wantStatus      int
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:            "exact code wins over range",
+			cfg:             config.ErrorPages{Pages: pages},
+			err:             httpError{http.StatusBadGateway, "<refused>"},
+			wantStatus:      http.StatusBadGateway,
+			wantContentType: "text/plain",
+			wantBody:        "GET /api: <refused>",
+		},
+		{
+			name:            "html is escaped",
+			cfg:             config.ErrorPages{Pages: pages},
+			err:             httpError{http.StatusServiceUnavailable, "<down>"},
+			wantStatus:      http.StatusServiceUnavailable,
+			wantContentType: "text/html; charset=utf-8",
+			wantBody:        "<p>503 Service Unavailable: &lt;down&gt; (req-1)</p>",
+		},
+		{
+			name:            "detail hidden",
+			cfg:             config.ErrorPages{HideDetail: &hide, Pages: pages},
+			err:             httpError{http.StatusServiceUnavailable, "<down>"},
+			wantStatus:      http.StatusServiceUnavailable,
+			wantContentType: "text/html; charset=utf-8",
+			wantBody:        "<p>503 Service Unavailable:  (req-1)</p>",
+		},
+		{
+			name:            "range",
+			cfg:             config.ErrorPages{Pages: pages},
+			err:             httpError{status: http.StatusForbidden},
+			wantStatus:      http.StatusForbidden,
+			wantContentType: "application/json",
+			wantBody:        `{"error":"Forbidden"}`,
+		},
+		{
+			name:            "problem",
+			cfg:             config.ErrorPages{Format: config.ErrorFormatProblem, Pages: pages},
+			err:             httpError{http.StatusTooManyRequests, "slow down"},
+			wantStatus:      http.StatusTooManyRequests,
+			wantContentType: "application/problem+json",
+			wantBody:        `{"type":"about:blank","title":"Too Many Requests","status":429,"detail":"slow down","instance":"/api","requestId":"req-1"}` + "\n",
+		},
+		{
+			name:            "problem without detail",
+			cfg:             config.ErrorPages{Format: config.ErrorFormatProblem, HideDetail: &hide},
+			err:             errors.New("boom"),
+			wantStatus:      http.StatusInternalServerError,
+			wantContentType: "application/problem+json",
+			wantBody:        `{"type":"about:blank","title":"Internal Server Error","status":500,"instance":"/api","requestId":"req-1"}` + "\n",
+		},
+		{
+			name:       "legacy",
+			cfg:        config.ErrorPages{HideDetail: &hide},
+			err:        httpError{http.StatusBadGateway, "dial tcp 10.0.0.1:80"},
+			wantStatus: http.StatusBadGateway,
+			wantBody:   "Bad Gateway", // the status text replaces the hidden detail
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			is := is.New(t)
+
+			p, err := New(config.RootPath, tt.cfg)
+			is.NoErr(err)
+
+			req := httptest.NewRequest(http.MethodGet, "/api", nil)
+			req.Header.Set("X-Request-ID", "req-1")
+			rec := httptest.NewRecorder()
+			p.Handler(slog.New(slog.DiscardHandler), ika.DefaultErrorHandler)(rec, req, tt.err)
+
+			is.Equal(rec.Code, tt.wantStatus)
+			if tt.wantContentType != "" {
+				is.Equal(rec.Header().Get("Content-Type"), tt.wantContentType)
+			}
+			is.Equal(rec.Body.String(), tt.wantBody)
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	hide := true
+	ns := config.ErrorPages{
+		Format:     config.ErrorFormatProblem,
+		HideDetail: &hide,
+		Pages:      map[string]config.ErrorPage{"404": {Body: "ns"}, "5xx": {Body: "ns"}},
+	}
+	route := config.ErrorPages{
+		RequestIDHeader: "X-Trace-ID",
+		Pages:           map[string]config.ErrorPage{"5xx": {Body: "route"}},
+	}
+
+	is.Equal(Merge(ns, route), config.ErrorPages{
+		Format:          config.ErrorFormatProblem,
+		HideDetail:      &hide,
+		RequestIDHeader: "X-Trace-ID",
+		Pages:           map[string]config.ErrorPage{"404": {Body: "ns"}, "5xx": {Body: "route"}},
+	})
+	is.Equal(len(ns.Pages), 2) // the namespace is not modified
+	is.Equal(ns.Pages["5xx"].Body, "ns")
+}
@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"syscall"
+)
+
+// StatusClientClosedRequest is the status of requests whose client went away before
+// the response was written, as logged by nginx.
+const StatusClientClosedRequest = 499
+
+// typeURIBase is the page the types of proxy errors are documented on.
+const typeURIBase = "https://ika.dozy.dev/guide/errors#"
+
+// Error is a failed upstream request, classified by its cause.
+// Error handlers treat it like httperr.Error.
+type Error struct {
+	class errorClass
+	err   error
+}
+
+type errorClass struct {
+	name   string
+	status int
+	title  string
+	detail string
+}
+
+var (
+	classClientClosed = errorClass{"client-closed", StatusClientClosedRequest, "Client Closed Request", "The client closed the connection before the upstream responded."}
+	classTimeout      = errorClass{"upstream-timeout", http.StatusGatewayTimeout, "Upstream Timeout", "The upstream did not respond in time."}
+	classDNS          = errorClass{"upstream-dns", http.StatusBadGateway, "Upstream Name Resolution Failed", "The address of the upstream could not be resolved."}
+	classRefused      = errorClass{"upstream-refused", http.StatusServiceUnavailable, "Upstream Unavailable", "The upstream refused the connection."}
+	classTLS          = errorClass{"upstream-tls", http.StatusBadGateway, "Upstream TLS Handshake Failed", "A secure connection to the upstream could not be established."}
+	classUpstream     = errorClass{"upstream-error", http.StatusBadGateway, "Bad Gateway", "The upstream request failed."}
+)
+
+// classify returns err as an Error, r is the incoming request.
+func classify(r *http.Request, err error) *Error {
+	e := &Error{err: err}
+
+	var (
+		dnsErr     *net.DNSError
+		netErr     net.Error
+		verifyErr  *tls.CertificateVerificationError
+		recordErr  tls.RecordHeaderError
+		alertErr   tls.AlertError
+		unknownCA  x509.UnknownAuthorityError
+		hostErr    x509.HostnameError
+		invalidErr x509.CertificateInvalidError
+	)
+	switch {
+	case errors.Is(r.Context().Err(), context.Canceled):
+		e.class = classClientClosed
+	case errors.As(err, &dnsErr):
+		e.class = classDNS
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		e.class = classTimeout
+	case errors.As(err, &verifyErr), errors.As(err, &recordErr), errors.As(err, &alertErr),
+		errors.As(err, &unknownCA), errors.As(err, &hostErr), errors.As(err, &invalidErr):
+		e.class = classTLS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		e.class = classRefused
+	default:
+		e.class = classUpstream
+	}
+	return e
+}
+
+// Class names the cause of the error, such as "upstream-timeout".
+func (e *Error) Class() string { return e.class.name }
+
+// ClientClosed reports whether the request failed because the client went away.
+func (e *Error) ClientClosed() bool { return e.class == classClientClosed }
+
+func (e *Error) Error() string   { return e.class.name + ": " + e.err.Error() }
+func (e *Error) Unwrap() error   { return e.err }
+func (e *Error) Status() int     { return e.class.status }
+func (e *Error) TypeURI() string { return typeURIBase + e.class.name }
+func (e *Error) Title() string   { return e.class.title }
+func (e *Error) Detail() string  { return e.class.detail }
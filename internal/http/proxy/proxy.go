@@ -9,7 +9,7 @@ import (
 	"strings"
 
 	"github.com/alx99/ika"
-	"github.com/alx99/ika/internal/http/request"
+	"github.com/alx99/ika/request"
 )
 
 type Config struct {
@@ -19,7 +19,8 @@ type Config struct {
 }
 
 type Proxy struct {
-	rp httputil.ReverseProxy
+	rp        httputil.ReverseProxy
+	streaming Streaming
 }
 
 type keyErr struct{}
@@ -30,8 +31,10 @@ func NewProxy(log *slog.Logger, cfg Config) (*Proxy, error) {
 		Transport:  cfg.Transport,
 		ErrorLog:   stdlog.New(slogIOWriter{log: log}, "httputil.ReverseProxy ", stdlog.LstdFlags),
 		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
-			newReq := r.WithContext(context.WithValue(r.Context(), keyErr{}, err))
-			*r = *newReq
+			// r may be the outgoing request, whose context is derived from the one of the incoming request
+			if slot, ok := r.Context().Value(keyErr{}).(*error); ok {
+				*slot = err
+			}
 		},
 
 		Rewrite: func(rp *httputil.ProxyRequest) {
@@ -45,18 +48,25 @@ func NewProxy(log *slog.Logger, cfg Config) (*Proxy, error) {
 
 func (p *Proxy) WithPathTrim(trim string) ika.HandlerFunc {
 	return ika.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
-		r.URL.Path = strings.TrimPrefix(r.URL.Path, trim)
-		r.URL.RawPath = strings.TrimPrefix(request.GetPath(r), trim)
+		TrimPath(r, trim)
 		return p.ServeHTTP(w, r)
 	})
 }
 
-func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
-	p.rp.ServeHTTP(w, r)
+// TrimPath removes the prefix trim from the path of the request URL.
+func TrimPath(r *http.Request, trim string) {
+	r.URL.Path = strings.TrimPrefix(r.URL.Path, trim)
+	r.URL.RawPath = strings.TrimPrefix(request.GetPath(r), trim)
+}
 
-	err := r.Context().Value(keyErr{})
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	if p.streaming.DisableWriteTimeout {
+		liftWriteDeadline(r.Context())
+	}
+	var err error
+	p.rp.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), keyErr{}, &err)))
 	if err != nil {
-		return err.(error)
+		return classify(r, err)
 	}
 	return nil
 }
@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+type failingTransport struct{ err error }
+
+func (t failingTransport) RoundTrip(*http.Request) (*http.Response, error) { return nil, t.err }
+
+func TestProxy_ServeHTTP_error(t *testing.T) {
+	t.Parallel()
+
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: &os.SyscallError{Syscall: "connect", Err: syscall.ECONNREFUSED}}
+
+	tests := []struct {
+		name       string
+		err        error
+		cancel     bool
+		wantClass  string
+		wantStatus int
+	}{
+		{name: "refused", err: refused, wantClass: "upstream-refused", wantStatus: http.StatusServiceUnavailable},
+		{name: "dns", err: &net.DNSError{Err: "no such host", Name: "api.internal", IsNotFound: true}, wantClass: "upstream-dns", wantStatus: http.StatusBadGateway},
+		{name: "deadline", err: context.DeadlineExceeded, wantClass: "upstream-timeout", wantStatus: http.StatusGatewayTimeout},
+		{name: "io timeout", err: &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}, wantClass: "upstream-timeout", wantStatus: http.StatusGatewayTimeout},
+		{name: "tls", err: &tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}, wantClass: "upstream-tls", wantStatus: http.StatusBadGateway},
+		{name: "other", err: io.ErrUnexpectedEOF, wantClass: "upstream-error", wantStatus: http.StatusBadGateway},
+		{name: "client closed", err: context.Canceled, cancel: true, wantClass: "client-closed", wantStatus: StatusClientClosedRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			is := is.New(t)
+
+			p, err := NewProxy(slog.New(slog.DiscardHandler), Config{Transport: failingTransport{err: tt.err}})
+			is.NoErr(err)
+
+			ctx, cancel := context.WithCancel(t.Context())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+			req := httptest.NewRequestWithContext(ctx, http.MethodGet, "http://upstream/", nil)
+			rec := httptest.NewRecorder()
+			err = p.ServeHTTP(rec, req)
+
+			var proxyErr *Error
+			is.True(errors.As(err, &proxyErr)) // the error is classified
+			is.True(errors.Is(err, tt.err))    // the cause is kept
+			is.Equal(proxyErr.Class(), tt.wantClass)
+			is.Equal(proxyErr.Status(), tt.wantStatus)
+			is.Equal(proxyErr.TypeURI(), "https://ika.dozy.dev/guide/errors#"+tt.wantClass)
+			is.Equal(proxyErr.ClientClosed(), tt.cancel)
+			is.Equal(rec.Body.Len(), 0) // nothing is written, the error handler responds
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// Streaming configures how responses are streamed to the client.
+type Streaming struct {
+	// FlushInterval is how often the response is flushed while it is copied from the upstream,
+	// a negative value flushes after every write. Zero buffers the response.
+	// Server-sent events and responses of unknown length are always flushed after every write.
+	FlushInterval time.Duration
+	// DisableWriteTimeout lifts the write timeout of the server for every response.
+	DisableWriteTimeout bool
+	// DetectEventStream lifts the write timeout of the server for server-sent events.
+	DetectEventStream bool
+}
+
+type keyController struct{}
+
+// WithResponseController makes the [http.ResponseController] of w available to the proxy.
+// It must wrap the plugins of a route, since writers wrapped by plugins
+// do not necessarily expose the deadlines of the connection.
+func WithResponseController(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), keyController{}, http.NewResponseController(w))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// liftWriteDeadline removes the write deadline of the response to the request ctx belongs to.
+func liftWriteDeadline(ctx context.Context) {
+	if rc, ok := ctx.Value(keyController{}).(*http.ResponseController); ok {
+		_ = rc.SetWriteDeadline(time.Time{})
+	}
+}
+
+// WithStreaming returns a copy of the proxy that streams responses as configured by s.
+func (p *Proxy) WithStreaming(s Streaming) *Proxy {
+	c := &Proxy{rp: p.rp, streaming: s}
+	c.rp.FlushInterval = s.FlushInterval
+	if s.DetectEventStream {
+		c.rp.ModifyResponse = func(res *http.Response) error {
+			if isEventStream(res) {
+				liftWriteDeadline(res.Request.Context())
+			}
+			return nil
+		}
+	}
+	return c
+}
+
+func isEventStream(res *http.Response) bool {
+	ct, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	return ct == "text/event-stream"
+}
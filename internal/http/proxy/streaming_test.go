@@ -0,0 +1,136 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+// newGateway starts a gateway with the given write timeout proxying to upstream.
+func newGateway(t *testing.T, upstream http.Handler, writeTimeout time.Duration, s Streaming) *httptest.Server {
+	t.Helper()
+
+	up := httptest.NewServer(upstream)
+	t.Cleanup(up.Close)
+	u, _ := url.Parse(up.URL)
+
+	p, err := NewProxy(slog.New(slog.DiscardHandler), Config{Transport: http.DefaultTransport})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p = p.WithStreaming(s)
+
+	gw := httptest.NewUnstartedServer(WithResponseController(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.URL.Scheme, r.URL.Host = u.Scheme, u.Host
+		_ = p.ServeHTTP(w, r)
+	})))
+	gw.Config.WriteTimeout = writeTimeout
+	gw.Start()
+	t.Cleanup(gw.Close)
+	return gw
+}
+
+// events writes count server-sent events, one every interval.
+func events(count int, interval time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+		for i := range count {
+			_, _ = io.WriteString(w, "data: "+strconv.Itoa(i)+"\n\n")
+			_ = http.NewResponseController(w).Flush()
+			time.Sleep(interval)
+		}
+	})
+}
+
+// countEvents returns the number of events received before the stream ended.
+func countEvents(t *testing.T, url string) int {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	n := 0
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		if sc.Text() != "" {
+			n++
+		}
+	}
+	return n
+}
+
+func TestProxy_WithStreaming(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		streaming Streaming
+		want      int
+	}{
+		{name: "write timeout", want: 3},
+		{name: "detect event stream", streaming: Streaming{DetectEventStream: true}, want: 6},
+		{name: "disable write timeout", streaming: Streaming{DisableWriteTimeout: true}, want: 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			is := is.New(t)
+
+			gw := newGateway(t, events(6, 50*time.Millisecond), 125*time.Millisecond, tt.streaming)
+			is.Equal(countEvents(t, gw.URL), tt.want) // unexpected number of events
+		})
+	}
+}
+
+func TestProxy_flushInterval(t *testing.T) {
+	t.Parallel()
+
+	// upstream sends the first half of a response of known length and waits before sending the rest
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Length", "4")
+		_, _ = io.WriteString(w, "ab")
+		_ = http.NewResponseController(w).Flush()
+		time.Sleep(300 * time.Millisecond)
+		_, _ = io.WriteString(w, "cd")
+	})
+
+	tests := []struct {
+		name          string
+		flushInterval time.Duration
+		wantEarly     bool
+	}{
+		{name: "buffered"},
+		{name: "immediately", flushInterval: -1, wantEarly: true},
+		{name: "interval", flushInterval: 50 * time.Millisecond, wantEarly: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			is := is.New(t)
+
+			gw := newGateway(t, upstream, 0, Streaming{FlushInterval: tt.flushInterval})
+			start := time.Now()
+			resp, err := http.Get(gw.URL)
+			is.NoErr(err)
+			defer resp.Body.Close()
+
+			buf := make([]byte, 2)
+			_, err = io.ReadFull(resp.Body, buf)
+			is.NoErr(err)
+			is.Equal(string(buf), "ab")
+			is.Equal(time.Since(start) < 200*time.Millisecond, tt.wantEarly) // first half arrives before the rest
+		})
+	}
+}
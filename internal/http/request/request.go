@@ -1,13 +0,0 @@
-package request
-
-import (
-	"net/http"
-)
-
-func GetPath(r *http.Request) string {
-	path := r.URL.RawPath
-	if path == "" {
-		path = r.URL.Path
-	}
-	return path
-}
@@ -69,6 +69,11 @@ func (c *Caramel) HandleFunc(pattern string, handler http.HandlerFunc) *Caramel
 	return c
 }
 
+// Pattern returns the pattern that [Caramel.Handle] would register for the given pattern.
+func (c *Caramel) Pattern(pattern string) string {
+	return c.makePattern(pattern)
+}
+
 func (c *Caramel) clone() *Caramel {
 	newGrp := *c
 	newGrp.middlewares = slices.Clone(c.middlewares)
@@ -102,6 +107,11 @@ func (c *Caramel) wrapMiddleware(handler http.Handler) http.HandlerFunc {
 
 var patternRe = regexp.MustCompile(`^(?:(\S*)\s+)*\s*([^/]*)(/.*)$`)
 
+// DecomposePattern splits a [http.ServeMux] pattern into its method, host and path.
+func DecomposePattern(pattern string) (method, host, path string) {
+	return decomposePattern(pattern)
+}
+
 func decomposePattern(pattern string) (method, host, path string) {
 	matches := patternRe.FindStringSubmatch(pattern)
 	if len(matches) < 4 {
@@ -122,3 +122,13 @@ func (c Chain) Append(constructors ...Constructor) Chain {
 func (c Chain) Extend(chain Chain) Chain {
 	return c.Append(chain.constructors...)
 }
+
+// Names returns the names of the middlewares in the chain
+// in the order a request flows through them.
+func (c Chain) Names() []string {
+	names := make([]string, len(c.constructors))
+	for i := range c.constructors {
+		names[i] = c.constructors[i].Name
+	}
+	return names
+}
@@ -0,0 +1,71 @@
+package router
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/alx99/ika"
+	"github.com/alx99/ika/internal/config"
+)
+
+// chainPlugin is a plugin of a chain, as declared at path.
+type chainPlugin struct {
+	name string
+	path config.Path
+	// ignoreOrder turns errors about the plugins it has to run before or after into warnings
+	ignoreOrder bool
+}
+
+// checkDependencies returns an error if the plugins of a chain, given in the order
+// requests flow through them, do not satisfy the dependencies declared by their factories.
+// Plugins ignoring their order are returned as warnings instead.
+func checkDependencies(factories map[string]ika.PluginFactory, plugins []chainPlugin) (config.Problems, error) {
+	var warnings config.Problems
+	for i, p := range plugins {
+		provider, ok := factories[p.name].(ika.DependencyProvider)
+		if !ok {
+			continue
+		}
+		deps := provider.Dependencies()
+
+		runsBefore := func(name string) bool {
+			return slices.ContainsFunc(plugins[:i], func(p chainPlugin) bool { return p.name == name })
+		}
+		runsAfter := func(name string) bool {
+			return slices.ContainsFunc(plugins[i+1:], func(p chainPlugin) bool { return p.name == name })
+		}
+
+		var err error
+		for _, name := range deps.Requires {
+			switch {
+			case runsBefore(name):
+			case runsAfter(name):
+				err = fmt.Errorf("plugin %q requires %q earlier in the chain, but it runs later", p.name, name)
+			default:
+				err = fmt.Errorf("plugin %q requires %q earlier in the chain, but it is not part of it", p.name, name)
+			}
+			if err != nil {
+				return nil, &config.PathError{Path: p.path, Err: err}
+			}
+		}
+
+		var misordered []error
+		for _, name := range deps.After {
+			if runsAfter(name) {
+				misordered = append(misordered, fmt.Errorf("plugin %q must run after %q", p.name, name))
+			}
+		}
+		for _, name := range deps.Before {
+			if runsBefore(name) {
+				misordered = append(misordered, fmt.Errorf("plugin %q must run before %q", p.name, name))
+			}
+		}
+		for _, err := range misordered {
+			if !p.ignoreOrder {
+				return nil, &config.PathError{Path: p.path, Err: err}
+			}
+			warnings = append(warnings, config.Problem{Path: p.path, Message: err.Error()})
+		}
+	}
+	return warnings, nil
+}
@@ -0,0 +1,311 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alx99/ika/internal/config"
+)
+
+// makeProxyFunc returns the function selecting the outbound proxy of a request,
+// or nil if no proxy is configured.
+func makeProxyFunc(path config.Path, cfg config.Proxy) (func(*http.Request) (*url.URL, error), error) {
+	if cfg.URL == "" {
+		if len(cfg.NoProxy) > 0 {
+			return nil, &config.PathError{Path: path.Field("url"), Err: errors.New("must be set if noProxy is set")}
+		}
+		return nil, nil
+	}
+
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, &config.PathError{Path: path.Field("url"), Err: err}
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, &config.PathError{Path: path.Field("url"), Err: fmt.Errorf("unsupported proxy scheme %q", u.Scheme)}
+	}
+	if u.Host == "" {
+		return nil, &config.PathError{Path: path.Field("url"), Err: errors.New("must include a host")}
+	}
+
+	rules := make([]noProxyRule, len(cfg.NoProxy))
+	for i, entry := range cfg.NoProxy {
+		if rules[i], err = parseNoProxyRule(entry); err != nil {
+			return nil, &config.PathError{Path: path.Field("noProxy").Index(i), Err: err}
+		}
+	}
+
+	return func(r *http.Request) (*url.URL, error) {
+		host, port := r.URL.Hostname(), r.URL.Port()
+		if port == "" {
+			port = "80"
+			if r.URL.Scheme == "https" {
+				port = "443"
+			}
+		}
+		for _, rule := range rules {
+			if rule.match(host, port) {
+				return nil, nil
+			}
+		}
+		return u, nil
+	}, nil
+}
+
+// noProxyRule matches the upstreams that bypass the outbound proxy.
+type noProxyRule struct {
+	all     bool
+	network *net.IPNet
+	// domain matches itself and its subdomains, or only the subdomains if subdomainsOnly is set
+	domain         string
+	subdomainsOnly bool
+	// port restricts the rule to a port if set
+	port string
+}
+
+func parseNoProxyRule(entry string) (noProxyRule, error) {
+	entry = strings.ToLower(strings.TrimSpace(entry))
+	switch {
+	case entry == "":
+		return noProxyRule{}, errors.New("must not be empty")
+	case entry == "*":
+		return noProxyRule{all: true}, nil
+	}
+
+	if _, network, err := net.ParseCIDR(entry); err == nil {
+		return noProxyRule{network: network}, nil
+	}
+
+	var rule noProxyRule
+	host := entry
+	if h, port, err := net.SplitHostPort(entry); err == nil {
+		host, rule.port = h, port
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+
+	if ip := net.ParseIP(host); ip != nil {
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+		rule.network = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+		return rule, nil
+	}
+
+	// "*.example.com" is accepted as an alias of ".example.com"
+	host = strings.TrimPrefix(host, "*")
+	rule.subdomainsOnly = strings.HasPrefix(host, ".")
+	rule.domain = strings.TrimPrefix(host, ".")
+	if rule.domain == "" || strings.ContainsAny(rule.domain, "/*") {
+		return noProxyRule{}, fmt.Errorf("invalid entry %q", entry)
+	}
+	return rule, nil
+}
+
+func (r noProxyRule) match(host, port string) bool {
+	if r.all {
+		return true
+	}
+	if r.port != "" && r.port != port {
+		return false
+	}
+	if r.network != nil {
+		ip := net.ParseIP(host)
+		return ip != nil && r.network.Contains(ip)
+	}
+
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if strings.HasSuffix(host, "."+r.domain) {
+		return true
+	}
+	return !r.subdomainsOnly && host == r.domain
+}
+
+// maxCachedHosts bounds the number of host names the resolver caches,
+// since host names can be derived from requests.
+const maxCachedHosts = 4096
+
+// resolver resolves the host names of upstreams using static entries, a cache and DNS.
+type resolver struct {
+	hosts map[string][]string
+	dns   *net.Resolver
+	ttl   time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedAddrs
+}
+
+type cachedAddrs struct {
+	addrs   []string
+	expires time.Time
+}
+
+// newResolver returns a resolver for cfg, or nil if cfg is empty and the system resolver is used.
+// DNS servers are dialed with d.
+func newResolver(path config.Path, cfg config.Resolver, d *net.Dialer) (*resolver, error) {
+	if len(cfg.Servers) == 0 && len(cfg.Hosts) == 0 && cfg.CacheTTL == 0 {
+		return nil, nil
+	}
+	if cfg.CacheTTL < 0 {
+		return nil, &config.PathError{Path: path.Field("cacheTTL"), Err: errors.New("must not be negative")}
+	}
+
+	r := &resolver{
+		hosts: make(map[string][]string, len(cfg.Hosts)),
+		dns:   net.DefaultResolver,
+		ttl:   cfg.CacheTTL.Dur(),
+		cache: make(map[string]cachedAddrs),
+	}
+
+	for name, addrs := range cfg.Hosts {
+		if len(addrs) == 0 {
+			return nil, &config.PathError{Path: path.Field("hosts").Field(name), Err: errors.New("must not be empty")}
+		}
+		for i, addr := range addrs {
+			if net.ParseIP(addr) == nil {
+				return nil, &config.PathError{Path: path.Field("hosts").Field(name).Index(i), Err: fmt.Errorf("invalid IP address %q", addr)}
+			}
+		}
+		r.hosts[strings.ToLower(name)] = addrs
+	}
+
+	if len(cfg.Servers) > 0 {
+		servers := make([]string, len(cfg.Servers))
+		for i, server := range cfg.Servers {
+			host, port, err := net.SplitHostPort(server)
+			if err != nil {
+				host, port = server, "53"
+			}
+			if net.ParseIP(host) == nil {
+				return nil, &config.PathError{Path: path.Field("servers").Index(i), Err: fmt.Errorf("invalid IP address %q", host)}
+			}
+			servers[i] = net.JoinHostPort(host, port)
+		}
+
+		// every attempt of the resolver is sent to the next server, so that unreachable servers are skipped
+		var next atomic.Uint32
+		r.dns = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return d.DialContext(ctx, network, servers[int(next.Add(1)-1)%len(servers)])
+			},
+		}
+	}
+
+	return r, nil
+}
+
+// lookup returns the addresses of host.
+func (r *resolver) lookup(ctx context.Context, host string) ([]string, error) {
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+	name := strings.TrimSuffix(strings.ToLower(host), ".")
+	if addrs, ok := r.hosts[name]; ok {
+		return addrs, nil
+	}
+	if r.ttl == 0 {
+		return r.dns.LookupHost(ctx, host)
+	}
+
+	now := time.Now()
+	r.mu.Lock()
+	cached, ok := r.cache[name]
+	r.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.addrs, nil
+	}
+
+	addrs, err := r.dns.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.cache) >= maxCachedHosts {
+		for k, v := range r.cache {
+			if !now.Before(v.expires) {
+				delete(r.cache, k)
+			}
+		}
+		if len(r.cache) >= maxCachedHosts {
+			clear(r.cache)
+		}
+	}
+	r.cache[name] = cachedAddrs{addrs: addrs, expires: now.Add(r.ttl)}
+	return addrs, nil
+}
+
+// dialContext returns a dial function that resolves host names with r before dialing with d.
+// Addresses are tried in order until a connection is established.
+func (r *resolver) dialContext(d *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		addrs, err := r.lookup(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		var errs []error
+		for _, a := range addrs {
+			conn, err := d.DialContext(ctx, network, net.JoinHostPort(a, port))
+			if err == nil {
+				return conn, nil
+			}
+			errs = append(errs, err)
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		return nil, errors.Join(errs...)
+	}
+}
+
+// unixTransport makes requests to upstreams listening on Unix domain sockets.
+// The socket path is the host of the request URL, an upstream such as unix:///run/app.sock
+// results in the scheme "unix" and the host "/run/app.sock".
+type unixTransport struct {
+	t *http.Transport
+}
+
+// newUnixTransport returns a transport sharing the settings of base which dials Unix sockets with d.
+func newUnixTransport(base *http.Transport, d *net.Dialer) unixTransport {
+	t := base.Clone()
+	t.Proxy = nil
+	t.DialContext = func(ctx context.Context, _, addr string) (net.Conn, error) {
+		// the transport appends the default port of the scheme to the host
+		return d.DialContext(ctx, "unix", strings.TrimSuffix(addr, ":80"))
+	}
+	return unixTransport{t: t}
+}
+
+func (u unixTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.URL.Host == "" {
+		return nil, errors.New("unix: missing socket path")
+	}
+
+	out := new(http.Request)
+	*out = *r
+	out.URL = new(url.URL)
+	*out.URL = *r.URL
+	out.URL.Scheme = "http"
+	// a socket path is not a meaningful Host header
+	if out.Host == "" || out.Host == r.URL.Host {
+		out.Host = "localhost"
+	}
+	return u.t.RoundTrip(out)
+}
@@ -0,0 +1,293 @@
+package router
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alx99/ika/internal/config"
+	"github.com/matryer/is"
+)
+
+func TestMakeProxyFunc(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		cfg     config.Proxy
+		target  string
+		want    string
+		wantErr string
+	}{
+		{name: "no proxy", target: "http://a.internal"},
+		{name: "http", cfg: config.Proxy{URL: "http://proxy:3128"}, target: "http://a.internal", want: "http://proxy:3128"},
+		{name: "socks5", cfg: config.Proxy{URL: "socks5://proxy:1080"}, target: "https://a.internal", want: "socks5://proxy:1080"},
+		{name: "domain", cfg: config.Proxy{URL: "http://proxy", NoProxy: []string{"internal"}}, target: "http://a.internal"},
+		{name: "domain itself", cfg: config.Proxy{URL: "http://proxy", NoProxy: []string{"a.internal"}}, target: "http://A.internal"},
+		{name: "domain suffix", cfg: config.Proxy{URL: "http://proxy", NoProxy: []string{"internal"}}, target: "http://external", want: "http://proxy"},
+		{name: "subdomains only", cfg: config.Proxy{URL: "http://proxy", NoProxy: []string{".a.internal"}}, target: "http://a.internal", want: "http://proxy"},
+		{name: "wildcard subdomain", cfg: config.Proxy{URL: "http://proxy", NoProxy: []string{"*.internal"}}, target: "http://a.internal"},
+		{name: "ip", cfg: config.Proxy{URL: "http://proxy", NoProxy: []string{"10.0.0.1"}}, target: "http://10.0.0.1:8080"},
+		{name: "cidr", cfg: config.Proxy{URL: "http://proxy", NoProxy: []string{"10.0.0.0/8"}}, target: "http://10.1.2.3"},
+		{name: "ipv6", cfg: config.Proxy{URL: "http://proxy", NoProxy: []string{"[::1]:8080"}}, target: "http://[::1]:8080"},
+		{name: "port", cfg: config.Proxy{URL: "http://proxy", NoProxy: []string{"a.internal:443"}}, target: "https://a.internal"},
+		{name: "other port", cfg: config.Proxy{URL: "http://proxy", NoProxy: []string{"a.internal:443"}}, target: "http://a.internal", want: "http://proxy"},
+		{name: "all", cfg: config.Proxy{URL: "http://proxy", NoProxy: []string{"*"}}, target: "http://a.internal"},
+		{name: "unsupported scheme", cfg: config.Proxy{URL: "ftp://proxy"}, wantErr: `$.url: unsupported proxy scheme "ftp"`},
+		{name: "missing host", cfg: config.Proxy{URL: "http://"}, wantErr: "$.url: must include a host"},
+		{name: "no proxy without url", cfg: config.Proxy{NoProxy: []string{"a"}}, wantErr: "$.url: must be set if noProxy is set"},
+		{name: "empty entry", cfg: config.Proxy{URL: "http://proxy", NoProxy: []string{"a", " "}}, wantErr: "$.noProxy[1]: must not be empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			is := is.New(t)
+
+			proxyFunc, err := makeProxyFunc(config.RootPath, tt.cfg)
+			if tt.wantErr != "" {
+				is.True(err != nil) // expected an error
+				is.Equal(err.Error(), tt.wantErr)
+				return
+			}
+			is.NoErr(err)
+			if proxyFunc == nil {
+				is.Equal(tt.want, "")
+				return
+			}
+
+			u, err := proxyFunc(httptest.NewRequest(http.MethodGet, tt.target, nil))
+			is.NoErr(err)
+			got := ""
+			if u != nil {
+				got = u.String()
+			}
+			is.Equal(got, tt.want)
+		})
+	}
+}
+
+func TestMakeTransport_proxy(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	// the proxy answers every request itself, naming the upstream it was asked for
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "proxied "+r.URL.Host)
+	}))
+	t.Cleanup(proxy.Close)
+	direct := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "direct")
+	}))
+	t.Cleanup(direct.Close)
+
+	transport, err := makeTransport(config.RootPath, config.Transport{Proxy: config.Proxy{
+		URL:     proxy.URL,
+		NoProxy: []string{"127.0.0.1"},
+	}})
+	is.NoErr(err)
+
+	is.Equal(roundTrip(t, transport, "http://upstream.internal/a"), "proxied upstream.internal")
+	is.Equal(roundTrip(t, transport, direct.URL), "direct")
+}
+
+func TestNewResolver(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		cfg     config.Resolver
+		wantNil bool
+		wantErr string
+	}{
+		{name: "empty", wantNil: true},
+		{name: "valid", cfg: config.Resolver{
+			Servers:  []string{"10.0.0.1", "10.0.0.2:5353", "[::1]:53"},
+			Hosts:    map[string][]string{"a.internal": {"10.0.0.3", "::1"}},
+			CacheTTL: config.Duration(time.Minute),
+		}},
+		{name: "server name", cfg: config.Resolver{Servers: []string{"dns.internal"}}, wantErr: `$.servers[0]: invalid IP address "dns.internal"`},
+		{name: "host name", cfg: config.Resolver{Hosts: map[string][]string{"a": {"b"}}}, wantErr: `$.hosts.a[0]: invalid IP address "b"`},
+		{name: "no addresses", cfg: config.Resolver{Hosts: map[string][]string{"a": {}}}, wantErr: "$.hosts.a: must not be empty"},
+		{name: "negative TTL", cfg: config.Resolver{CacheTTL: -1}, wantErr: "$.cacheTTL: must not be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			is := is.New(t)
+
+			r, err := newResolver(config.RootPath, tt.cfg, &net.Dialer{})
+			if tt.wantErr != "" {
+				is.True(err != nil) // expected an error
+				is.Equal(err.Error(), tt.wantErr)
+				return
+			}
+			is.NoErr(err)
+			is.Equal(r == nil, tt.wantNil)
+		})
+	}
+}
+
+// dnsServer starts a DNS server answering every A query with ip, and returns its address
+// and the number of queries it answered.
+func dnsServer(t *testing.T, ip net.IP) (string, *atomic.Int32) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	var queries atomic.Int32
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			// header, followed by a single question: name, type and class
+			end := 12
+			for end < n && buf[end] != 0 {
+				end += int(buf[end]) + 1
+			}
+			end += 5
+			if end > n {
+				continue
+			}
+			qtype := binary.BigEndian.Uint16(buf[end-4:])
+
+			resp := append([]byte(nil), buf[:end]...)
+			resp[2], resp[3] = 0x81, 0x80 // response, recursion desired and available
+			binary.BigEndian.PutUint16(resp[6:], 0)
+			binary.BigEndian.PutUint16(resp[8:], 0)
+			binary.BigEndian.PutUint16(resp[10:], 0)
+			if qtype == 1 {
+				queries.Add(1)
+				binary.BigEndian.PutUint16(resp[6:], 1)
+				resp = append(resp, 0xc0, 0x0c, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4)
+				resp = append(resp, ip.To4()...)
+			}
+			_, _ = conn.WriteTo(resp, addr)
+		}
+	}()
+	return conn.LocalAddr().String(), &queries
+}
+
+func TestResolver_lookup(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	server, queries := dnsServer(t, net.IPv4(10, 0, 0, 1))
+	r, err := newResolver(config.RootPath, config.Resolver{
+		Servers:  []string{server},
+		Hosts:    map[string][]string{"static.internal": {"10.0.0.2"}},
+		CacheTTL: config.Duration(time.Hour),
+	}, &net.Dialer{})
+	is.NoErr(err)
+
+	addrs, err := r.lookup(t.Context(), "Static.internal")
+	is.NoErr(err)
+	is.Equal(addrs, []string{"10.0.0.2"}) // static hosts take precedence
+	is.Equal(queries.Load(), int32(0))
+
+	addrs, err = r.lookup(t.Context(), "a.internal")
+	is.NoErr(err)
+	is.Equal(addrs, []string{"10.0.0.1"}) // resolved by the configured server
+	is.Equal(queries.Load(), int32(1))
+
+	_, err = r.lookup(t.Context(), "a.internal")
+	is.NoErr(err)
+	is.Equal(queries.Load(), int32(1)) // cached
+
+	r.mu.Lock()
+	entry := r.cache["a.internal"]
+	entry.expires = time.Now()
+	r.cache["a.internal"] = entry
+	r.mu.Unlock()
+
+	_, err = r.lookup(t.Context(), "a.internal")
+	is.NoErr(err)
+	is.Equal(queries.Load(), int32(2)) // resolved again once expired
+}
+
+func TestMakeTransport_resolver(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Host)
+	}))
+	t.Cleanup(upstream.Close)
+	u, _ := url.Parse(upstream.URL)
+
+	transport, err := makeTransport(config.RootPath, config.Transport{Resolver: config.Resolver{
+		Hosts: map[string][]string{"upstream.internal": {"127.0.0.2", "127.0.0.1"}},
+	}})
+	is.NoErr(err)
+
+	// 127.0.0.2 refuses the connection, so the next address is tried
+	is.Equal(roundTrip(t, transport, "http://upstream.internal:"+u.Port()), "upstream.internal:"+u.Port())
+}
+
+func TestMakeTransport_unix(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	socket := filepath.Join(t.TempDir(), "app.sock")
+	l, err := net.Listen("unix", socket)
+	is.NoErr(err)
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Host+" "+r.URL.RequestURI())
+	}))
+	upstream.Listener = l
+	upstream.Start()
+	t.Cleanup(upstream.Close)
+
+	transport, err := makeTransport(config.RootPath, config.Transport{})
+	is.NoErr(err)
+
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/a?b=c", nil)
+	req.RequestURI = ""
+	req.URL.Scheme, req.URL.Host, req.Host = "unix", socket, socket
+	resp, err := transport.RoundTrip(req)
+	is.NoErr(err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	is.NoErr(err)
+	is.Equal(string(body), "localhost /a?b=c") // the socket path is not sent as Host header
+
+	req.Host = "app.internal"
+	resp, err = transport.RoundTrip(req)
+	is.NoErr(err)
+	defer resp.Body.Close()
+	body, err = io.ReadAll(resp.Body)
+	is.NoErr(err)
+	is.True(strings.HasPrefix(string(body), "app.internal ")) // a retained Host header is kept
+}
+
+// roundTrip sends a GET request to target with transport and returns the response body.
+func roundTrip(t *testing.T, transport http.RoundTripper, target string) string {
+	t.Helper()
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, target, nil)
+	req.RequestURI = ""
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
@@ -0,0 +1,227 @@
+package router
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/alx99/ika/internal/config"
+)
+
+// requestMatcher checks the headers, query parameters and cookies of a request
+// against the match conditions of a route.
+type requestMatcher struct {
+	conds []condition
+}
+
+type condition struct {
+	source string // header, query or cookie
+	name   string
+	value  string
+	re     *regexp.Regexp
+}
+
+func newRequestMatcher(path config.Path, m config.Match) (*requestMatcher, error) {
+	var conds []condition
+	add := func(source string, field string, values map[string]config.ValueMatch) error {
+		for _, name := range slices.Sorted(maps.Keys(values)) {
+			v := values[name]
+			cond := condition{source: source, name: name, value: v.Value}
+			if source == "header" {
+				cond.name = http.CanonicalHeaderKey(name)
+			}
+			if v.Regex != "" {
+				re, err := regexp.Compile(v.Regex)
+				if err != nil {
+					return &config.PathError{Path: path.Field(field).Field(name).Field("regex"), Err: err}
+				}
+				cond.re = re
+			}
+			conds = append(conds, cond)
+		}
+		return nil
+	}
+
+	if err := add("header", "headers", m.Headers); err != nil {
+		return nil, err
+	}
+	if err := add("query", "query", m.Query); err != nil {
+		return nil, err
+	}
+	if err := add("cookie", "cookies", m.Cookies); err != nil {
+		return nil, err
+	}
+	return &requestMatcher{conds: conds}, nil
+}
+
+// matches reports whether r satisfies every condition.
+// A condition on a header or query parameter with several values is satisfied if any value matches.
+// Absent values never match.
+func (m *requestMatcher) matches(r *http.Request) bool {
+	var query map[string][]string
+	for _, cond := range m.conds {
+		var values []string
+		switch cond.source {
+		case "header":
+			values = r.Header.Values(cond.name)
+		case "query":
+			if query == nil {
+				query = r.URL.Query()
+			}
+			values = query[cond.name]
+		case "cookie":
+			for _, c := range r.CookiesNamed(cond.name) {
+				values = append(values, c.Value)
+			}
+		}
+		if !slices.ContainsFunc(values, cond.matches) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c condition) matches(value string) bool {
+	if c.re != nil {
+		return c.re.MatchString(value)
+	}
+	return value == c.value
+}
+
+// String describes the conditions, e.g. "header X-Tenant=acme, query beta~^1$".
+func (m *requestMatcher) String() string {
+	parts := make([]string, len(m.conds))
+	for i, cond := range m.conds {
+		if cond.re != nil {
+			parts[i] = cond.source + " " + cond.name + "~" + cond.re.String()
+		} else {
+			parts[i] = cond.source + " " + cond.name + "=" + cond.value
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// candidate is a route registered for a mux pattern.
+type candidate struct {
+	routeEntry
+	match   *requestMatcher
+	handler http.Handler
+}
+
+// serverMux routes the requests received by a server.
+type serverMux struct {
+	mux *http.ServeMux
+	// patterns holds the routes registered on mux by pattern
+	patterns map[string]*candidates
+	// fallbacks caches the muxes routing requests none of the candidates of some patterns match,
+	// keyed by those patterns
+	fallbacks sync.Map
+}
+
+func newServerMux() *serverMux {
+	return &serverMux{
+		mux:      http.NewServeMux(),
+		patterns: map[string]*candidates{},
+	}
+}
+
+// without returns a mux routing requests like m.mux, but without the excluded patterns.
+func (m *serverMux) without(excluded []string) *http.ServeMux {
+	key := strings.Join(excluded, "\n")
+	if mux, ok := m.fallbacks.Load(key); ok {
+		return mux.(*http.ServeMux)
+	}
+
+	mux := http.NewServeMux()
+	for pattern, set := range m.patterns {
+		if !slices.Contains(excluded, pattern) {
+			mux.Handle(pattern, set)
+		}
+	}
+	actual, _ := m.fallbacks.LoadOrStore(key, mux)
+	return actual.(*http.ServeMux)
+}
+
+// find returns the candidate that handles r and the pattern it is registered for,
+// or nil if there is none.
+func (m *serverMux) find(r *http.Request) (*candidate, string) {
+	mux := m.mux
+	var excluded []string
+	for {
+		_, pattern := mux.Handler(r)
+		set, ok := m.patterns[pattern]
+		if !ok {
+			return nil, ""
+		}
+		if cand := set.find(r); cand != nil {
+			return cand, pattern
+		}
+		excluded = append(excluded, pattern)
+		mux = m.without(excluded)
+	}
+}
+
+// candidates are the routes registered for the same mux pattern, possibly by different namespaces.
+// After the mux has matched the pattern, the first candidate whose conditions
+// match handles the request. Candidates with more conditions are tried first,
+// followed by those bound to specific servers, and the route without conditions,
+// if any, is tried last. If no candidate matches, the request falls through
+// to the next less specific pattern.
+type candidates struct {
+	pattern string
+	owner   *serverMux
+	list    []candidate
+}
+
+func (c *candidates) add(cand candidate) error {
+	for _, other := range c.list {
+		if other.match.String() == cand.match.String() && slices.Equal(other.Servers, cand.Servers) {
+			if len(cand.match.conds) == 0 {
+				return fmt.Errorf("pattern %q is already registered by namespace %q", cand.Pattern, other.Namespace)
+			}
+			return fmt.Errorf("pattern %q with the same match conditions is already registered by namespace %q", cand.Pattern, other.Namespace)
+		}
+	}
+
+	c.list = append(c.list, cand)
+	slices.SortStableFunc(c.list, func(a, b candidate) int {
+		return cmp.Or(
+			cmp.Compare(len(b.match.conds), len(a.match.conds)),
+			cmp.Compare(min(len(b.Servers), 1), min(len(a.Servers), 1)),
+			cmp.Compare(a.Namespace, b.Namespace),
+			cmp.Compare(a.Route, b.Route),
+		)
+	})
+	return nil
+}
+
+// find returns the candidate that handles r, or nil if there is none.
+func (c *candidates) find(r *http.Request) *candidate {
+	for i := range c.list {
+		if c.list[i].match.matches(r) {
+			return &c.list[i]
+		}
+	}
+	return nil
+}
+
+// keyExcluded is the context key of the patterns a request has fallen through.
+type keyExcluded struct{}
+
+func (c *candidates) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if cand := c.find(r); cand != nil {
+		cand.handler.ServeHTTP(w, r)
+		return
+	}
+
+	// the mux sets the pattern and path values of the request matching the next pattern
+	excluded, _ := r.Context().Value(keyExcluded{}).([]string)
+	excluded = append(slices.Clip(excluded), c.pattern)
+	c.owner.without(excluded).ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), keyExcluded{}, excluded)))
+}
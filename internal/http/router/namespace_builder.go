@@ -12,47 +12,85 @@ import (
 
 	"github.com/alx99/ika"
 	"github.com/alx99/ika/internal/config"
+	"github.com/alx99/ika/internal/http/errpage"
 	"github.com/alx99/ika/internal/http/proxy"
-	"github.com/alx99/ika/internal/http/request"
 	"github.com/alx99/ika/internal/http/router/caramel"
 	"github.com/alx99/ika/internal/http/router/chain"
+	"github.com/alx99/ika/internal/http/upgrade"
 	"github.com/alx99/ika/internal/teardown"
+	"github.com/alx99/ika/request"
 )
 
 // nsBuilder handles the construction of a single namespace
 type nsBuilder struct {
-	name       string
-	namespace  config.Namespace
-	log        *slog.Logger
-	proxy      *proxy.Proxy
+	name      string
+	namespace config.Namespace
+	path      config.Path
+	log       *slog.Logger
+	proxy     *proxy.Proxy
+	errPages  *errpage.Pages
+	// errHandler writes the error responses after errHooks and errPages, if it is set
+	errHandler ika.ErrorHandler
+	// errHooks are the namespace hooks handling the errors of requests
+	errHooks []ika.ErrorHook
+	// hooks are the namespace hooks, which implement any of the hook interfaces
+	hooks []declared
+	// chain is the chain of the namespace, which the chains of its routes extend
+	chain      pluginChain
 	transport  http.RoundTripper
 	factories  map[string]ika.PluginFactory
+	plugins    *pluginSet
 	teardowner teardown.Teardowner
-	mux        *http.ServeMux
+	// upgrades tracks the connections upgraded by the routes of the namespace
+	upgrades *upgrade.Tracker
+	// muxes are the muxes of the servers the namespace is served on, shared with other namespaces
+	muxes []*serverMux
 
 	// Route registration channels
 	registrationCh chan routeRegistration
 	done           chan struct{}
+
+	// collect makes the builder keep going after a route fails to build.
+	// The errors are accumulated in errs instead.
+	collect bool
+	errs    []error
+	// warnings holds the ordering constraints broken by plugins ignoring their order
+	warnings config.Problems
+
+	// routes contains every route registered by the builder
+	routes []routeEntry
 }
 
 type routeRegistration struct {
+	pattern   string
+	candidate candidate
+	mount     string
+	result    chan registrationResult
+}
+
+type registrationResult struct {
+	// pattern is the pattern the route was registered with on the mux
 	pattern string
-	handler http.Handler
-	mount   string
-	err     chan error
+	err     error
 }
 
-func newNSBuilder(_ context.Context, mux *http.ServeMux, name string, ns config.Namespace, log *slog.Logger, factories map[string]ika.PluginFactory) (*nsBuilder, error) {
+func newNSBuilder(_ context.Context, muxes []*serverMux, plugins *pluginSet, name string, ns config.Namespace, log *slog.Logger, opts config.ComptimeOpts) (*nsBuilder, error) {
 	registrationCh := make(chan routeRegistration)
 	done := make(chan struct{})
+	// upgraded connections are closed before the plugins they go through are torn down
+	upgrades := upgrade.NewTracker()
 
 	b := nsBuilder{
 		name:           name,
 		namespace:      ns,
+		path:           config.RootPath.Field("namespaces").Field(name),
 		log:            log.With(slog.String("namespace", name)),
-		factories:      factories,
-		teardowner:     make(teardown.Teardowner, 0),
-		mux:            mux,
+		factories:      opts.Plugins,
+		plugins:        plugins,
+		errHandler:     opts.ErrorHandler,
+		teardowner:     teardown.Teardowner{upgrades.Close},
+		upgrades:       upgrades,
+		muxes:          muxes,
 		registrationCh: registrationCh,
 		done:           done,
 	}
@@ -62,14 +100,31 @@ func newNSBuilder(_ context.Context, mux *http.ServeMux, name string, ns config.
 		defer close(done)
 		for reg := range registrationCh {
 			func() {
+				var pattern string
+				var err error
 				defer func() {
 					if r := recover(); r != nil {
-						reg.err <- fmt.Errorf("failed to register route %q: %v", reg.pattern, r)
+						reg.result <- registrationResult{err: fmt.Errorf("failed to register route %q: %v", reg.pattern, r)}
 						return
 					}
-					reg.err <- nil
+					reg.result <- registrationResult{pattern: pattern, err: err}
 				}()
-				caramel.Wrap(mux).Mount(reg.mount).Handle(reg.pattern, reg.handler)
+				for _, m := range muxes {
+					c := caramel.Wrap(m.mux).Mount(reg.mount)
+					pattern = c.Pattern(reg.pattern)
+					reg.candidate.Pattern = pattern
+
+					// routes sharing a pattern are told apart by their match conditions
+					set, ok := m.patterns[pattern]
+					if !ok {
+						set = &candidates{pattern: pattern, owner: m}
+						c.Handle(reg.pattern, set)
+						m.patterns[pattern] = set
+					}
+					if err = set.add(reg.candidate); err != nil {
+						return
+					}
+				}
 			}()
 		}
 	}()
@@ -77,8 +132,12 @@ func newNSBuilder(_ context.Context, mux *http.ServeMux, name string, ns config.
 	return &b, nil
 }
 
+// build builds the routes of the namespace. If it fails, the builder is torn down.
 func (b *nsBuilder) build(ctx context.Context) error {
-	var transport http.RoundTripper = makeTransport(b.namespace.Transport)
+	base, err := makeTransport(b.path.Field("transport"), b.namespace.Transport)
+	if err != nil {
+		return errors.Join(err, b.teardown(ctx))
+	}
 
 	ictx := ika.InjectionContext{
 		Namespace: b.name,
@@ -86,98 +145,189 @@ func (b *nsBuilder) build(ctx context.Context) error {
 		Logger:    b.log,
 	}
 
-	var err error
-	transport, err = b.setupTransport(ctx, ictx, transport)
+	// every declaration of the namespace is instantiated once and shared by its routes
+	b.hooks, err = b.createHooks(ctx, ictx, b.path.Field("hooks"))
+	if err != nil {
+		return errors.Join(err, b.teardown(ctx))
+	}
+
+	transport, err := b.setupTransport(base)
 	if err != nil {
-		return errors.Join(err, b.teardowner.Teardown(ctx))
+		return errors.Join(err, b.teardown(ctx))
 	}
 
 	b.transport = transport
 
+	if b.namespace.BufferSize < 0 {
+		err := &config.PathError{Path: b.path.Field("bufferSize"), Err: errors.New("must not be negative")}
+		return errors.Join(err, b.teardown(ctx))
+	}
+
 	p, err := proxy.NewProxy(b.log, proxy.Config{
 		Transport:  transport,
 		Namespace:  b.name,
-		BufferPool: newBufferPool(),
+		BufferPool: newBufferPool(b.namespace.BufferSize),
 	})
 	if err != nil {
-		return errors.Join(err, b.teardowner.Teardown(ctx))
+		return errors.Join(err, b.teardown(ctx))
 	}
 
 	b.proxy = p
 
+	b.errPages, err = errpage.New(b.path.Field("errorPages"), b.namespace.ErrorPages)
+	if err != nil {
+		return errors.Join(err, b.teardown(ctx))
+	}
+
+	b.errHooks = b.setupErrorHooks()
+
+	b.chain, err = b.makeChain(ctx, ictx, b.path, b.namespace.Middlewares, b.namespace.ReqModifiers, b.hooks)
+	if err != nil {
+		return errors.Join(err, b.teardown(ctx))
+	}
+
 	if err := b.buildRoutes(ctx); err != nil {
-		return errors.Join(err, b.teardowner.Teardown(ctx))
+		return errors.Join(err, b.teardown(ctx))
 	}
 
 	return nil
 }
 
 func (b *nsBuilder) buildRoutes(ctx context.Context) error {
-	for _, mount := range b.namespace.Mounts {
-		for pattern, route := range b.namespace.Routes {
-			if err := b.buildRoute(ctx, mount, pattern, route); err != nil {
-				return err
-			}
+	for pattern, route := range b.namespace.Routes {
+		if err := b.buildRoute(ctx, pattern, route); b.fail(err) != nil {
+			return err
 		}
 	}
 	return nil
 }
 
-func (b *nsBuilder) buildRoute(ctx context.Context, mount, pattern string, route config.Route) error {
-	nsCtx := ika.InjectionContext{
+// buildRoute registers route on every mount of the namespace.
+// The declarations of the route are instantiated once and shared by all mounts and methods.
+func (b *nsBuilder) buildRoute(ctx context.Context, pattern string, route config.Route) error {
+	routeCtx := ika.InjectionContext{
 		Namespace: b.name,
-		Scope:     ika.ScopeNamespace,
+		Route:     pattern,
+		Scope:     ika.ScopeRoute,
 		Logger:    b.log,
 	}
 
-	nsChain, err := b.makeChain(ctx, nsCtx,
-		slices.Collect(b.namespace.Middlewares.Enabled()),
-		slices.Collect(b.namespace.ReqModifiers.Enabled()),
-		slices.Collect(b.namespace.Hooks.Enabled()),
+	routePath := b.path.Field("routes").Field(pattern)
+	routeChain, err := b.makeChain(ctx, routeCtx, routePath,
+		route.Middlewares,
+		route.ReqModifiers,
+		nil,
 	)
 	if err != nil {
 		return err
 	}
 
-	routeCtx := nsCtx
-	routeCtx.Route = pattern
-	routeCtx.Scope = ika.ScopeRoute
+	warnings, err := checkDependencies(b.factories, slices.Concat(b.chain.plugins, routeChain.plugins))
+	if err != nil {
+		return err
+	}
+	b.warnings = append(b.warnings, warnings...)
+
+	match, err := newRequestMatcher(routePath.Field("match"), route.Match)
+	if err != nil {
+		return err
+	}
 
-	routeChain, err := b.makeChain(ctx, routeCtx,
-		slices.Collect(route.Middlewares.Enabled()),
-		slices.Collect(route.ReqModifiers.Enabled()),
-		nil,
-	)
+	upgradeOpts := upgrade.Options{
+		Disabled:    route.Upgrade.Disabled,
+		Protocols:   make([]string, len(route.Upgrade.Protocols)),
+		IdleTimeout: route.Upgrade.IdleTimeout.Dur(),
+		MaxLifetime: route.Upgrade.MaxLifetime.Dur(),
+	}
+	for i, p := range route.Upgrade.Protocols {
+		upgradeOpts.Protocols[i] = strings.ToLower(p)
+	}
+
+	routeProxy, err := b.routeProxy(routePath.Field("streaming"), route.Streaming)
 	if err != nil {
 		return err
 	}
 
+	errPages := b.errPages
+	if !route.ErrorPages.IsZero() {
+		errPages, err = errpage.New(routePath.Field("errorPages"), errpage.Merge(b.namespace.ErrorPages, route.ErrorPages))
+		if err != nil {
+			return err
+		}
+	}
+
 	patterns := b.generatePatterns(pattern, route.Methods)
+	servers := slices.Sorted(slices.Values(b.namespace.Servers))
+
+	fullChain := b.chain.chain.Extend(routeChain.chain)
+	modifiers := slices.Concat(b.chain.modifiers, routeChain.modifiers)
+	errHandler := buildErrHandler(b.log, b.errHandler, errPages, b.errHooks)
 
 	// Register all patterns
-	for _, pattern := range patterns {
-		if b.shouldSkipPattern(pattern, mount) {
-			continue
-		}
+	for _, mount := range b.namespace.Mounts {
+		for _, pattern := range patterns {
+			if b.shouldSkipPattern(pattern, mount) {
+				continue
+			}
 
-		handlerChain := nsChain.Extend(routeChain).Then(b.proxy.WithPathTrim(mount))
-		errCh := make(chan error, 1)
+			resultCh := make(chan registrationResult, 1)
+
+			entry := routeEntry{
+				RouteInfo: RouteInfo{
+					Namespace: b.name,
+					Mount:     mount,
+					Route:     routeCtx.Route,
+					Match:     match.String(),
+					Servers:   servers,
+					Plugins:   fullChain.Names(),
+				},
+				modifiers: modifiers,
+			}
 
-		b.registrationCh <- routeRegistration{
-			pattern: pattern,
-			handler: ika.ToHTTPHandler(handlerChain, buildErrHandler(b.log)),
-			mount:   mount,
-			err:     errCh,
-		}
+			b.registrationCh <- routeRegistration{
+				pattern: pattern,
+				candidate: candidate{
+					routeEntry: entry,
+					match:      match,
+					handler: upgrade.WithStats(proxy.WithResponseController(ika.ToHTTPHandler(
+						fullChain.Then(b.upgrades.Handler(upgradeOpts, routeProxy.WithPathTrim(mount))),
+						errHandler,
+					))),
+				},
+				mount:  mount,
+				result: resultCh,
+			}
 
-		if err := <-errCh; err != nil {
-			return err
+			res := <-resultCh
+			if res.err != nil {
+				return &config.PathError{Path: routePath, Err: res.err}
+			}
+
+			entry.Pattern = res.pattern
+			b.routes = append(b.routes, entry)
 		}
 	}
 
 	return nil
 }
 
+// routeProxy returns the proxy of a route, which streams responses as configured by s.
+func (b *nsBuilder) routeProxy(path config.Path, s config.Streaming) (*proxy.Proxy, error) {
+	if s.FlushImmediately && s.FlushInterval != 0 {
+		return nil, &config.PathError{Path: path, Err: errors.New("flushInterval and flushImmediately are mutually exclusive")}
+	}
+
+	streaming := proxy.Streaming{
+		FlushInterval:       s.FlushInterval.Dur(),
+		DisableWriteTimeout: s.DisableWriteTimeout,
+		DetectEventStream:   s.DetectEventStream == nil || *s.DetectEventStream,
+	}
+	if s.FlushImmediately {
+		streaming.FlushInterval = -1
+	}
+	return b.proxy.WithStreaming(streaming), nil
+}
+
 func (b *nsBuilder) generatePatterns(pattern string, methods []config.Method) []string {
 	if len(methods) == 0 {
 		return []string{pattern}
@@ -205,79 +355,148 @@ func (b *nsBuilder) shouldSkipPattern(pattern, mount string) bool {
 	return pattern == "" && !strings.Contains(mount, "/")
 }
 
-func (b *nsBuilder) createPlugin(ctx context.Context, ictx ika.InjectionContext, cfg config.Plugin) (ika.Plugin, error) {
+func (b *nsBuilder) createPlugin(ctx context.Context, ictx ika.InjectionContext, path config.Path, cfg config.Plugin) (ika.Plugin, error) {
+	plugin, teardown, err := b.plugins.create(ctx, ictx, path, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	b.teardowner = b.teardowner.Add(teardown)
+	return plugin, nil
+}
+
+// createPlugin creates the plugin declared by cfg at path using the matching factory.
+func createPlugin(ctx context.Context, factories map[string]ika.PluginFactory, ictx ika.InjectionContext, path config.Path, cfg config.Plugin) (ika.Plugin, error) {
 	ictx.Logger = ictx.Logger.With("plugin", cfg.Name)
 
-	factory, ok := b.factories[cfg.Name]
+	factory, ok := factories[cfg.Name]
 	if !ok {
-		return nil, fmt.Errorf("plugin %q not found", cfg.Name)
+		return nil, &config.PathError{Path: path.Field("name"), Err: fmt.Errorf("plugin %q not found", cfg.Name)}
+	}
+
+	if err := config.ValidatePluginConfig(factory, path.Field("config"), cfg.Config); err != nil {
+		return nil, err
 	}
 
 	plugin, err := factory.New(ctx, ictx, cfg.Config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create plugin %q: %w", cfg.Name, err)
+		return nil, &config.PathError{Path: path.Field("config"), Err: fmt.Errorf("failed to create plugin %q: %w", cfg.Name, err)}
 	}
-
-	b.teardowner.Add(plugin.Teardown)
 	return plugin, nil
 }
 
-func (b *nsBuilder) setupTransport(ctx context.Context, ictx ika.InjectionContext, transport http.RoundTripper) (http.RoundTripper, error) {
-	for _, cfg := range slices.Collect(b.namespace.Hooks.Enabled()) {
-		plugin, err := b.createPlugin(ctx, ictx, cfg)
+// declared is a plugin created for the declaration cfg at path.
+type declared struct {
+	cfg    config.Plugin
+	path   config.Path
+	plugin ika.Plugin
+}
+
+// createHooks creates the hooks of the namespace declared at path.
+// Every hook is created once and used for all the hook interfaces it implements.
+func (b *nsBuilder) createHooks(ctx context.Context, ictx ika.InjectionContext, path config.Path) ([]declared, error) {
+	var hooks []declared
+	for i, cfg := range b.namespace.Hooks.Ordered() {
+		path := path.Index(i)
+		plugin, err := b.createPlugin(ctx, ictx, path, cfg)
 		if err != nil {
-			return nil, err
+			if b.fail(err) != nil {
+				return nil, err
+			}
+			continue
 		}
+		hooks = append(hooks, declared{cfg: cfg, path: path, plugin: plugin})
+	}
+	return hooks, nil
+}
 
-		hooker, ok := plugin.(ika.TripperHook)
+// setupTransport wraps transport with the hooks implementing ika.TripperHook.
+func (b *nsBuilder) setupTransport(transport http.RoundTripper) (http.RoundTripper, error) {
+	for _, hook := range b.hooks {
+		hooker, ok := hook.plugin.(ika.TripperHook)
 		if !ok {
-			// TODO issue here, the created plugin is never teared down
 			continue // hooks does not have to implement every interface
 		}
 
+		var err error
 		transport, err = hooker.HookTripper(transport)
 		if err != nil {
-			return nil, err
+			return nil, &config.PathError{Path: hook.path, Err: err}
 		}
 	}
 	return transport, nil
 }
 
-func (b *nsBuilder) makeChain(ctx context.Context, ictx ika.InjectionContext, middlewares, reqModifiers, hooks config.Plugins) (chain.Chain, error) {
-	ch := chain.New()
-
-	// Add OnRequestHooks
-	for _, cfg := range hooks {
-		plugin, err := b.createPlugin(ctx, ictx, cfg)
-		if err != nil {
-			return chain.Chain{}, err
+// setupErrorHooks returns the hooks handling the errors of requests.
+func (b *nsBuilder) setupErrorHooks() []ika.ErrorHook {
+	var hooks []ika.ErrorHook
+	for _, hook := range b.hooks {
+		if hook, ok := hook.plugin.(ika.ErrorHook); ok {
+			hooks = append(hooks, hook)
 		}
+	}
+	return hooks
+}
+
+// fail returns err unless the builder is collecting errors,
+// in which case err is recorded and nil is returned.
+func (b *nsBuilder) fail(err error) error {
+	if err == nil || !b.collect {
+		return err
+	}
+	b.errs = append(b.errs, err)
+	return nil
+}
+
+// pluginChain is a chain built from the declarations of plugins.
+type pluginChain struct {
+	chain     chain.Chain
+	modifiers []ika.RequestModifier
+	// plugins describes the plugins of chain in the order requests flow through them
+	plugins []chainPlugin
+}
 
-		hooker, ok := plugin.(ika.OnRequestHook)
+// makeChain returns the chain of the hooks implementing ika.OnRequestHook,
+// followed by the request modifiers and middlewares declared at path.
+func (b *nsBuilder) makeChain(ctx context.Context, ictx ika.InjectionContext, path config.Path, middlewares, reqModifiers config.Plugins, hooks []declared) (pluginChain, error) {
+	var pc pluginChain
+
+	// Add OnRequestHooks
+	for _, hook := range hooks {
+		hooker, ok := hook.plugin.(ika.OnRequestHook)
 		if !ok {
-			// TODO issue here, the created plugin is never teared down
 			continue // hooks does not have to implement every interface
 		}
 
-		ch = ch.Append(chain.Constructor{
-			Name:           cfg.Name,
+		pc.chain = pc.chain.Append(chain.Constructor{
+			Name:           hook.cfg.Name,
 			MiddlewareFunc: hooker.Handler,
 		})
+		pc.plugins = append(pc.plugins, chainPlugin{name: hook.cfg.Name, path: hook.path, ignoreOrder: hook.cfg.IgnoreOrder})
 	}
 
 	// Add RequestModifiers
-	for _, cfg := range reqModifiers {
-		plugin, err := b.createPlugin(ctx, ictx, cfg)
+	for i, cfg := range reqModifiers.Ordered() {
+		path := path.Field("reqModifiers").Index(i)
+		plugin, err := b.createPlugin(ctx, ictx, path, cfg)
 		if err != nil {
-			return chain.Chain{}, err
+			if b.fail(err) != nil {
+				return pluginChain{}, err
+			}
+			continue
 		}
 
 		modifier, ok := plugin.(ika.RequestModifier)
 		if !ok {
-			return chain.Chain{}, fmt.Errorf("plugin %q is not a RequestModifier", cfg.Name)
+			err := &config.PathError{Path: path.Field("name"), Err: fmt.Errorf("plugin %q is not a RequestModifier", cfg.Name)}
+			if b.fail(err) != nil {
+				return pluginChain{}, err
+			}
+			continue
 		}
 
-		ch = ch.Append(chain.Constructor{
+		pc.modifiers = append(pc.modifiers, modifier)
+		pc.chain = pc.chain.Append(chain.Constructor{
 			Name: cfg.Name,
 			MiddlewareFunc: func(next ika.Handler) ika.Handler {
 				return ika.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
@@ -288,27 +507,37 @@ func (b *nsBuilder) makeChain(ctx context.Context, ictx ika.InjectionContext, mi
 				})
 			},
 		})
+		pc.plugins = append(pc.plugins, chainPlugin{name: cfg.Name, path: path, ignoreOrder: cfg.IgnoreOrder})
 	}
 
 	// Add Middlewares
-	for _, cfg := range middlewares {
-		plugin, err := b.createPlugin(ctx, ictx, cfg)
+	for i, cfg := range middlewares.Ordered() {
+		path := path.Field("middlewares").Index(i)
+		plugin, err := b.createPlugin(ctx, ictx, path, cfg)
 		if err != nil {
-			return chain.Chain{}, err
+			if b.fail(err) != nil {
+				return pluginChain{}, err
+			}
+			continue
 		}
 
 		mw, ok := plugin.(ika.Middleware)
 		if !ok {
-			return chain.Chain{}, fmt.Errorf("plugin %q is not a middleware", cfg.Name)
+			err := &config.PathError{Path: path.Field("name"), Err: fmt.Errorf("plugin %q is not a middleware", cfg.Name)}
+			if b.fail(err) != nil {
+				return pluginChain{}, err
+			}
+			continue
 		}
 
-		ch = ch.Append(chain.Constructor{
+		pc.chain = pc.chain.Append(chain.Constructor{
 			Name:           cfg.Name,
 			MiddlewareFunc: mw.Handler,
 		})
+		pc.plugins = append(pc.plugins, chainPlugin{name: cfg.Name, path: path, ignoreOrder: cfg.IgnoreOrder})
 	}
 
-	return ch, nil
+	return pc, nil
 }
 
 func (b *nsBuilder) teardown(ctx context.Context) error {
@@ -317,7 +546,12 @@ func (b *nsBuilder) teardown(ctx context.Context) error {
 	return b.teardowner.Teardown(ctx)
 }
 
-func makeTransport(cfg config.Transport) *http.Transport {
+func makeTransport(path config.Path, cfg config.Transport) (*http.Transport, error) {
+	tlsConfig, err := makeTLSConfig(path.Field("tls"), cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+
 	d := net.Dialer{
 		Timeout:       cfg.Dialer.Timeout.Dur(),
 		FallbackDelay: cfg.Dialer.FallbackDelay.Dur(),
@@ -328,8 +562,23 @@ func makeTransport(cfg config.Transport) *http.Transport {
 			Count:    cfg.Dialer.KeepAliveConfig.Count,
 		},
 	}
-	return &http.Transport{
-		DialContext:            d.DialContext,
+	proxyFunc, err := makeProxyFunc(path.Field("proxy"), cfg.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	res, err := newResolver(path.Field("resolver"), cfg.Resolver, &d)
+	if err != nil {
+		return nil, err
+	}
+	dial := d.DialContext
+	if res != nil {
+		dial = res.dialContext(&d)
+	}
+
+	t := &http.Transport{
+		Proxy:                  proxyFunc,
+		DialContext:            dial,
+		TLSClientConfig:        tlsConfig,
 		DisableKeepAlives:      cfg.DisableKeepAlives,
 		DisableCompression:     cfg.DisableCompression,
 		MaxIdleConns:           cfg.MaxIdleConns,
@@ -342,15 +591,43 @@ func makeTransport(cfg config.Transport) *http.Transport {
 		WriteBufferSize:        cfg.WriteBufferSize,
 		ReadBufferSize:         cfg.ReadBufferSize,
 	}
+	t.RegisterProtocol("unix", newUnixTransport(t, &d))
+	return t, nil
 }
 
-func buildErrHandler(log *slog.Logger) ika.ErrorHandler {
+// buildErrHandler returns an error handler logging errors and passing them through hooks,
+// then pages, if any, and finally base, or ika.DefaultErrorHandler if base is nil.
+// Requests whose client went away are answered with a bare status instead.
+func buildErrHandler(log *slog.Logger, base ika.ErrorHandler, pages *errpage.Pages, hooks []ika.ErrorHook) ika.ErrorHandler {
+	h := base
+	if h == nil {
+		h = ika.DefaultErrorHandler
+	}
+	if pages != nil {
+		h = pages.Handler(log, h)
+	}
+	for i := range hooks {
+		h = hooks[len(hooks)-1-i].ErrorHandler(h)
+	}
+
 	return func(w http.ResponseWriter, r *http.Request, err error) {
-		log.LogAttrs(r.Context(),
-			slog.LevelError,
-			"Error handling request",
+		attrs := []slog.Attr{
 			slog.String("path", request.GetPath(r)),
-			slog.String("error", err.Error()))
-		ika.DefaultErrorHandler(w, r, err)
+			slog.String("error", err.Error()),
+		}
+
+		var proxyErr *proxy.Error
+		if errors.As(err, &proxyErr) {
+			attrs = append(attrs, slog.String("class", proxyErr.Class()), slog.Int("status", proxyErr.Status()))
+			if proxyErr.ClientClosed() {
+				// nobody reads the response, the status only shows up in access logs
+				log.LogAttrs(r.Context(), slog.LevelDebug, "Client closed request", attrs...)
+				w.WriteHeader(proxyErr.Status())
+				return
+			}
+		}
+
+		log.LogAttrs(r.Context(), slog.LevelError, "Error handling request", attrs...)
+		h(w, r, err)
 	}
 }
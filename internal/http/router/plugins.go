@@ -0,0 +1,160 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+
+	"github.com/alx99/ika"
+	"github.com/alx99/ika/internal/config"
+	"github.com/alx99/ika/internal/teardown"
+)
+
+// pluginSet creates the plugins of a router and tracks them through their lifecycle.
+// Plugins implementing ika.Reloader are taken over from the router being replaced, if any,
+// instead of being created again.
+type pluginSet struct {
+	factories map[string]ika.PluginFactory
+	// prev holds the instances of the router being replaced by the path of their declaration,
+	// as every declaration is instantiated once
+	prev      map[config.Path]*instance
+	instances []*instance
+	// restore holds the configuration of the instances taken over and reloaded by this set,
+	// which is restored if the set is discarded instead of started
+	restore map[*instance]map[string]any
+}
+
+// instance is a plugin created for the declaration at path.
+type instance struct {
+	plugin ika.Plugin
+	name   string
+	path   config.Path
+	cfg    map[string]any
+	// owner is the set tearing down the instance
+	owner atomic.Pointer[pluginSet]
+	// cancel cancels the context the instance was started with
+	cancel context.CancelFunc
+}
+
+func newPluginSet(factories map[string]ika.PluginFactory) *pluginSet {
+	return &pluginSet{
+		factories: factories,
+		restore:   make(map[*instance]map[string]any),
+	}
+}
+
+// inherit makes the set take over the reloadable plugins of prev.
+func (s *pluginSet) inherit(prev *pluginSet) {
+	s.prev = make(map[config.Path]*instance, len(prev.instances))
+	for _, inst := range prev.instances {
+		s.prev[inst.path] = inst
+	}
+}
+
+// create returns the plugin declared by cfg at path and the function tearing it down.
+func (s *pluginSet) create(ctx context.Context, ictx ika.InjectionContext, path config.Path, cfg config.Plugin) (ika.Plugin, teardown.TeardownFunc, error) {
+	if inst, ok := s.prev[path]; ok && inst.name == cfg.Name {
+		if reloader, ok := inst.plugin.(ika.Reloader); ok {
+			if err := s.reload(ctx, inst, reloader, path, cfg); err != nil {
+				return nil, nil, err
+			}
+			s.instances = append(s.instances, inst)
+			return inst.plugin, s.teardownFunc(inst), nil
+		}
+	}
+
+	plugin, err := createPlugin(ctx, s.factories, ictx, path, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	inst := &instance{plugin: plugin, name: cfg.Name, path: path, cfg: cfg.Config}
+	inst.owner.Store(s)
+	s.instances = append(s.instances, inst)
+	return plugin, s.teardownFunc(inst), nil
+}
+
+// reload applies cfg to inst, which is taken over from the previous set.
+func (s *pluginSet) reload(ctx context.Context, inst *instance, reloader ika.Reloader, path config.Path, cfg config.Plugin) error {
+	if reflect.DeepEqual(inst.cfg, cfg.Config) {
+		return nil
+	}
+
+	if err := config.ValidatePluginConfig(s.factories[cfg.Name], path.Field("config"), cfg.Config); err != nil {
+		return err
+	}
+	if err := reloader.Reload(ctx, cfg.Config); err != nil {
+		return &config.PathError{Path: path.Field("config"), Err: fmt.Errorf("failed to reload plugin %q: %w", cfg.Name, err)}
+	}
+
+	s.restore[inst] = inst.cfg
+	inst.cfg = cfg.Config
+	return nil
+}
+
+// teardownFunc returns the function tearing down inst when the set is torn down.
+// Instances taken over by another set are left to it, and instances this set took over
+// without being started are handed back with their previous configuration.
+func (s *pluginSet) teardownFunc(inst *instance) teardown.TeardownFunc {
+	return func(ctx context.Context) error {
+		if inst.owner.Load() == s {
+			if inst.cancel != nil {
+				inst.cancel()
+			}
+			return inst.plugin.Teardown(ctx)
+		}
+
+		cfg, ok := s.restore[inst]
+		if !ok {
+			return nil
+		}
+		delete(s.restore, inst)
+		inst.cfg = cfg
+		if err := inst.plugin.(ika.Reloader).Reload(ctx, cfg); err != nil {
+			return &config.PathError{Path: inst.path.Field("config"), Err: fmt.Errorf("failed to restore plugin %q: %w", inst.name, err)}
+		}
+		return nil
+	}
+}
+
+// start starts the plugins created by the set and takes over the ones it inherited.
+func (s *pluginSet) start(ctx context.Context) error {
+	for _, inst := range s.instances {
+		if inst.owner.Load() != s || inst.cancel != nil {
+			continue // started by the previous set
+		}
+
+		ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		inst.cancel = cancel
+		starter, ok := inst.plugin.(ika.Starter)
+		if !ok {
+			continue
+		}
+		if err := starter.Start(ctx); err != nil {
+			return &config.PathError{Path: inst.path, Err: fmt.Errorf("failed to start plugin %q: %w", inst.name, err)}
+		}
+	}
+
+	for _, inst := range s.instances {
+		inst.owner.Store(s)
+	}
+	clear(s.restore)
+	return nil
+}
+
+// ready returns the reasons why the plugins of the set are not ready, if any.
+func (s *pluginSet) ready() error {
+	var errs []error
+	for _, inst := range s.instances {
+		readier, ok := inst.plugin.(ika.Readier)
+		if !ok {
+			continue
+		}
+		if err := readier.Ready(); err != nil {
+			errs = append(errs, &config.PathError{Path: inst.path, Err: fmt.Errorf("plugin %q is not ready: %w", inst.name, err)})
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -1,13 +1,20 @@
 package router
 
-import "sync"
+import (
+	"cmp"
+	"sync"
+)
+
+// defaultBufferSize is the size of the buffers if the namespace does not set one.
+const defaultBufferSize = 32 * 1024
 
 type bufferPool struct{ sync.Pool }
 
-func newBufferPool() *bufferPool {
+func newBufferPool(size int) *bufferPool {
+	size = cmp.Or(size, defaultBufferSize)
 	return &bufferPool{Pool: sync.Pool{
 		New: func() any {
-			s := make([]byte, 32*1024)
+			s := make([]byte, size)
 			return &s
 		},
 	}}
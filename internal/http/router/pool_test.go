@@ -6,7 +6,7 @@ import (
 )
 
 func BenchmarkBufferPool(b *testing.B) {
-	var bp httputil.BufferPool = newBufferPool()
+	var bp httputil.BufferPool = newBufferPool(0)
 	for b.Loop() {
 		buf := bp.Get()
 		bp.Put(buf)
@@ -1,39 +1,96 @@
 package router
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"log/slog"
+	"maps"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/alx99/ika/internal/config"
 	"github.com/alx99/ika/internal/teardown"
+	"github.com/alx99/ika/request"
 )
 
 type Router struct {
 	tder teardown.Teardowner
-	mux  *http.ServeMux
-	cfg  config.Config
-	opts config.ComptimeOpts
-	log  *slog.Logger
+	// muxes holds the routes served on every server by server name
+	muxes map[string]*serverMux
+	// fallback holds the routes of the namespaces not bound to any server,
+	// serving requests received by servers without a mux
+	fallback *serverMux
+	cfg      config.Config
+	opts     config.ComptimeOpts
+	log      *slog.Logger
+	plugins  *pluginSet
+
+	routes []routeEntry
+	// warnings holds the ordering constraints broken by plugins ignoring their order
+	warnings config.Problems
+	// servers holds the hooks of the servers declaring any by server name, wrapping their mux
+	servers map[string]http.Handler
 }
 
 func New(cfg config.Config, opts config.ComptimeOpts, log *slog.Logger) (*Router, error) {
+	muxes := make(map[string]*serverMux)
+	for _, s := range cfg.Servers {
+		muxes[s.ServerName()] = newServerMux()
+	}
+	for _, ns := range cfg.Namespaces {
+		for _, name := range ns.Servers {
+			if _, ok := muxes[name]; !ok {
+				muxes[name] = newServerMux()
+			}
+		}
+	}
+
 	return &Router{
-		tder: make(teardown.Teardowner, 0),
-		mux:  http.NewServeMux(),
-		cfg:  cfg,
-		opts: opts,
-		log:  log,
+		tder:     make(teardown.Teardowner, 0),
+		muxes:    muxes,
+		fallback: newServerMux(),
+		cfg:      cfg,
+		opts:     opts,
+		log:      log,
+		plugins:  newPluginSet(opts.Plugins),
 	}, nil
 }
 
+// nsMuxes returns the muxes the routes of ns are registered on.
+// Routes of namespaces bound to servers are only registered on the muxes of those servers,
+// so they cannot shadow the routes of other servers.
+func (r *Router) nsMuxes(ns config.Namespace) []*serverMux {
+	if len(ns.Servers) == 0 {
+		muxes := []*serverMux{r.fallback}
+		for _, name := range slices.Sorted(maps.Keys(r.muxes)) {
+			muxes = append(muxes, r.muxes[name])
+		}
+		return muxes
+	}
+
+	muxes := make([]*serverMux, 0, len(ns.Servers))
+	for _, name := range slices.Sorted(slices.Values(ns.Servers)) {
+		muxes = append(muxes, r.muxes[name])
+	}
+	return slices.Compact(muxes)
+}
+
+// muxOf returns the mux routing the requests received by the server with the given name.
+func (r *Router) muxOf(server string) *serverMux {
+	if m, ok := r.muxes[server]; ok {
+		return m
+	}
+	return r.fallback
+}
+
 func (r *Router) Build(ctx context.Context) error {
 	r.log.Info("Building router", "namespaceCount", len(r.cfg.Namespaces))
 
 	for nsName, ns := range r.cfg.Namespaces {
 		now := time.Now()
-		builder, err := newNSBuilder(ctx, r.mux, nsName, ns, r.log, r.opts.Plugins)
+		builder, err := newNSBuilder(ctx, r.nsMuxes(ns), r.plugins, nsName, ns, r.log, r.opts)
 		if err != nil {
 			return err
 		}
@@ -41,15 +98,91 @@ func (r *Router) Build(ctx context.Context) error {
 		if err := builder.build(ctx); err != nil {
 			return err
 		}
-		r.tder.Add(builder.teardown)
+		r.tder = r.tder.Add(builder.teardown)
+		r.routes = append(r.routes, builder.routes...)
+		r.warnings = append(r.warnings, builder.warnings...)
 		r.log.Debug("Built namespace", "ns", nsName, "dur", time.Since(now))
 	}
 
-	return nil
+	err := r.buildServers(ctx)
+	// plugins of a namespace are checked for every route of it
+	r.warnings = compactProblems(r.warnings)
+	return err
+}
+
+// Warnings returns the ordering constraints broken by plugins ignoring their order,
+// as found by Build. Each of them is reported once.
+func (r *Router) Warnings() config.Problems {
+	return r.warnings
+}
+
+// Validate builds every namespace without stopping at the first error
+// and returns all problems that were found.
+// The router must not be used to serve requests afterwards.
+func (r *Router) Validate(ctx context.Context) config.Problems {
+	var problems config.Problems
+
+	for nsName, ns := range r.cfg.Namespaces {
+		builder, err := newNSBuilder(ctx, r.nsMuxes(ns), r.plugins, nsName, ns, r.log, r.opts)
+		if err != nil {
+			problems = append(problems, config.ToProblems(err)...)
+			continue
+		}
+		builder.collect = true
+
+		err = builder.build(ctx)
+		if err == nil {
+			err = builder.teardown(ctx)
+		}
+		problems = append(problems, config.ToProblems(errors.Join(err, errors.Join(builder.errs...)))...)
+		problems = append(problems, builder.warnings...)
+	}
+
+	err := r.buildServers(ctx)
+	problems = append(problems, config.ToProblems(errors.Join(err, r.tder.Teardown(ctx)))...)
+	problems = append(problems, r.warnings...)
+
+	return compactProblems(problems)
+}
+
+// compactProblems sorts problems by path and removes duplicates.
+func compactProblems(problems config.Problems) config.Problems {
+	slices.SortFunc(problems, func(a, b config.Problem) int {
+		return cmp.Or(cmp.Compare(a.Path, b.Path), cmp.Compare(a.Message, b.Message))
+	})
+	return slices.Compact(problems)
+}
+
+// Inherit makes Build take over the plugins of prev that implement ika.Reloader, reloading them
+// with their new configuration, instead of creating them again.
+// prev keeps serving requests with them until r is started; if r is shut down instead,
+// they are reloaded with their previous configuration.
+func (r *Router) Inherit(prev *Router) {
+	r.plugins.inherit(prev.plugins)
+}
+
+// Start starts the plugins of the router implementing ika.Starter and takes over the plugins
+// inherited from the previous router, which then no longer tears them down.
+// It is called once the servers are listening, or before the router replaces the previous one.
+func (r *Router) Start(ctx context.Context) error {
+	return r.plugins.start(ctx)
+}
+
+// Ready returns nil if all plugins implementing ika.Readier are ready,
+// or an error describing the ones that are not.
+func (r *Router) Ready() error {
+	return r.plugins.ready()
 }
 
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	r.mux.ServeHTTP(w, req)
+	// plugins share what they know about the request through its attributes
+	req = request.WithAttributes(req)
+
+	if h, ok := r.servers[request.Server(req.Context())]; ok {
+		h.ServeHTTP(w, req)
+		return
+	}
+	r.muxOf(request.Server(req.Context())).mux.ServeHTTP(w, req)
 }
 
 // Shutdown shuts down the router
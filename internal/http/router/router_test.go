@@ -0,0 +1,1035 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/alx99/ika"
+	"github.com/alx99/ika/internal/config"
+	"github.com/alx99/ika/request"
+	"github.com/matryer/is"
+)
+
+type testFactory struct {
+	name string
+	err  error
+}
+
+func (f *testFactory) Name() string { return f.name }
+
+func (f *testFactory) New(context.Context, ika.InjectionContext, map[string]any) (ika.Plugin, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &testPlugin{}, nil
+}
+
+type testPlugin struct{}
+
+func (*testPlugin) Teardown(context.Context) error { return nil }
+
+type hostModifierFactory struct{}
+
+func (*hostModifierFactory) Name() string { return "host" }
+
+func (*hostModifierFactory) New(_ context.Context, _ ika.InjectionContext, cfg map[string]any) (ika.Plugin, error) {
+	return &hostModifier{host: cfg["host"].(string)}, nil
+}
+
+type hostModifier struct {
+	testPlugin
+	host string
+}
+
+func (m *hostModifier) ModifyRequest(r *http.Request) error {
+	r.URL.Scheme = "https"
+	r.URL.Host = m.host
+	r.Host = m.host
+	return nil
+}
+
+func TestRouter_Validate(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	cfg := config.Config{
+		Namespaces: config.Namespaces{
+			"ns1": {
+				Mounts: []string{"/a"},
+				Hooks:  config.Plugins{{Name: "missing"}},
+				Routes: config.Routes{
+					"/x": {Middlewares: config.Plugins{{Name: "noop"}, {Name: "broken"}}},
+				},
+			},
+			"ns2": {
+				Mounts: []string{"/b"},
+				Routes: config.Routes{
+					"/y": {ReqModifiers: config.Plugins{{Name: "noop"}}},
+					"/z": {Streaming: config.Streaming{FlushImmediately: true, FlushInterval: config.Duration(time.Second)}},
+				},
+			},
+			"ns3": {
+				Mounts:     []string{"/c"},
+				BufferSize: -1,
+			},
+		},
+	}
+	opts := config.ComptimeOpts{Plugins: map[string]ika.PluginFactory{
+		"noop":   &testFactory{name: "noop"},
+		"broken": &testFactory{name: "broken", err: errors.New("bad config")},
+	}}
+
+	r, err := New(cfg, opts, slog.New(slog.DiscardHandler))
+	is.NoErr(err)
+
+	is.Equal(r.Validate(t.Context()), config.Problems{
+		{Path: "$.namespaces.ns1.hooks[0].name", Message: `plugin "missing" not found`},
+		{Path: "$.namespaces.ns1.routes['/x'].middlewares[0].name", Message: `plugin "noop" is not a middleware`},
+		{Path: "$.namespaces.ns1.routes['/x'].middlewares[1].config", Message: `failed to create plugin "broken": bad config`},
+		{Path: "$.namespaces.ns2.routes['/y'].reqModifiers[0].name", Message: `plugin "noop" is not a RequestModifier`},
+		{Path: "$.namespaces.ns2.routes['/z'].streaming", Message: "flushInterval and flushImmediately are mutually exclusive"},
+		{Path: "$.namespaces.ns3.bufferSize", Message: "must not be negative"},
+	})
+}
+
+func TestRouter_Match(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	cfg := config.Config{
+		Namespaces: config.Namespaces{
+			"api": {
+				Mounts: []string{"/api"},
+				Routes: config.Routes{
+					"/users/{id}": {
+						Methods:      []config.Method{http.MethodGet},
+						ReqModifiers: config.Plugins{{Name: "host", Config: map[string]any{"host": "users.internal"}}},
+					},
+				},
+			},
+		},
+	}
+	opts := config.ComptimeOpts{Plugins: map[string]ika.PluginFactory{"host": &hostModifierFactory{}}}
+
+	r, err := New(cfg, opts, slog.New(slog.DiscardHandler))
+	is.NoErr(err)
+	is.NoErr(r.Build(t.Context()))
+	t.Cleanup(func() { _ = r.Shutdown(context.Background()) })
+
+	is.Equal(r.Routes(), []RouteInfo{{
+		Namespace: "api",
+		Mount:     "/api",
+		Route:     "/users/{id}",
+		Pattern:   "GET /api/users/{id}",
+		Plugins:   []string{"host"},
+	}})
+
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "http://gateway/api/users/1?a=b", nil)
+	res, err := r.Match(req)
+	is.NoErr(err)
+	is.Equal(res.Pattern, "GET /api/users/{id}")
+	is.Equal(res.TrimmedPath, "/users/1")
+	is.Equal(res.Upstream.URL.String(), "https://users.internal/users/1?a=b")
+	is.Equal(req.URL.String(), "http://gateway/api/users/1?a=b") // original request is untouched
+
+	req = httptest.NewRequestWithContext(t.Context(), http.MethodPost, "http://gateway/api/users/1", nil)
+	_, err = r.Match(req)
+	is.True(errors.Is(err, ErrNoMatch)) // method does not match
+}
+
+func TestRouter_matchConditions(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Config{
+		Namespaces: config.Namespaces{
+			"acme": {
+				Mounts: []string{""},
+				Routes: config.Routes{
+					"/app": {Match: config.Match{Headers: map[string]config.ValueMatch{"x-tenant": {Value: "acme"}}}},
+				},
+			},
+			"beta": {
+				Mounts: []string{""},
+				Routes: config.Routes{
+					"/app": {Match: config.Match{
+						Query:   map[string]config.ValueMatch{"beta": {Regex: "^(1|true)$"}},
+						Cookies: map[string]config.ValueMatch{"session": {Regex: "."}},
+					}},
+				},
+			},
+			"default": {
+				Mounts: []string{""},
+				Routes: config.Routes{"/app": {}},
+			},
+		},
+	}
+
+	r, err := New(cfg, config.ComptimeOpts{}, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Build(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = r.Shutdown(context.Background()) })
+
+	tests := []struct {
+		name    string
+		target  string
+		header  http.Header
+		wantNS  string
+		wantErr error
+	}{
+		{name: "header", target: "/app", header: http.Header{"X-Tenant": {"acme"}}, wantNS: "acme"},
+		{name: "any header value", target: "/app", header: http.Header{"X-Tenant": {"other", "acme"}}, wantNS: "acme"},
+		{name: "query and cookie", target: "/app?beta=true", header: http.Header{"Cookie": {"session=abc"}}, wantNS: "beta"},
+		{name: "missing cookie falls through", target: "/app?beta=1", wantNS: "default"},
+		{name: "other tenant falls through", target: "/app", header: http.Header{"X-Tenant": {"other"}}, wantNS: "default"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			is := is.New(t)
+
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "http://gateway"+tt.target, nil)
+			req.Header = tt.header.Clone()
+			if req.Header == nil {
+				req.Header = http.Header{}
+			}
+
+			res, err := r.Match(req)
+			is.NoErr(err)
+			is.Equal(res.Namespace, tt.wantNS) // unexpected namespace
+		})
+	}
+}
+
+func TestRouter_matchConditionsWithoutFallback(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	cfg := config.Config{
+		Namespaces: config.Namespaces{
+			"acme": {
+				Mounts: []string{""},
+				Routes: config.Routes{
+					"/app": {Match: config.Match{Headers: map[string]config.ValueMatch{"X-Tenant": {Value: "acme"}}}},
+				},
+			},
+		},
+	}
+
+	r, err := New(cfg, config.ComptimeOpts{}, slog.New(slog.DiscardHandler))
+	is.NoErr(err)
+	is.NoErr(r.Build(t.Context()))
+	t.Cleanup(func() { _ = r.Shutdown(context.Background()) })
+
+	is.Equal(r.Routes()[0].Match, "header X-Tenant=acme")
+
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "http://gateway/app", nil)
+	_, err = r.Match(req)
+	is.True(errors.Is(err, ErrNoMatch)) // conditions are not satisfied
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	is.Equal(rec.Code, http.StatusNotFound)
+}
+
+type respondFactory struct{}
+
+func (*respondFactory) Name() string { return "respond" }
+
+func (*respondFactory) New(_ context.Context, _ ika.InjectionContext, cfg map[string]any) (ika.Plugin, error) {
+	return &respond{name: cfg["name"].(string)}, nil
+}
+
+// respond answers requests itself, naming the route and the value of its wildcard x.
+type respond struct {
+	testPlugin
+	name string
+}
+
+func (p *respond) Handler(ika.Handler) ika.Handler {
+	return ika.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		w.Header().Set("X-Route", p.name)
+		w.Header().Set("X-Value", r.PathValue("x"))
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	})
+}
+
+func TestRouter_matchFallThrough(t *testing.T) {
+	t.Parallel()
+
+	respondWith := func(name string) config.Plugins {
+		return config.Plugins{{Name: "respond", Config: map[string]any{"name": name}}}
+	}
+	cfg := config.Config{
+		Namespaces: config.Namespaces{
+			"acme": {
+				Mounts: []string{""},
+				Routes: config.Routes{
+					"/api/{x}": {
+						Methods:     []config.Method{http.MethodGet},
+						Match:       config.Match{Headers: map[string]config.ValueMatch{"X-Tenant": {Value: "acme"}}},
+						Middlewares: respondWith("acme"),
+					},
+				},
+			},
+			"beta": {
+				Mounts: []string{""},
+				Routes: config.Routes{
+					"/api/{x}": {
+						Match:       config.Match{Query: map[string]config.ValueMatch{"beta": {Value: "1"}}},
+						Middlewares: respondWith("beta"),
+					},
+				},
+			},
+			"public": {
+				Mounts: []string{""},
+				Routes: config.Routes{"/api/": {Middlewares: respondWith("public")}},
+			},
+		},
+	}
+
+	r, err := New(cfg, config.ComptimeOpts{Plugins: map[string]ika.PluginFactory{"respond": &respondFactory{}}}, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Build(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = r.Shutdown(context.Background()) })
+
+	tests := []struct {
+		name      string
+		target    string
+		header    http.Header
+		wantRoute string
+		wantValue string
+	}{
+		{name: "most specific route", target: "/api/a", header: http.Header{"X-Tenant": {"acme"}}, wantRoute: "acme", wantValue: "a"},
+		{name: "next less specific route", target: "/api/a?beta=1", wantRoute: "beta", wantValue: "a"},
+		{name: "least specific route", target: "/api/a", wantRoute: "public"},
+		{name: "only less specific routes match the path", target: "/api/a/b", header: http.Header{"X-Tenant": {"acme"}}, wantRoute: "public"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			is := is.New(t)
+
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "http://gateway"+tt.target, nil)
+			for name, values := range tt.header {
+				req.Header[name] = values
+			}
+
+			res, err := r.Match(req)
+			is.NoErr(err)
+			is.Equal(res.Namespace, tt.wantRoute) // namespace of the matching route
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			is.Equal(rec.Code, http.StatusNoContent)
+			is.Equal(rec.Header().Get("X-Route"), tt.wantRoute) // route handling the request
+			is.Equal(rec.Header().Get("X-Value"), tt.wantValue) // wildcards of the route handling the request
+		})
+	}
+}
+
+func TestRouter_duplicatePattern(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	cfg := config.Config{
+		Namespaces: config.Namespaces{
+			"a": {Mounts: []string{""}, Routes: config.Routes{"/app": {}}},
+			"b": {Mounts: []string{""}, Routes: config.Routes{"/app": {}}},
+		},
+	}
+
+	r, err := New(cfg, config.ComptimeOpts{}, slog.New(slog.DiscardHandler))
+	is.NoErr(err)
+
+	problems := r.Validate(t.Context())
+	is.Equal(len(problems), 1)                                           // one of the namespaces conflicts
+	is.True(strings.Contains(problems[0].Message, "already registered")) // conflict is reported
+}
+
+func TestRouter_upgradeDisabled(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	cfg := config.Config{
+		Namespaces: config.Namespaces{
+			"ns": {
+				Mounts: []string{""},
+				Routes: config.Routes{"/ws": {Upgrade: config.Upgrade{Disabled: true}}},
+			},
+		},
+	}
+
+	r, err := New(cfg, config.ComptimeOpts{}, slog.New(slog.DiscardHandler))
+	is.NoErr(err)
+	is.NoErr(r.Build(t.Context()))
+	t.Cleanup(func() { _ = r.Shutdown(context.Background()) })
+
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "http://gateway/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	is.Equal(rec.Code, http.StatusForbidden) // upgrade is rejected before reaching the upstream
+}
+
+type teardownCounter struct {
+	testPlugin
+	count *atomic.Int32
+}
+
+func (p *teardownCounter) Teardown(context.Context) error {
+	p.count.Add(1)
+	return nil
+}
+
+type teardownCounterFactory struct{ count atomic.Int32 }
+
+func (*teardownCounterFactory) Name() string { return "counter" }
+
+func (f *teardownCounterFactory) New(context.Context, ika.InjectionContext, map[string]any) (ika.Plugin, error) {
+	return &teardownCounter{count: &f.count}, nil
+}
+
+func TestRouter_Shutdown(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	factory := &teardownCounterFactory{}
+	cfg := config.Config{
+		Namespaces: config.Namespaces{
+			"ns": {
+				Mounts: []string{""},
+				Hooks:  config.Plugins{{Name: "counter"}},
+				Routes: config.Routes{"/a": {}},
+			},
+		},
+	}
+
+	r, err := New(cfg, config.ComptimeOpts{Plugins: map[string]ika.PluginFactory{"counter": factory}}, slog.New(slog.DiscardHandler))
+	is.NoErr(err)
+	is.NoErr(r.Build(t.Context()))
+	is.Equal(factory.count.Load(), int32(0))
+
+	is.NoErr(r.Shutdown(t.Context()))
+	is.True(factory.count.Load() > 0) // plugins are torn down
+}
+
+type headerHookFactory struct{}
+
+func (*headerHookFactory) Name() string { return "header" }
+
+func (*headerHookFactory) New(context.Context, ika.InjectionContext, map[string]any) (ika.Plugin, error) {
+	return &headerHook{}, nil
+}
+
+type headerHook struct{ testPlugin }
+
+func (*headerHook) Handler(next ika.Handler) ika.Handler {
+	return ika.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		w.Header().Set("X-Server-Hook", request.Server(r.Context()))
+		return next.ServeHTTP(w, r)
+	})
+}
+
+func TestRouter_servers(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	cfg := config.Config{
+		Servers: []config.Server{{Name: "public"}, {Name: "admin", Hooks: config.Plugins{{Name: "header"}}}},
+		Namespaces: config.Namespaces{
+			"public": {Mounts: []string{""}, Servers: []string{"public"}, Routes: config.Routes{"/status": {}}},
+			"admin": {
+				Mounts:  []string{""},
+				Servers: []string{"admin"},
+				Routes:  config.Routes{"/status": {ReqModifiers: config.Plugins{{Name: "host", Config: map[string]any{"host": "admin.internal"}}}}},
+			},
+			"shared": {Mounts: []string{""}, Routes: config.Routes{"/health": {}}},
+		},
+	}
+	opts := config.ComptimeOpts{Plugins: map[string]ika.PluginFactory{
+		"host":   &hostModifierFactory{},
+		"header": &headerHookFactory{},
+	}}
+
+	r, err := New(cfg, opts, slog.New(slog.DiscardHandler))
+	is.NoErr(err)
+	is.Equal(len(r.Validate(t.Context())), 0) // the same pattern may be bound to different servers
+
+	r, err = New(cfg, opts, slog.New(slog.DiscardHandler))
+	is.NoErr(err)
+	is.NoErr(r.Build(t.Context()))
+	t.Cleanup(func() { _ = r.Shutdown(context.Background()) })
+
+	newRequest := func(server, path string) *http.Request {
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "http://gateway"+path, nil)
+		return req.WithContext(request.WithServer(req.Context(), server))
+	}
+
+	tests := []struct {
+		server    string
+		path      string
+		wantNS    string
+		wantNoHit bool
+	}{
+		{server: "public", path: "/status", wantNS: "public"},
+		{server: "admin", path: "/status", wantNS: "admin"},
+		{server: "other", path: "/status", wantNoHit: true},
+		{server: "public", path: "/health", wantNS: "shared"},
+		{server: "admin", path: "/health", wantNS: "shared"},
+	}
+	for _, tt := range tests {
+		res, err := r.Match(newRequest(tt.server, tt.path))
+		if tt.wantNoHit {
+			is.True(errors.Is(err, ErrNoMatch)) // namespaces bound to servers are not reachable on others
+			continue
+		}
+		is.NoErr(err)
+		is.Equal(res.Namespace, tt.wantNS)
+	}
+
+	// hooks of a server run for every request it receives, even unrouted ones
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, newRequest("admin", "/missing"))
+	is.Equal(rec.Code, http.StatusNotFound)
+	is.Equal(rec.Header().Get("X-Server-Hook"), "admin")
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, newRequest("public", "/missing"))
+	is.Equal(rec.Header().Get("X-Server-Hook"), "") // only the hooks of the receiving server run
+}
+
+func TestRouter_serverMuxes(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	cfg := config.Config{
+		Servers: []config.Server{{Name: "public"}, {Name: "admin"}, {Name: "ops"}},
+		Namespaces: config.Namespaces{
+			"public": {Mounts: []string{""}, Routes: config.Routes{"/": {}}},
+			"admin":  {Mounts: []string{""}, Servers: []string{"admin"}, Routes: config.Routes{"/admin/": {}}},
+			// the patterns of ops and internal conflict on a shared mux, but the namespaces never share a server
+			"ops":      {Mounts: []string{""}, Servers: []string{"ops"}, Routes: config.Routes{"/{id}/items": {}}},
+			"internal": {Mounts: []string{""}, Servers: []string{"public"}, Routes: config.Routes{"/users/{rest...}": {}}},
+		},
+	}
+
+	r, err := New(cfg, config.ComptimeOpts{}, slog.New(slog.DiscardHandler))
+	is.NoErr(err)
+	is.Equal(len(r.Validate(t.Context())), 0)
+
+	r, err = New(cfg, config.ComptimeOpts{}, slog.New(slog.DiscardHandler))
+	is.NoErr(err)
+	is.NoErr(r.Build(t.Context()))
+	t.Cleanup(func() { _ = r.Shutdown(context.Background()) })
+
+	tests := []struct {
+		server string
+		path   string
+		wantNS string
+	}{
+		{server: "public", path: "/admin/x", wantNS: "public"}, // not shadowed by the admin route
+		{server: "admin", path: "/admin/x", wantNS: "admin"},
+		{server: "admin", path: "/other", wantNS: "public"},
+		{server: "public", path: "/users/items", wantNS: "internal"},
+		{server: "ops", path: "/users/items", wantNS: "ops"},
+		{server: "admin", path: "/users/items", wantNS: "public"},
+		{server: "", path: "/admin/x", wantNS: "public"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "http://gateway"+tt.path, nil)
+		res, err := r.Match(req.WithContext(request.WithServer(req.Context(), tt.server)))
+		is.NoErr(err)
+		is.Equal(res.Namespace, tt.wantNS) // namespace handling the request on the server
+	}
+}
+
+func TestRouter_serverHookNotOnRequest(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	cfg := config.Config{
+		Servers:    []config.Server{{Addr: ":8080", Hooks: config.Plugins{{Name: "host", Config: map[string]any{"host": "a"}}}}},
+		Namespaces: config.Namespaces{"ns": {Mounts: []string{""}, Routes: config.Routes{"/a": {}}}},
+	}
+	r, err := New(cfg, config.ComptimeOpts{Plugins: map[string]ika.PluginFactory{"host": &hostModifierFactory{}}}, slog.New(slog.DiscardHandler))
+	is.NoErr(err)
+
+	is.Equal(r.Validate(t.Context()), config.Problems{
+		{Path: "$.servers[0].hooks[0].name", Message: `plugin "host" is not an OnRequestHook`},
+	})
+}
+
+type failModifierFactory struct{}
+
+func (*failModifierFactory) Name() string { return "fail" }
+
+func (*failModifierFactory) New(context.Context, ika.InjectionContext, map[string]any) (ika.Plugin, error) {
+	return &failModifier{}, nil
+}
+
+type failModifier struct{ testPlugin }
+
+func (*failModifier) ModifyRequest(*http.Request) error { return errors.New("boom") }
+
+type teapotError struct{ error }
+
+func (teapotError) Status() int { return http.StatusTeapot }
+
+type errorHookFactory struct{}
+
+func (*errorHookFactory) Name() string { return "teapot" }
+
+func (*errorHookFactory) New(context.Context, ika.InjectionContext, map[string]any) (ika.Plugin, error) {
+	return &errorHook{}, nil
+}
+
+type errorHook struct{ testPlugin }
+
+func (*errorHook) ErrorHandler(next ika.ErrorHandler) ika.ErrorHandler {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		w.Header().Set("X-Error-Hook", err.Error())
+		next(w, r, teapotError{err})
+	}
+}
+
+func TestRouter_errorHandler(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	cfg := config.Config{
+		Namespaces: config.Namespaces{
+			"ns": {
+				Mounts: []string{""},
+				Hooks:  config.Plugins{{Name: "teapot"}},
+				Routes: config.Routes{"/a": {ReqModifiers: config.Plugins{{Name: "fail"}}}},
+			},
+		},
+	}
+	opts := config.ComptimeOpts{
+		Plugins: map[string]ika.PluginFactory{
+			"fail":   &failModifierFactory{},
+			"teapot": &errorHookFactory{},
+		},
+		ErrorHandler: func(w http.ResponseWriter, _ *http.Request, err error) {
+			var status interface{ Status() int }
+			if errors.As(err, &status) {
+				w.WriteHeader(status.Status())
+			}
+			_, _ = w.Write([]byte("envelope: " + err.Error()))
+		},
+	}
+
+	r, err := New(cfg, opts, slog.New(slog.DiscardHandler))
+	is.NoErr(err)
+	is.NoErr(r.Build(t.Context()))
+	t.Cleanup(func() { _ = r.Shutdown(context.Background()) })
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequestWithContext(t.Context(), http.MethodGet, "http://gateway/a", nil))
+	is.Equal(rec.Header().Get("X-Error-Hook"), "boom") // the hook sees the error first
+	is.Equal(rec.Code, http.StatusTeapot)              // the error replaced by the hook is passed on
+	is.Equal(rec.Body.String(), "envelope: boom")      // the gateway error handler writes the response
+}
+
+type failTripperFactory struct{}
+
+func (*failTripperFactory) Name() string { return "unreachable" }
+
+func (*failTripperFactory) New(context.Context, ika.InjectionContext, map[string]any) (ika.Plugin, error) {
+	return &failTripper{}, nil
+}
+
+type failTripper struct{ testPlugin }
+
+func (*failTripper) HookTripper(http.RoundTripper) (http.RoundTripper, error) {
+	return failTripper{}, nil
+}
+
+func (failTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	if err := r.Context().Err(); err != nil {
+		return nil, err
+	}
+	return nil, &net.OpError{Op: "dial", Net: "tcp", Err: &os.SyscallError{Syscall: "connect", Err: syscall.ECONNREFUSED}}
+}
+
+func TestRouter_upstreamErrors(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	cfg := config.Config{
+		Namespaces: config.Namespaces{
+			"ns": {Mounts: []string{""}, Hooks: config.Plugins{{Name: "unreachable"}}, Routes: config.Routes{"/a": {}}},
+		},
+	}
+	var handled atomic.Int32
+	opts := config.ComptimeOpts{
+		Plugins: map[string]ika.PluginFactory{"unreachable": &failTripperFactory{}},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			handled.Add(1)
+			var typed interface{ TypeURI() string }
+			is.True(errors.As(err, &typed)) // upstream errors carry a type URI
+			is.Equal(typed.TypeURI(), "https://ika.dozy.dev/guide/errors#upstream-refused")
+			ika.DefaultErrorHandler(w, r, err)
+		},
+	}
+
+	r, err := New(cfg, opts, slog.New(slog.DiscardHandler))
+	is.NoErr(err)
+	is.NoErr(r.Build(t.Context()))
+	t.Cleanup(func() { _ = r.Shutdown(context.Background()) })
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequestWithContext(t.Context(), http.MethodGet, "http://gateway/a", nil))
+	is.Equal(rec.Code, http.StatusServiceUnavailable) // the refused connection is reported as such
+	is.Equal(handled.Load(), int32(1))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequestWithContext(ctx, http.MethodGet, "http://gateway/a", nil))
+	is.Equal(rec.Code, 499)            // the client went away
+	is.Equal(handled.Load(), int32(1)) // the error is not handled as a failure
+}
+
+type dependentFactory struct {
+	name string
+	deps ika.Dependencies
+}
+
+func (f *dependentFactory) Name() string                   { return f.name }
+func (f *dependentFactory) Dependencies() ika.Dependencies { return f.deps }
+func (f *dependentFactory) New(context.Context, ika.InjectionContext, map[string]any) (ika.Plugin, error) {
+	return &passMiddleware{}, nil
+}
+
+type passMiddleware struct{ testPlugin }
+
+func (*passMiddleware) Handler(next ika.Handler) ika.Handler { return next }
+
+func TestRouter_dependencies(t *testing.T) {
+	t.Parallel()
+
+	opts := config.ComptimeOpts{Plugins: map[string]ika.PluginFactory{
+		"request-id": &dependentFactory{name: "request-id"},
+		"auth":       &dependentFactory{name: "auth"},
+		"log":        &dependentFactory{name: "log", deps: ika.Dependencies{After: []string{"request-id"}}},
+		"authz":      &dependentFactory{name: "authz", deps: ika.Dependencies{Requires: []string{"auth"}}},
+		"ban":        &dependentFactory{name: "ban", deps: ika.Dependencies{Before: []string{"auth"}}},
+	}}
+
+	tests := []struct {
+		name         string
+		ns           config.Namespace
+		wantPlugins  []string
+		wantProblems config.Problems
+		// wantWarnings are reported by Validate, but do not fail Build
+		wantWarnings config.Problems
+	}{
+		{
+			name: "satisfied across levels",
+			ns: config.Namespace{
+				Hooks:       config.Plugins{{Name: "request-id"}},
+				Middlewares: config.Plugins{{Name: "ban"}, {Name: "auth"}},
+				Routes:      config.Routes{"/a": {Middlewares: config.Plugins{{Name: "log"}, {Name: "authz"}}}},
+			},
+			wantPlugins: []string{"request-id", "ban", "auth", "log", "authz"},
+		},
+		{
+			name: "optional plugins missing",
+			ns: config.Namespace{
+				Routes: config.Routes{"/a": {Middlewares: config.Plugins{{Name: "log"}, {Name: "ban"}}}},
+			},
+			wantPlugins: []string{"log", "ban"},
+		},
+		{
+			name: "priority reorders",
+			ns: config.Namespace{
+				Routes: config.Routes{"/a": {Middlewares: config.Plugins{
+					{Name: "authz"},
+					{Name: "log"},
+					{Name: "auth", Priority: 10},
+					{Name: "request-id", Priority: 10},
+				}}},
+			},
+			wantPlugins: []string{"auth", "request-id", "authz", "log"},
+		},
+		{
+			name: "required plugin missing",
+			ns: config.Namespace{
+				Routes: config.Routes{"/a": {Middlewares: config.Plugins{{Name: "authz"}}}},
+			},
+			wantProblems: config.Problems{
+				{Path: "$.namespaces.ns.routes['/a'].middlewares[0]", Message: `plugin "authz" requires "auth" earlier in the chain, but it is not part of it`},
+			},
+		},
+		{
+			name: "required plugin later",
+			ns: config.Namespace{
+				Middlewares: config.Plugins{{Name: "authz"}},
+				Routes:      config.Routes{"/a": {Middlewares: config.Plugins{{Name: "auth"}}}},
+			},
+			wantProblems: config.Problems{
+				{Path: "$.namespaces.ns.middlewares[0]", Message: `plugin "authz" requires "auth" earlier in the chain, but it runs later`},
+			},
+		},
+		{
+			name: "after",
+			ns: config.Namespace{
+				Routes: config.Routes{"/a": {Middlewares: config.Plugins{{Name: "log"}, {Name: "request-id"}}}},
+			},
+			wantProblems: config.Problems{
+				{Path: "$.namespaces.ns.routes['/a'].middlewares[0]", Message: `plugin "log" must run after "request-id"`},
+			},
+		},
+		{
+			name: "before",
+			ns: config.Namespace{
+				Middlewares: config.Plugins{{Name: "auth"}, {Name: "ban", Priority: -1}},
+				Routes:      config.Routes{"/a": {}},
+			},
+			wantProblems: config.Problems{
+				{Path: "$.namespaces.ns.middlewares[1]", Message: `plugin "ban" must run before "auth"`},
+			},
+		},
+		{
+			name: "order ignored",
+			ns: config.Namespace{
+				Middlewares: config.Plugins{{Name: "auth"}, {Name: "ban", Priority: -1, IgnoreOrder: true}},
+				Routes:      config.Routes{"/a": {}, "/b": {}},
+			},
+			wantPlugins: []string{"auth", "ban"},
+			wantWarnings: config.Problems{
+				{Path: "$.namespaces.ns.middlewares[1]", Message: `plugin "ban" must run before "auth"`},
+			},
+		},
+		{
+			name: "order ignored but required plugin missing",
+			ns: config.Namespace{
+				Routes: config.Routes{"/a": {Middlewares: config.Plugins{{Name: "authz", IgnoreOrder: true}}}},
+			},
+			wantProblems: config.Problems{
+				{Path: "$.namespaces.ns.routes['/a'].middlewares[0]", Message: `plugin "authz" requires "auth" earlier in the chain, but it is not part of it`},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			is := is.New(t)
+
+			tt.ns.Mounts = []string{""}
+			cfg := config.Config{Namespaces: config.Namespaces{"ns": tt.ns}}
+			r, err := New(cfg, opts, slog.New(slog.DiscardHandler))
+			is.NoErr(err)
+			is.Equal(r.Validate(t.Context()), append(tt.wantProblems, tt.wantWarnings...))
+			if tt.wantProblems != nil {
+				return
+			}
+
+			r, err = New(cfg, opts, slog.New(slog.DiscardHandler))
+			is.NoErr(err)
+			is.NoErr(r.Build(t.Context()))
+			t.Cleanup(func() { _ = r.Shutdown(context.Background()) })
+			is.Equal(r.Routes()[0].Plugins, tt.wantPlugins)
+			is.Equal(r.Warnings(), tt.wantWarnings) // warnings are reported once, not for every route
+		})
+	}
+}
+
+type lifecycleFactory struct {
+	created, started, tornDown atomic.Int32
+	configs                    []map[string]any
+	startCtx                   context.Context
+}
+
+func (*lifecycleFactory) Name() string { return "lifecycle" }
+
+func (f *lifecycleFactory) New(_ context.Context, _ ika.InjectionContext, cfg map[string]any) (ika.Plugin, error) {
+	f.created.Add(1)
+	f.configs = append(f.configs, cfg)
+	return &lifecyclePlugin{f: f}, nil
+}
+
+type lifecyclePlugin struct {
+	passMiddleware
+	f *lifecycleFactory
+}
+
+func (p *lifecyclePlugin) Start(ctx context.Context) error {
+	p.f.started.Add(1)
+	p.f.startCtx = ctx
+	return nil
+}
+
+func (p *lifecyclePlugin) Ready() error {
+	if cfg := p.f.configs[len(p.f.configs)-1]; cfg["ready"] == false {
+		return errors.New("warming up")
+	}
+	return nil
+}
+
+func (p *lifecyclePlugin) Reload(_ context.Context, cfg map[string]any) error {
+	p.f.configs = append(p.f.configs, cfg)
+	return nil
+}
+
+func (p *lifecyclePlugin) Teardown(context.Context) error {
+	p.f.tornDown.Add(1)
+	return nil
+}
+
+func TestRouter_lifecycle(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	f := &lifecycleFactory{}
+	opts := config.ComptimeOpts{Plugins: map[string]ika.PluginFactory{
+		"lifecycle": f,
+		"broken":    &testFactory{name: "broken", err: errors.New("bad config")},
+	}}
+	makeConfig := func(cfg map[string]any, middlewares ...config.Plugin) config.Config {
+		return config.Config{Namespaces: config.Namespaces{"ns": {
+			Mounts: []string{""},
+			Routes: config.Routes{"/a": {Middlewares: append(config.Plugins{{Name: "lifecycle", Config: cfg}}, middlewares...)}},
+		}}}
+	}
+	build := func(cfg config.Config, prev *Router) (*Router, error) {
+		r, err := New(cfg, opts, slog.New(slog.DiscardHandler))
+		is.NoErr(err)
+		if prev != nil {
+			r.Inherit(prev)
+		}
+		if err := r.Build(t.Context()); err != nil {
+			return nil, errors.Join(err, r.Shutdown(t.Context()))
+		}
+		return r, nil
+	}
+
+	r1, err := build(makeConfig(map[string]any{"ready": false}), nil)
+	is.NoErr(err)
+	is.Equal(f.started.Load(), int32(0)) // plugins are started once the servers are listening
+	is.NoErr(r1.Start(t.Context()))
+	is.Equal(f.started.Load(), int32(1))
+	is.Equal(r1.Ready().Error(), `$.namespaces.ns.routes['/a'].middlewares[0]: plugin "lifecycle" is not ready: warming up`)
+
+	// a failed reload hands the plugin back with its previous configuration
+	_, err = build(makeConfig(map[string]any{"ready": true}, config.Plugin{Name: "broken"}), r1)
+	is.True(err != nil)
+	is.Equal(f.configs, []map[string]any{{"ready": false}, {"ready": true}, {"ready": false}})
+	is.Equal(f.tornDown.Load(), int32(0))
+
+	r2, err := build(makeConfig(map[string]any{"ready": true}), r1)
+	is.NoErr(err)
+	is.NoErr(r2.Start(t.Context()))
+	is.Equal(f.created.Load(), int32(1)) // the plugin is reloaded instead of created again
+	is.Equal(f.started.Load(), int32(1))
+	is.NoErr(r2.Ready())
+
+	is.NoErr(r1.Shutdown(t.Context()))
+	is.Equal(f.tornDown.Load(), int32(0)) // the plugin was taken over by r2
+	is.NoErr(f.startCtx.Err())
+
+	is.NoErr(r2.Shutdown(t.Context()))
+	is.Equal(f.tornDown.Load(), int32(1))
+	is.True(f.startCtx.Err() != nil) // the context of Start ends with the plugin
+}
+
+type countingFactory struct {
+	name    string
+	created atomic.Int32
+}
+
+func (f *countingFactory) Name() string { return f.name }
+
+func (f *countingFactory) New(context.Context, ika.InjectionContext, map[string]any) (ika.Plugin, error) {
+	f.created.Add(1)
+	return &countingHook{}, nil
+}
+
+// countingHook implements every hook interface as well as ika.Middleware.
+type countingHook struct{ passMiddleware }
+
+func (*countingHook) HookTripper(tripper http.RoundTripper) (http.RoundTripper, error) {
+	return tripper, nil
+}
+
+func (*countingHook) ErrorHandler(next ika.ErrorHandler) ika.ErrorHandler { return next }
+
+func TestRouter_instances(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		ns   func(name string) config.Namespace
+		want int32
+	}{
+		{
+			name: "hook implementing every hook interface",
+			ns: func(name string) config.Namespace {
+				return config.Namespace{Hooks: config.Plugins{{Name: name}}}
+			},
+			want: 1,
+		},
+		{
+			name: "namespace middleware",
+			ns: func(name string) config.Namespace {
+				return config.Namespace{Middlewares: config.Plugins{{Name: name}}}
+			},
+			want: 1,
+		},
+		{
+			name: "route middleware",
+			ns: func(name string) config.Namespace {
+				return config.Namespace{Routes: config.Routes{
+					"/a": {Middlewares: config.Plugins{{Name: name}}},
+					"/b": {Middlewares: config.Plugins{{Name: name}}},
+				}}
+			},
+			want: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			is := is.New(t)
+
+			f := &countingFactory{name: "counting"}
+			ns := tt.ns(f.name)
+			ns.Mounts = []string{"", "/v1"}
+			if ns.Routes == nil {
+				ns.Routes = config.Routes{"/a": {}, "/b": {Methods: []config.Method{"GET", "POST"}}}
+			}
+
+			r, err := New(config.Config{Namespaces: config.Namespaces{"ns": ns}},
+				config.ComptimeOpts{Plugins: map[string]ika.PluginFactory{f.name: f}}, slog.New(slog.DiscardHandler))
+			is.NoErr(err)
+			is.NoErr(r.Build(t.Context()))
+			is.Equal(f.created.Load(), tt.want) // one instance per declaration
+			is.NoErr(r.Shutdown(t.Context()))
+		})
+	}
+}
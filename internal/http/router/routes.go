@@ -0,0 +1,94 @@
+package router
+
+import (
+	"cmp"
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/alx99/ika"
+	"github.com/alx99/ika/internal/http/proxy"
+	"github.com/alx99/ika/request"
+)
+
+// RouteInfo describes a route registered on the router.
+type RouteInfo struct {
+	// Namespace is the namespace the route belongs to.
+	Namespace string `json:"namespace"`
+	// Mount is the namespace mount the route is registered under.
+	Mount string `json:"mount"`
+	// Route is the route pattern as written in the configuration.
+	Route string `json:"route"`
+	// Pattern is the pattern registered on the [http.ServeMux].
+	Pattern string `json:"pattern"`
+	// Match describes the header, query and cookie conditions of the route.
+	// It is empty if the route has none.
+	Match string `json:"match,omitempty"`
+	// Servers are the names of the servers the route is served on.
+	// It is empty if the route is served on every server.
+	Servers []string `json:"servers,omitempty"`
+	// Plugins are the names of the plugins a request passes through, in order.
+	Plugins []string `json:"plugins"`
+}
+
+// MatchResult describes how the router would handle a request.
+type MatchResult struct {
+	RouteInfo
+
+	// TrimmedPath is the request path after the mount has been trimmed.
+	TrimmedPath string `json:"trimmedPath"`
+	// Upstream is the request that would be sent upstream
+	// after all request modifiers have run and the mount has been trimmed.
+	Upstream *http.Request `json:"-"`
+}
+
+// ErrNoMatch is returned by [Router.Match] when no route matches the request.
+var ErrNoMatch = errors.New("no route matches the request")
+
+type routeEntry struct {
+	RouteInfo
+	modifiers []ika.RequestModifier
+}
+
+// Routes returns every route registered on the router.
+func (r *Router) Routes() []RouteInfo {
+	routes := make([]RouteInfo, len(r.routes))
+	for i := range r.routes {
+		routes[i] = r.routes[i].RouteInfo
+	}
+	slices.SortFunc(routes, func(a, b RouteInfo) int {
+		return cmp.Or(
+			cmp.Compare(a.Namespace, b.Namespace),
+			cmp.Compare(a.Pattern, b.Pattern),
+		)
+	})
+	return routes
+}
+
+// Match reports which route would handle req without sending anything upstream.
+// Only the request modifiers of the route are run against a clone of req.
+func (r *Router) Match(req *http.Request) (MatchResult, error) {
+	cand, pattern := r.muxOf(request.Server(req.Context())).find(req)
+	if cand == nil {
+		return MatchResult{}, ErrNoMatch
+	}
+	entry := cand.routeEntry
+
+	res := MatchResult{RouteInfo: entry.RouteInfo}
+
+	trimmed := req.Clone(req.Context())
+	proxy.TrimPath(trimmed, entry.Mount)
+	res.TrimmedPath = trimmed.URL.Path
+
+	upstream := req.Clone(req.Context())
+	upstream.Pattern = pattern
+	for _, modifier := range entry.modifiers {
+		if err := modifier.ModifyRequest(upstream); err != nil {
+			return res, err
+		}
+	}
+	proxy.TrimPath(upstream, entry.Mount)
+	res.Upstream = upstream
+
+	return res, nil
+}
@@ -0,0 +1,64 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/alx99/ika"
+	"github.com/alx99/ika/internal/config"
+	"github.com/alx99/ika/internal/http/router/chain"
+)
+
+// buildServers wraps the mux of every server that declares hooks with them.
+// Requests received by other servers are routed by their mux directly.
+func (r *Router) buildServers(ctx context.Context) error {
+	r.servers = make(map[string]http.Handler)
+
+	for i, s := range r.cfg.Servers {
+		path := config.RootPath.Field("servers").Index(i)
+		log := r.log.With(slog.String("server", s.ServerName()))
+		ictx := ika.InjectionContext{
+			Scope:  ika.ScopeServer,
+			Logger: log,
+		}
+
+		ch := chain.New()
+		var plugins []chainPlugin
+		for j, cfg := range s.Hooks.Ordered() {
+			path := path.Field("hooks").Index(j)
+			plugin, teardown, err := r.plugins.create(ctx, ictx, path, cfg)
+			if err != nil {
+				return err
+			}
+			r.tder = r.tder.Add(teardown)
+
+			hook, ok := plugin.(ika.OnRequestHook)
+			if !ok {
+				return &config.PathError{Path: path.Field("name"), Err: fmt.Errorf("plugin %q is not an OnRequestHook", cfg.Name)}
+			}
+			ch = ch.Append(chain.Constructor{
+				Name:           cfg.Name,
+				MiddlewareFunc: hook.Handler,
+			})
+			plugins = append(plugins, chainPlugin{name: cfg.Name, path: path, ignoreOrder: cfg.IgnoreOrder})
+		}
+		if len(ch.Names()) == 0 {
+			continue
+		}
+		warnings, err := checkDependencies(r.opts.Plugins, plugins)
+		if err != nil {
+			return err
+		}
+		r.warnings = append(r.warnings, warnings...)
+
+		mux := r.muxOf(s.ServerName()).mux
+		r.servers[s.ServerName()] = ika.ToHTTPHandler(ch.ThenFunc(func(w http.ResponseWriter, req *http.Request) error {
+			mux.ServeHTTP(w, req)
+			return nil
+		}), buildErrHandler(log, r.opts.ErrorHandler, nil, nil))
+	}
+
+	return nil
+}
@@ -0,0 +1,160 @@
+package router
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/alx99/ika/internal/config"
+)
+
+// makeTLSConfig returns the TLS configuration for connections to upstreams,
+// or nil if cfg is empty and the defaults apply.
+// Certificate files are checked on every handshake and reloaded once they change.
+func makeTLSConfig(path config.Path, cfg config.TLS) (*tls.Config, error) {
+	if cfg == (config.TLS{}) {
+		return nil, nil
+	}
+
+	tc := &tls.Config{
+		ServerName:         cfg.ServerName,
+		MinVersion:         cfg.MinVersion.ID(),
+		InsecureSkipVerify: cfg.InsecureSkipVerify, //nolint:gosec // explicitly requested
+	}
+
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return nil, &config.PathError{Path: path, Err: errors.New("certFile and keyFile must be set together")}
+	}
+	if cfg.CertFile != "" {
+		certs := newFileCache(parseKeyPair, cfg.CertFile, cfg.KeyFile)
+		if _, err := certs.get(); err != nil {
+			return nil, &config.PathError{Path: path.Field("certFile"), Err: err}
+		}
+		tc.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return certs.get()
+		}
+	}
+
+	if cfg.CAFile != "" && !cfg.InsecureSkipVerify {
+		cas := newFileCache(parseCertPool, cfg.CAFile)
+		if _, err := cas.get(); err != nil {
+			return nil, &config.PathError{Path: path.Field("caFile"), Err: err}
+		}
+		// the built-in verification is replaced so that the bundle can be reloaded
+		tc.InsecureSkipVerify = true
+		tc.VerifyConnection = func(cs tls.ConnectionState) error {
+			roots, err := cas.get()
+			if err != nil {
+				return err
+			}
+			return verifyPeer(cs, roots)
+		}
+	}
+
+	return tc, nil
+}
+
+// verifyPeer verifies the certificate chain presented by an upstream against roots.
+func verifyPeer(cs tls.ConnectionState, roots *x509.CertPool) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("upstream presented no certificate")
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		DNSName:       cs.ServerName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
+
+func parseKeyPair(data [][]byte) (*tls.Certificate, error) {
+	cert, err := tls.X509KeyPair(data[0], data[1])
+	if err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+func parseCertPool(data [][]byte) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data[0]) {
+		return nil, errors.New("no certificates found")
+	}
+	return pool, nil
+}
+
+// fileCache holds a value parsed from files and parses the files again once they change.
+type fileCache[T any] struct {
+	paths []string
+	parse func([][]byte) (T, error)
+
+	mu     sync.Mutex
+	stamps []fileStamp
+	value  T
+	loaded bool
+}
+
+// fileStamp identifies a version of a file.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func newFileCache[T any](parse func([][]byte) (T, error), paths ...string) *fileCache[T] {
+	return &fileCache[T]{paths: paths, parse: parse}
+}
+
+// get returns the value parsed from the current files.
+// If the files changed but can no longer be parsed, for example because
+// they are being replaced one at a time, the previous value is returned.
+func (c *fileCache[T]) get() (T, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stamps := make([]fileStamp, len(c.paths))
+	for i, path := range c.paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return c.fallback(err)
+		}
+		stamps[i] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+	}
+	if c.loaded && slices.Equal(stamps, c.stamps) {
+		return c.value, nil
+	}
+
+	data := make([][]byte, len(c.paths))
+	for i, path := range c.paths {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return c.fallback(err)
+		}
+		data[i] = b
+	}
+
+	value, err := c.parse(data)
+	if err != nil {
+		return c.fallback(fmt.Errorf("failed to parse %s: %w", c.paths[0], err))
+	}
+
+	c.value, c.stamps, c.loaded = value, stamps, true
+	return value, nil
+}
+
+func (c *fileCache[T]) fallback(err error) (T, error) {
+	if c.loaded {
+		return c.value, nil
+	}
+	var zero T
+	return zero, err
+}
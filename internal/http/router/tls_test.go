@@ -0,0 +1,218 @@
+package router
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alx99/ika/internal/config"
+	"github.com/matryer/is"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// newCert creates a certificate signed by parent, or a self-signed CA if parent is nil.
+func newCert(t *testing.T, name string, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func (c *testCert) tlsCert() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key}
+}
+
+// writeFile writes data to path and moves its modification time forward,
+// so the change is noticed even within the resolution of the file system clock.
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	var mtime time.Time
+	if info, err := os.Stat(path); err == nil {
+		mtime = info.ModTime()
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	mtime = mtime.Add(time.Second)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMakeTransport_TLS(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	ca := newCert(t, "ca", nil)
+	server := newCert(t, "upstream.internal", ca)
+	client := newCert(t, "gateway", ca)
+
+	// the upstream only accepts clients with a certificate signed by the CA
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+	serverCert := server.tlsCert()
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	upstream.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return &serverCert, nil
+		},
+	}
+	upstream.StartTLS()
+	t.Cleanup(upstream.Close)
+
+	dir := t.TempDir()
+	caFile, certFile, keyFile := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeFile(t, caFile, ca.certPEM)
+	writeFile(t, certFile, client.certPEM)
+	writeFile(t, keyFile, client.keyPEM)
+
+	transport, err := makeTransport(config.RootPath, config.Transport{TLS: config.TLS{
+		CAFile:     caFile,
+		CertFile:   certFile,
+		KeyFile:    keyFile,
+		ServerName: "upstream.internal",
+		MinVersion: "1.3",
+	}})
+	is.NoErr(err)
+
+	get := func() (string, error) {
+		transport.CloseIdleConnections() // every request performs a handshake
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, upstream.URL, nil)
+		req.RequestURI = ""
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		b := make([]byte, 64)
+		n, _ := resp.Body.Read(b)
+		return string(b[:n]), nil
+	}
+
+	got, err := get()
+	is.NoErr(err)
+	is.Equal(got, "gateway") // client certificate is presented
+
+	// the upstream switches to a certificate signed by another CA
+	ca2 := newCert(t, "ca2", nil)
+	serverCert = newCert(t, "upstream.internal", ca2).tlsCert()
+	_, err = get()
+	is.True(err != nil) // certificate of an untrusted CA is rejected
+
+	writeFile(t, caFile, ca2.certPEM)
+	_, err = get()
+	is.NoErr(err) // the CA bundle is reloaded
+
+	// the client certificate is rotated
+	clientCAs.AddCert(ca2.cert)
+	rotated := newCert(t, "gateway-rotated", ca2)
+	writeFile(t, certFile, rotated.certPEM)
+	_, err = get()
+	is.NoErr(err) // a mismatching key keeps the previous certificate
+	writeFile(t, keyFile, rotated.keyPEM)
+	got, err = get()
+	is.NoErr(err)
+	is.Equal(got, "gateway-rotated") // the key pair is reloaded
+}
+
+func TestMakeTLSConfig(t *testing.T) {
+	t.Parallel()
+
+	ca := newCert(t, "ca", nil)
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	writeFile(t, caFile, ca.certPEM)
+	invalidFile := filepath.Join(dir, "invalid.pem")
+	writeFile(t, invalidFile, []byte("not a certificate"))
+
+	tests := []struct {
+		name    string
+		cfg     config.TLS
+		wantNil bool
+		wantErr string
+	}{
+		{name: "empty", wantNil: true},
+		{name: "server name", cfg: config.TLS{ServerName: "a"}},
+		{name: "insecure", cfg: config.TLS{InsecureSkipVerify: true, CAFile: caFile}},
+		{name: "missing key", cfg: config.TLS{CertFile: caFile}, wantErr: "$.tls: certFile and keyFile must be set together"},
+		{name: "missing CA file", cfg: config.TLS{CAFile: filepath.Join(dir, "missing.pem")}, wantErr: "$.tls.caFile: "},
+		{name: "invalid CA file", cfg: config.TLS{CAFile: invalidFile}, wantErr: "$.tls.caFile: failed to parse"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			is := is.New(t)
+
+			tc, err := makeTLSConfig(config.RootPath.Field("tls"), tt.cfg)
+			if tt.wantErr != "" {
+				is.True(err != nil)                                 // expected an error
+				is.True(strings.HasPrefix(err.Error(), tt.wantErr)) // unexpected error
+				return
+			}
+			is.NoErr(err)
+			is.Equal(tc == nil, tt.wantNil)
+			if tt.cfg.InsecureSkipVerify {
+				is.True(tc.VerifyConnection == nil) // nothing is verified
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// envListeners maps the addresses of the listeners handed to a process to their file descriptors.
+const envListeners = "IKA_LISTENERS"
+
+var (
+	inheritedMu sync.Mutex
+	// inherited holds the listeners handed over by the previous process which have not been taken yet
+	inherited = sync.OnceValue(func() map[string]*os.File {
+		fds := map[string]uintptr{}
+		if err := json.Unmarshal([]byte(os.Getenv(envListeners)), &fds); err != nil {
+			return nil
+		}
+		// processes started by this one must not mistake the descriptors for their own
+		_ = os.Unsetenv(envListeners)
+
+		files := make(map[string]*os.File, len(fds))
+		for addr, fd := range fds {
+			files[addr] = os.NewFile(fd, addr)
+		}
+		return files
+	})
+)
+
+// takeInherited returns the listener for addr handed over by the previous process, if any.
+func takeInherited(addr string) (net.Listener, bool, error) {
+	inheritedMu.Lock()
+	defer inheritedMu.Unlock()
+
+	files := inherited()
+	f, ok := files[addr]
+	if !ok {
+		return nil, false, nil
+	}
+	delete(files, addr)
+	defer f.Close()
+
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to use inherited listener: %w", err)
+	}
+	if ul, ok := l.(*net.UnixListener); ok {
+		// the socket belongs to this process now
+		ul.SetUnlinkOnClose(true)
+	}
+	return l, true, nil
+}
+
+// closeInherited closes the listeners handed over by the previous process which are not used,
+// since they would otherwise accept connections that are never served.
+func closeInherited() {
+	inheritedMu.Lock()
+	defer inheritedMu.Unlock()
+
+	files := inherited()
+	for addr, f := range files {
+		_ = f.Close()
+		delete(files, addr)
+	}
+}
+
+// Handoff passes the listeners of s to cmd, which must not have been started yet.
+// Servers of the started process listening on the same addresses serve them instead of listening again.
+// The caller must close the files added to cmd.ExtraFiles once the process has started.
+func (s *MultiServer) Handoff(cmd *exec.Cmd) error {
+	if len(s.listeners) == 0 {
+		return errors.New("servers are not listening")
+	}
+
+	fds := make(map[string]uintptr, len(s.listeners))
+	for i, l := range s.listeners {
+		fl, ok := unwrap(l).(interface{ File() (*os.File, error) })
+		if !ok {
+			return fmt.Errorf("listener of %s cannot be handed over", s.configs[i].Addr)
+		}
+		f, err := fl.File()
+		if err != nil {
+			return fmt.Errorf("listener of %s cannot be handed over: %w", s.configs[i].Addr, err)
+		}
+		// the first extra file becomes descriptor 3 of the process
+		fds[s.configs[i].Addr] = uintptr(3 + len(cmd.ExtraFiles))
+		cmd.ExtraFiles = append(cmd.ExtraFiles, f)
+	}
+
+	env, err := json.Marshal(fds)
+	if err != nil {
+		return err
+	}
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, envListeners+"="+string(env))
+	return nil
+}
+
+// Detach keeps the Unix domain sockets of s in place when the servers shut down,
+// since they are served by the process they were handed to.
+func (s *MultiServer) Detach() {
+	for _, l := range s.listeners {
+		if ul, ok := unwrap(l).(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+	}
+}
+
+// unwrap returns the listener of the socket l accepts connections from.
+func unwrap(l net.Listener) net.Listener {
+	if pl, ok := l.(*proxyListener); ok {
+		return pl.Listener
+	}
+	return l
+}
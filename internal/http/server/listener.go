@@ -0,0 +1,157 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/alx99/ika/internal/config"
+)
+
+// listen creates the listener of the server configured by c.
+func listen(path config.Path, c config.Server) (net.Listener, error) {
+	l, err := listenAddr(c)
+	if err != nil {
+		return nil, &config.PathError{Path: path.Field("addr"), Err: err}
+	}
+
+	if !c.ProxyProtocol.Enabled() {
+		return l, nil
+	}
+	pl, err := newProxyListener(l, c.ProxyProtocol)
+	if err != nil {
+		_ = l.Close()
+		return nil, &config.PathError{Path: path.Field("proxyProtocol"), Err: err}
+	}
+	return pl, nil
+}
+
+func listenAddr(c config.Server) (net.Listener, error) {
+	if l, ok, err := takeInherited(c.Addr); ok {
+		return l, err
+	}
+	if name, ok := strings.CutPrefix(c.Addr, "systemd:"); ok {
+		return systemdListener(name)
+	}
+	if socket, ok := strings.CutPrefix(c.Addr, "unix:"); ok {
+		// unix:///run/ika.sock is accepted as well as unix:/run/ika.sock
+		if strings.HasPrefix(socket, "//") {
+			socket = socket[2:]
+		}
+		return listenUnix(socket, c.SocketMode.Mode())
+	}
+
+	// the default address of http.Server
+	addr := c.Addr
+	if addr == "" {
+		addr = ":http"
+	}
+	return net.Listen("tcp", addr)
+}
+
+// listenUnix listens on the Unix domain socket at path, replacing a stale socket left behind by a previous process.
+func listenUnix(path string, mode fs.FileMode) (net.Listener, error) {
+	if path == "" {
+		return nil, errors.New("missing socket path")
+	}
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			_ = l.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// removeStaleSocket removes the socket at path if it was left behind by a process that exited.
+// It returns an error if another process still accepts connections on it.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode().Type() != fs.ModeSocket {
+		return nil
+	}
+
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	switch {
+	case err == nil:
+		_ = conn.Close()
+		return fmt.Errorf("socket %s: %w", path, syscall.EADDRINUSE)
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return os.Remove(path)
+	default:
+		return err
+	}
+}
+
+// systemdSocket is a socket passed by systemd socket activation.
+type systemdSocket struct {
+	name string
+	fd   uintptr
+	file *os.File
+}
+
+// systemdSockets returns the sockets passed by systemd to this process.
+var systemdSockets = sync.OnceValue(func() []systemdSocket {
+	sockets := parseListenFDs(os.Getenv, os.Getpid())
+	for i, s := range sockets {
+		sockets[i].file = os.NewFile(s.fd, s.name)
+	}
+	return sockets
+})
+
+// parseListenFDs returns the sockets described by the environment variables systemd sets, see sd_listen_fds(3).
+func parseListenFDs(getenv func(string) string, pid int) []systemdSocket {
+	if p, err := strconv.Atoi(getenv("LISTEN_PID")); err != nil || p != pid {
+		return nil
+	}
+	n, err := strconv.Atoi(getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil
+	}
+	names := strings.Split(getenv("LISTEN_FDNAMES"), ":")
+
+	// the first passed file descriptor is always 3
+	const firstFD = 3
+	sockets := make([]systemdSocket, n)
+	for i := range sockets {
+		name := "LISTEN_FD_" + strconv.Itoa(firstFD+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		sockets[i] = systemdSocket{name: name, fd: uintptr(firstFD + i)}
+	}
+	return sockets
+}
+
+// systemdListener returns a listener for the socket passed by systemd with the given name, or at the given index.
+func systemdListener(name string) (net.Listener, error) {
+	sockets := systemdSockets()
+	if len(sockets) == 0 {
+		return nil, errors.New("no sockets were passed by systemd")
+	}
+
+	for _, s := range sockets {
+		if s.name == name {
+			return net.FileListener(s.file)
+		}
+	}
+	if i, err := strconv.Atoi(name); err == nil && i >= 0 && i < len(sockets) {
+		return net.FileListener(sockets[i].file)
+	}
+	return nil, fmt.Errorf("no socket named %q was passed by systemd", name)
+}
@@ -0,0 +1,249 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alx99/ika/internal/config"
+)
+
+const defaultProxyHeaderTimeout = 5 * time.Second
+
+var (
+	proxyV1Signature = []byte("PROXY ")
+	proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// proxyListener reads PROXY protocol headers from connections accepted from trusted sources.
+// See https://www.haproxy.org/download/3.0/doc/proxy-protocol.txt.
+type proxyListener struct {
+	net.Listener
+	trusted   []*net.IPNet
+	trustUnix bool
+	timeout   time.Duration
+}
+
+func newProxyListener(l net.Listener, cfg config.ProxyProtocol) (*proxyListener, error) {
+	pl := &proxyListener{Listener: l, trustUnix: cfg.TrustUnixPeers, timeout: cfg.HeaderTimeout.Dur()}
+	if pl.timeout == 0 {
+		pl.timeout = defaultProxyHeaderTimeout
+	}
+
+	for _, source := range cfg.TrustedSources {
+		if _, network, err := net.ParseCIDR(source); err == nil {
+			pl.trusted = append(pl.trusted, network)
+			continue
+		}
+		ip := net.ParseIP(source)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid trusted source %q", source)
+		}
+		bits := 8 * len(ip)
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+		pl.trusted = append(pl.trusted, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+	return pl, nil
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil || !l.isTrusted(conn.RemoteAddr()) {
+		return conn, err
+	}
+	// the header is read by the goroutine serving the connection, not to hold up accepting others
+	return &proxyConn{Conn: conn, timeout: l.timeout}, nil
+}
+
+func (l *proxyListener) isTrusted(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		// peers of Unix domain sockets have no address, any local process able to connect may send headers
+		return l.trustUnix
+	}
+	for _, network := range l.trusted {
+		if network.Contains(tcp.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyConn is a connection from a trusted source, whose addresses are
+// replaced by the ones of the PROXY protocol header if it starts with one.
+type proxyConn struct {
+	net.Conn
+	timeout time.Duration
+
+	once   sync.Once
+	r      *bufio.Reader
+	err    error
+	remote net.Addr
+	local  net.Addr
+}
+
+func (c *proxyConn) init() {
+	c.once.Do(func() {
+		_ = c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+		c.r = bufio.NewReader(c.Conn)
+		if c.err = c.readHeader(); c.err != nil {
+			c.err = fmt.Errorf("proxy protocol: %w", c.err)
+		}
+		_ = c.Conn.SetReadDeadline(time.Time{})
+	})
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(b)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.init()
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyConn) LocalAddr() net.Addr {
+	c.init()
+	if c.local != nil {
+		return c.local
+	}
+	return c.Conn.LocalAddr()
+}
+
+// readHeader reads the PROXY protocol header, connections without one are passed on unchanged.
+func (c *proxyConn) readHeader() error {
+	first, err := c.r.Peek(1)
+	if err != nil {
+		return err
+	}
+	switch first[0] {
+	case proxyV1Signature[0]:
+		if sig, err := c.r.Peek(len(proxyV1Signature)); err != nil || !bytes.Equal(sig, proxyV1Signature) {
+			return nil
+		}
+		return c.readV1()
+	case proxyV2Signature[0]:
+		if sig, err := c.r.Peek(len(proxyV2Signature)); err != nil || !bytes.Equal(sig, proxyV2Signature) {
+			return nil
+		}
+		return c.readV2()
+	}
+	return nil
+}
+
+// maxV1HeaderLen is the maximum length of a version 1 header including the line break.
+const maxV1HeaderLen = 107
+
+// readV1 reads a header such as "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n".
+func (c *proxyConn) readV1() error {
+	var line []byte
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) == maxV1HeaderLen {
+			return errors.New("header too long")
+		}
+	}
+
+	header, ok := strings.CutSuffix(string(line), "\r\n")
+	if !ok {
+		return errors.New("header must end with CRLF")
+	}
+	fields := strings.Split(header, " ")
+	switch {
+	case len(fields) >= 2 && fields[1] == "UNKNOWN":
+		return nil
+	case len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6"):
+		return fmt.Errorf("invalid header %q", header)
+	}
+
+	src, err := parseV1Addr(fields[2], fields[4])
+	if err != nil {
+		return err
+	}
+	dst, err := parseV1Addr(fields[3], fields[5])
+	if err != nil {
+		return err
+	}
+	c.remote, c.local = src, dst
+	return nil
+}
+
+func parseV1Addr(host, port string) (*net.TCPAddr, error) {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid address %q", host)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q", port)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(p)}, nil
+}
+
+// readV2 reads a binary header.
+func (c *proxyConn) readV2() error {
+	var hdr [16]byte
+	if _, err := io.ReadFull(c.r, hdr[:]); err != nil {
+		return err
+	}
+	if version := hdr[12] >> 4; version != 2 {
+		return fmt.Errorf("unsupported version %d", version)
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(hdr[14:]))
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return err
+	}
+
+	// LOCAL connections are health checks of the balancer itself and keep their addresses
+	const cmdProxy = 0x1
+	if hdr[12]&0xf != cmdProxy {
+		return nil
+	}
+
+	var size int
+	switch family := hdr[13] >> 4; family {
+	case 0x1: // IPv4
+		size = net.IPv4len
+	case 0x2: // IPv6
+		size = net.IPv6len
+	default: // unspecified or Unix domain sockets
+		return nil
+	}
+	if len(payload) < 2*size+4 {
+		return errors.New("address block too short")
+	}
+
+	c.remote = &net.TCPAddr{
+		IP:   net.IP(payload[:size]),
+		Port: int(binary.BigEndian.Uint16(payload[2*size:])),
+	}
+	c.local = &net.TCPAddr{
+		IP:   net.IP(payload[size : 2*size]),
+		Port: int(binary.BigEndian.Uint16(payload[2*size+2:])),
+	}
+	return nil
+}
@@ -4,11 +4,11 @@ import (
 	"context"
 	"errors"
 	"log/slog"
+	"net"
 	"net/http"
-	"sync"
-	"time"
 
 	"github.com/alx99/ika/internal/config"
+	"github.com/alx99/ika/request"
 )
 
 type HTTPServer interface {
@@ -17,17 +17,19 @@ type HTTPServer interface {
 }
 
 type MultiServer struct {
-	servers []http.Server
+	servers   []http.Server
+	configs   []config.Server
+	listeners []net.Listener
 }
 
 func New(handler http.Handler, config []config.Server) *MultiServer {
 	var servers []http.Server
 	for _, c := range config {
 		//nolint:gosec // not an issue, user-provided configuration
-		servers = append(servers, *ConfigureServer(&http.Server{Handler: handler}, c))
+		servers = append(servers, *ConfigureServer(&http.Server{Handler: withServerName(c.ServerName(), handler)}, c))
 	}
 
-	return &MultiServer{servers: servers}
+	return &MultiServer{servers: servers, configs: config}
 }
 
 func ConfigureServer(s *http.Server, c config.Server) *http.Server {
@@ -41,27 +43,39 @@ func ConfigureServer(s *http.Server, c config.Server) *http.Server {
 	return s
 }
 
+// ListenAndServe creates the listeners of all servers and serves them in the background.
+// If a listener cannot be created, none of the servers are started.
 func (s *MultiServer) ListenAndServe() error {
-	var errs error
-	var mutex sync.Mutex
-	wg := sync.WaitGroup{}
+	listeners := make([]net.Listener, len(s.servers))
+	for i, c := range s.configs {
+		l, err := listen(config.RootPath.Field("servers").Index(i), c)
+		if err != nil {
+			for _, l := range listeners[:i] {
+				_ = l.Close()
+			}
+			return err
+		}
+		listeners[i] = l
+	}
+	closeInherited()
+	s.listeners = listeners
+
 	for i := range s.servers {
-		wg.Add(1)
 		go func() {
-			wg.Done()
-			err := s.servers[i].ListenAndServe()
+			err := s.servers[i].Serve(listeners[i])
 			if err != nil && !errors.Is(err, http.ErrServerClosed) {
-				mutex.Lock()
-				errs = errors.Join(err, s.servers[i].ListenAndServe())
-				mutex.Unlock()
-				slog.Error("server.ListenAndServe", "err", err)
+				slog.Error("server.Serve", "err", err)
 			}
 		}()
 	}
-	wg.Wait()
-	// Wait a little to give the server time to start
-	time.Sleep(1 * time.Second)
-	return errs
+	return nil
+}
+
+// withServerName records the name of the server in the context of every request.
+func withServerName(name string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(request.WithServer(r.Context(), name)))
+	})
 }
 
 func (s *MultiServer) Shutdown(ctx context.Context) error {
@@ -0,0 +1,322 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/alx99/ika/internal/config"
+	"github.com/matryer/is"
+)
+
+// get sends a GET request over conn, preceded by prefix, and returns the body of a successful response.
+func get(t *testing.T, conn net.Conn, prefix []byte) (string, error) {
+	t.Helper()
+	if _, err := conn.Write(prefix); err != nil {
+		return "", err
+	}
+	if _, err := io.WriteString(conn, "GET / HTTP/1.1\r\nHost: ika\r\nConnection: close\r\n\r\n"); err != nil {
+		return "", err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New(resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+func TestMultiServer_unix(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	socket := filepath.Join(t.TempDir(), "ika.sock")
+	// a socket left behind by a previous process is replaced
+	stale, err := net.Listen("unix", socket)
+	is.NoErr(err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	is.NoErr(stale.Close())
+
+	s := New(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.RemoteAddr)
+	}), []config.Server{{
+		Addr:          "unix:" + socket,
+		SocketMode:    "0600",
+		ProxyProtocol: config.ProxyProtocol{TrustUnixPeers: true},
+	}})
+	is.NoErr(s.ListenAndServe())
+	t.Cleanup(func() { _ = s.Shutdown(context.Background()) })
+
+	info, err := os.Stat(socket)
+	is.NoErr(err)
+	is.Equal(info.Mode().Perm(), os.FileMode(0o600))
+
+	conn, err := net.Dial("unix", socket)
+	is.NoErr(err)
+	defer conn.Close()
+	got, err := get(t, conn, []byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n"))
+	is.NoErr(err)
+	is.Equal(got, "192.0.2.1:56324") // the address of the client behind the balancer
+}
+
+func TestListenUnix_inUse(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	socket := filepath.Join(t.TempDir(), "ika.sock")
+	l, err := net.Listen("unix", socket)
+	is.NoErr(err)
+	defer l.Close()
+
+	_, err = listenUnix(socket, 0)
+	is.True(errors.Is(err, syscall.EADDRINUSE)) // a socket in use is not replaced
+
+	conn, err := net.Dial("unix", socket)
+	is.NoErr(err) // the socket still accepts connections
+	_ = conn.Close()
+}
+
+func TestMultiServer_ListenAndServe(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		servers []config.Server
+		wantErr string
+	}{
+		{name: "tcp", servers: []config.Server{{Addr: "127.0.0.1:0"}}},
+		{
+			name:    "missing socket path",
+			servers: []config.Server{{Addr: "127.0.0.1:0"}, {Addr: "unix:"}},
+			wantErr: "$.servers[1].addr: missing socket path",
+		},
+		{
+			name:    "systemd",
+			servers: []config.Server{{Addr: "systemd:http"}},
+			wantErr: "$.servers[0].addr: no sockets were passed by systemd",
+		},
+		{
+			name:    "invalid trusted source",
+			servers: []config.Server{{Addr: "127.0.0.1:0", ProxyProtocol: config.ProxyProtocol{TrustedSources: []string{"lb"}}}},
+			wantErr: `$.servers[0].proxyProtocol: invalid trusted source "lb"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			is := is.New(t)
+
+			s := New(http.NotFoundHandler(), tt.servers)
+			err := s.ListenAndServe()
+			t.Cleanup(func() { _ = s.Shutdown(context.Background()) })
+			if tt.wantErr != "" {
+				is.True(err != nil) // expected an error
+				is.Equal(err.Error(), tt.wantErr)
+				return
+			}
+			is.NoErr(err)
+		})
+	}
+}
+
+func TestParseListenFDs(t *testing.T) {
+	t.Parallel()
+
+	env := func(vars map[string]string) func(string) string {
+		return func(key string) string { return vars[key] }
+	}
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		want []string
+	}{
+		{name: "not activated", env: map[string]string{}},
+		{name: "other process", env: map[string]string{"LISTEN_PID": "2", "LISTEN_FDS": "1"}},
+		{name: "unnamed", env: map[string]string{"LISTEN_PID": "1", "LISTEN_FDS": "2"}, want: []string{"LISTEN_FD_3", "LISTEN_FD_4"}},
+		{name: "named", env: map[string]string{"LISTEN_PID": "1", "LISTEN_FDS": "2", "LISTEN_FDNAMES": "http:admin"}, want: []string{"http", "admin"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			is := is.New(t)
+
+			var got []string
+			for i, s := range parseListenFDs(env(tt.env), 1) {
+				is.Equal(s.fd, uintptr(3+i))
+				got = append(got, s.name)
+			}
+			is.Equal(got, tt.want)
+		})
+	}
+}
+
+func proxyV2Header(cmd, family byte, addrs []byte) []byte {
+	b := append([]byte{}, proxyV2Signature...)
+	b = append(b, 0x20|cmd, family, 0, 0)
+	binary.BigEndian.PutUint16(b[14:], uint16(len(addrs)))
+	return append(b, addrs...)
+}
+
+func TestProxyConn(t *testing.T) {
+	t.Parallel()
+
+	v4 := []byte{192, 0, 2, 1, 192, 0, 2, 2, 0xdc, 0x04, 0x01, 0xbb}
+	v6 := make([]byte, 36)
+	v6[15], v6[31], v6[33], v6[35] = 1, 2, 80, 81
+
+	tests := []struct {
+		name       string
+		prefix     []byte
+		wantRemote string
+		wantLocal  string
+		wantErr    string
+	}{
+		{name: "no header", wantRemote: "pipe"},
+		{name: "v1 IPv4", prefix: []byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n"), wantRemote: "192.0.2.1:56324", wantLocal: "192.0.2.2:443"},
+		{name: "v1 IPv6", prefix: []byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n"), wantRemote: "[2001:db8::1]:56324"},
+		{name: "v1 unknown", prefix: []byte("PROXY UNKNOWN\r\n"), wantRemote: "pipe"},
+		{name: "v1 invalid", prefix: []byte("PROXY TCP4 a b c d\r\n"), wantErr: `proxy protocol: invalid address "a"`},
+		{name: "v1 too long", prefix: []byte("PROXY " + strings.Repeat("A", 120)), wantErr: "proxy protocol: header too long"},
+		{name: "v2 IPv4", prefix: proxyV2Header(1, 0x11, v4), wantRemote: "192.0.2.1:56324", wantLocal: "192.0.2.2:443"},
+		{name: "v2 IPv6", prefix: proxyV2Header(1, 0x21, v6), wantRemote: "[::1]:80", wantLocal: "[::2]:81"},
+		{name: "v2 local", prefix: proxyV2Header(0, 0x11, v4), wantRemote: "pipe"},
+		{name: "v2 short", prefix: proxyV2Header(1, 0x21, v4), wantErr: "proxy protocol: address block too short"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			is := is.New(t)
+
+			client, server := net.Pipe()
+			defer client.Close()
+			conn := &proxyConn{Conn: server, timeout: time.Second}
+			defer conn.Close()
+
+			go func() {
+				_, _ = client.Write(append(tt.prefix, "GET / HTTP/1.1\r\n"...))
+			}()
+
+			remote := conn.RemoteAddr().String()
+			line, err := bufio.NewReader(conn).ReadString('\n')
+			if tt.wantErr != "" {
+				is.True(err != nil) // expected an error
+				is.Equal(err.Error(), tt.wantErr)
+				return
+			}
+			is.NoErr(err)
+			is.Equal(line, "GET / HTTP/1.1\r\n") // the request follows the header
+			is.Equal(remote, tt.wantRemote)
+			if tt.wantLocal != "" {
+				is.Equal(conn.LocalAddr().String(), tt.wantLocal)
+			}
+		})
+	}
+}
+
+func TestProxyListener_untrusted(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	is.NoErr(err)
+	pl, err := newProxyListener(l, config.ProxyProtocol{TrustedSources: []string{"10.0.0.1"}})
+	is.NoErr(err)
+
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.RemoteAddr)
+	})}
+	go func() { _ = srv.Serve(pl) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	is.NoErr(err)
+	defer conn.Close()
+	_, err = get(t, conn, []byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n"))
+	is.True(err != nil) // the header of an untrusted source is not accepted
+
+	conn, err = net.Dial("tcp", l.Addr().String())
+	is.NoErr(err)
+	defer conn.Close()
+	got, err := get(t, conn, nil)
+	is.NoErr(err)
+	is.Equal(got, conn.LocalAddr().String()) // the address of the connection is kept
+}
+
+func TestProxyListener_unixUntrusted(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	socket := filepath.Join(t.TempDir(), "ika.sock")
+	l, err := net.Listen("unix", socket)
+	is.NoErr(err)
+	// trusted sources do not apply to Unix domain sockets
+	pl, err := newProxyListener(l, config.ProxyProtocol{TrustedSources: []string{"0.0.0.0/0", "::/0"}})
+	is.NoErr(err)
+
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.RemoteAddr)
+	})}
+	go func() { _ = srv.Serve(pl) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	conn, err := net.Dial("unix", socket)
+	is.NoErr(err)
+	defer conn.Close()
+	_, err = get(t, conn, []byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n"))
+	is.True(err != nil) // the header is not accepted without trustUnixPeers
+}
+
+func TestMultiServer_Handoff(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	s := New(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}), []config.Server{{Addr: "127.0.0.1:0"}})
+	cmd := exec.Command("ika")
+	is.True(s.Handoff(cmd) != nil) // servers that are not listening cannot hand over
+
+	is.NoErr(s.ListenAndServe())
+	addr := s.listeners[0].Addr().String()
+
+	cmd.ExtraFiles = []*os.File{nil}
+	is.NoErr(s.Handoff(cmd))
+	is.Equal(len(cmd.ExtraFiles), 2)
+	is.Equal(cmd.Env[len(cmd.Env)-1], `IKA_LISTENERS={"127.0.0.1:0":4}`)
+	s.Detach()
+	is.NoErr(s.Shutdown(context.Background()))
+
+	// the socket outlives the server it was handed over from
+	l, err := net.FileListener(cmd.ExtraFiles[1])
+	is.NoErr(err)
+	is.NoErr(cmd.ExtraFiles[1].Close())
+	srv := &http.Server{Handler: s.servers[0].Handler}
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	conn, err := net.Dial("tcp", addr)
+	is.NoErr(err)
+	defer conn.Close()
+	got, err := get(t, conn, nil)
+	is.NoErr(err)
+	is.Equal(got, "ok")
+}
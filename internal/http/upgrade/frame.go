@@ -0,0 +1,108 @@
+package upgrade
+
+// frameCounter counts WebSocket messages in a byte stream by parsing frame headers.
+// Payloads are skipped without being inspected.
+type frameCounter struct {
+	// skipHTTP makes the counter skip an HTTP message header first,
+	// such as the 101 response preceding the frames sent to the client.
+	skipHTTP bool
+	// crlf counts the bytes of "\r\n\r\n" matched while skipping the HTTP header
+	crlf int
+
+	hdr    [14]byte
+	hdrLen int
+	// payload is the number of payload bytes of the current frame left to skip
+	payload uint64
+}
+
+// feed consumes p and returns the number of messages completed in it.
+func (c *frameCounter) feed(p []byte) int {
+	messages := 0
+	for len(p) > 0 {
+		if c.skipHTTP {
+			c.skipHeader(&p)
+			continue
+		}
+
+		if c.payload > 0 {
+			n := min(c.payload, uint64(len(p)))
+			c.payload -= n
+			p = p[n:]
+			continue
+		}
+
+		c.hdr[c.hdrLen] = p[0]
+		c.hdrLen++
+		p = p[1:]
+
+		if c.hdrLen < 2 || c.hdrLen < c.headerSize() {
+			continue
+		}
+
+		fin := c.hdr[0]&0x80 != 0
+		opcode := c.hdr[0] & 0x0f
+		// control frames (close, ping, pong) are not messages
+		if fin && opcode < 0x8 {
+			messages++
+		}
+		c.payload = c.payloadLen()
+		c.hdrLen = 0
+	}
+	return messages
+}
+
+func (c *frameCounter) skipHeader(p *[]byte) {
+	const end = "\r\n\r\n"
+	for i, b := range *p {
+		switch {
+		case b == end[c.crlf]:
+			c.crlf++
+		case b == end[0]:
+			c.crlf = 1
+		default:
+			c.crlf = 0
+		}
+		if c.crlf == len(end) {
+			c.skipHTTP = false
+			*p = (*p)[i+1:]
+			return
+		}
+	}
+	*p = nil
+}
+
+// atBoundary reports whether the stream is between two frames.
+func (c *frameCounter) atBoundary() bool {
+	return !c.skipHTTP && c.payload == 0 && c.hdrLen == 0
+}
+
+// headerSize returns the size of the current frame header.
+// The first two bytes of the header must have been read.
+func (c *frameCounter) headerSize() int {
+	size := 2
+	switch c.hdr[1] & 0x7f {
+	case 126:
+		size += 2
+	case 127:
+		size += 8
+	}
+	if c.hdr[1]&0x80 != 0 {
+		size += 4 // masking key
+	}
+	return size
+}
+
+func (c *frameCounter) payloadLen() uint64 {
+	switch n := c.hdr[1] & 0x7f; n {
+	case 126:
+		return uint64(c.hdr[2])<<8 | uint64(c.hdr[3])
+	case 127:
+		var l uint64
+		for _, b := range c.hdr[2:10] {
+			l = l<<8 | uint64(b)
+		}
+		return l
+	default:
+		return uint64(n)
+	}
+}
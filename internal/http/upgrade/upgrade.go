@@ -0,0 +1,307 @@
+// Package upgrade handles requests that upgrade the connection to another protocol, such as WebSockets.
+// Upgraded connections are hijacked from the server and tunnelled to the upstream by the proxy,
+// this package enforces the limits of the route on them and counts the traffic they carry.
+package upgrade
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alx99/ika"
+	"github.com/alx99/ika/request"
+)
+
+// Options are the limits of a route on upgraded connections.
+type Options struct {
+	// Disabled rejects every upgrade request.
+	Disabled bool
+	// Protocols lists the protocols, in lower case, that requests may upgrade to.
+	// Every protocol is allowed if it is empty.
+	Protocols []string
+	// IdleTimeout closes a connection that has neither sent nor received data for this long.
+	IdleTimeout time.Duration
+	// MaxLifetime closes a connection once it has been open for this long.
+	MaxLifetime time.Duration
+}
+
+// Stats describes the traffic of an upgraded connection, see [request.UpgradeStats].
+type Stats = request.UpgradeStats
+
+// StatsFrom returns the stats of the upgrade request the context belongs to,
+// or nil if it does not belong to one.
+func StatsFrom(ctx context.Context) *Stats {
+	return request.UpgradeStatsFrom(ctx)
+}
+
+// IsUpgrade reports whether r asks to upgrade the connection.
+func IsUpgrade(r *http.Request) bool {
+	if r.Header.Get("Upgrade") == "" {
+		return false
+	}
+	for _, v := range r.Header.Values("Connection") {
+		for token := range strings.SplitSeq(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// protocol returns the first protocol of the Upgrade header of r, without version and in lower case.
+func protocol(r *http.Request) string {
+	p, _, _ := strings.Cut(r.Header.Get("Upgrade"), ",")
+	p, _, _ = strings.Cut(p, "/")
+	return strings.ToLower(strings.TrimSpace(p))
+}
+
+// WithStats makes the stats of upgrade requests available through [StatsFrom]
+// to next and everything it calls.
+// It must wrap every plugin that reads the stats, while [Tracker.Handler] fills them in.
+func WithStats(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if IsUpgrade(r) {
+			r = r.WithContext(request.WithUpgradeStats(r.Context(), &Stats{Protocol: protocol(r)}))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// NotAllowedError is returned for upgrade requests that the route does not allow.
+type NotAllowedError struct {
+	Protocol string
+}
+
+func (e *NotAllowedError) Error() string {
+	return fmt.Sprintf("upgrade to %q is not allowed", e.Protocol)
+}
+
+func (*NotAllowedError) Status() int {
+	return http.StatusForbidden
+}
+
+func (*NotAllowedError) Title() string {
+	return "Upgrade not allowed"
+}
+
+func (e *NotAllowedError) Detail() string {
+	return fmt.Sprintf("The route does not allow upgrading the connection to %q.", e.Protocol)
+}
+
+// Tracker keeps track of the upgraded connections of a namespace
+// so they can be closed when it shuts down.
+type Tracker struct {
+	mu     sync.Mutex
+	conns  map[*conn]struct{}
+	closed bool
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{conns: map[*conn]struct{}{}}
+}
+
+// Handler enforces opts on upgrade requests before passing them to next,
+// which is expected to hijack the connection.
+// Requests that do not ask for an upgrade are passed through untouched.
+func (t *Tracker) Handler(opts Options, next ika.Handler) ika.Handler {
+	return ika.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		if !IsUpgrade(r) {
+			return next.ServeHTTP(w, r)
+		}
+
+		stats := StatsFrom(r.Context())
+		if stats == nil {
+			stats = &Stats{Protocol: protocol(r)}
+		}
+		if opts.Disabled || (len(opts.Protocols) > 0 && !slices.Contains(opts.Protocols, stats.Protocol)) {
+			return &NotAllowedError{Protocol: stats.Protocol}
+		}
+
+		return next.ServeHTTP(&hijackWriter{
+			ResponseWriter: w,
+			hijack: func() (net.Conn, *bufio.ReadWriter, error) {
+				return t.hijack(w, opts, stats)
+			},
+		}, r)
+	})
+}
+
+// errShuttingDown is returned by Hijack once the tracker is closed.
+var errShuttingDown = errors.New("upgrade: shutting down")
+
+func (t *Tracker) hijack(w http.ResponseWriter, opts Options, stats *Stats) (net.Conn, *bufio.ReadWriter, error) {
+	t.mu.Lock()
+	closed := t.closed
+	t.mu.Unlock()
+	if closed {
+		// fail before hijacking, so the proxy can still respond
+		return nil, nil, errShuttingDown
+	}
+
+	nc, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c := &conn{
+		Conn:    nc,
+		tracker: t,
+		stats:   stats,
+		idle:    opts.IdleTimeout,
+	}
+	if stats.Protocol == "websocket" {
+		c.in = &frameCounter{}
+		c.out = &frameCounter{skipHTTP: true}
+	}
+
+	// the server may have set deadlines for the request, which must not apply to the tunnel
+	if err := c.touch(); err != nil {
+		_ = nc.Close()
+		return nil, nil, err
+	}
+
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		_ = nc.Close()
+		return nil, nil, errShuttingDown
+	}
+	t.conns[c] = struct{}{}
+	t.mu.Unlock()
+
+	if opts.MaxLifetime > 0 {
+		c.lifetime.Store(time.AfterFunc(opts.MaxLifetime, func() { _ = c.Close() }))
+	}
+	stats.Upgraded.Store(true)
+
+	// the buffered reader may hold data the client sent after the request,
+	// the writer is replaced so that the response is counted.
+	return c, bufio.NewReadWriter(brw.Reader, bufio.NewWriter(c)), nil
+}
+
+// Close closes every upgraded connection, sending WebSocket clients a going away close frame
+// when it can be done without interrupting a frame, and rejects upgrades from then on.
+func (t *Tracker) Close(context.Context) error {
+	t.mu.Lock()
+	t.closed = true
+	conns := make([]*conn, 0, len(t.conns))
+	for c := range t.conns {
+		conns = append(conns, c)
+	}
+	t.mu.Unlock()
+
+	var err error
+	for _, c := range conns {
+		err = errors.Join(err, c.goAway())
+	}
+	return err
+}
+
+func (t *Tracker) remove(c *conn) {
+	t.mu.Lock()
+	delete(t.conns, c)
+	t.mu.Unlock()
+}
+
+// Len returns the number of open upgraded connections.
+func (t *Tracker) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.conns)
+}
+
+// hijackWriter replaces the Hijack method of the wrapped ResponseWriter.
+type hijackWriter struct {
+	http.ResponseWriter
+	hijack func() (net.Conn, *bufio.ReadWriter, error)
+}
+
+func (w *hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.hijack()
+}
+
+func (w *hijackWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// conn is an upgraded connection to the client.
+type conn struct {
+	net.Conn
+	tracker *Tracker
+	stats   *Stats
+	idle    time.Duration
+
+	// in and out count WebSocket messages, they are nil for other protocols
+	in  *frameCounter
+	out *frameCounter
+	// writeMu serializes writes, so a close frame can be sent between two frames
+	writeMu sync.Mutex
+
+	lifetime  atomic.Pointer[time.Timer]
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// touch pushes the deadline of the connection forward by the idle timeout.
+func (c *conn) touch() error {
+	if c.idle <= 0 {
+		return c.SetDeadline(time.Time{})
+	}
+	return c.SetDeadline(time.Now().Add(c.idle))
+}
+
+func (c *conn) Read(p []byte) (int, error) {
+	_ = c.touch()
+	n, err := c.Conn.Read(p)
+	c.stats.BytesIn.Add(int64(n))
+	if c.in != nil {
+		// only the proxy reads from the connection, there are no concurrent reads
+		c.stats.MessagesIn.Add(int64(c.in.feed(p[:n])))
+	}
+	return n, err
+}
+
+func (c *conn) Write(p []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	_ = c.touch()
+	n, err := c.Conn.Write(p)
+	c.stats.BytesOut.Add(int64(n))
+	if c.out != nil {
+		c.stats.MessagesOut.Add(int64(c.out.feed(p[:n])))
+	}
+	return n, err
+}
+
+// goAway closes the connection, sending a close frame with status 1001 (going away) first
+// if the connection is a WebSocket that is not in the middle of a frame.
+func (c *conn) goAway() error {
+	c.writeMu.Lock()
+	if c.out != nil && c.out.atBoundary() {
+		_ = c.SetWriteDeadline(time.Now().Add(time.Second))
+		_, _ = c.Conn.Write([]byte{0x88, 0x02, 0x03, 0xe9})
+	}
+	c.writeMu.Unlock()
+	return c.Close()
+}
+
+func (c *conn) Close() error {
+	c.closeOnce.Do(func() {
+		if t := c.lifetime.Load(); t != nil {
+			t.Stop()
+		}
+		c.tracker.remove(c)
+		c.closeErr = c.Conn.Close()
+	})
+	return c.closeErr
+}
@@ -0,0 +1,284 @@
+package upgrade
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/alx99/ika"
+	"github.com/matryer/is"
+)
+
+// frame returns a WebSocket frame with the given first byte and payload, masked if mask is set.
+func frame(b0 byte, payload string, mask bool) []byte {
+	f := []byte{b0}
+	var maskBit byte
+	if mask {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n < 126:
+		f = append(f, maskBit|byte(n))
+	case n <= 0xffff:
+		f = append(f, maskBit|126, byte(n>>8), byte(n))
+	default:
+		f = append(f, maskBit|127, 0, 0, 0, 0, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	if mask {
+		f = append(f, 1, 2, 3, 4)
+	}
+	return append(f, payload...)
+}
+
+func concat(frames ...[]byte) []byte {
+	var b []byte
+	for _, f := range frames {
+		b = append(b, f...)
+	}
+	return b
+}
+
+func TestFrameCounter(t *testing.T) {
+	t.Parallel()
+
+	long := string(make([]byte, 300))
+	huge := string(make([]byte, 70000))
+
+	tests := []struct {
+		name     string
+		skipHTTP bool
+		data     []byte
+		want     int
+	}{
+		{name: "text", data: frame(0x81, "hello", false), want: 1},
+		{name: "masked binary", data: frame(0x82, "hello", true), want: 1},
+		{name: "extended length", data: concat(frame(0x81, long, true), frame(0x81, huge, false)), want: 2},
+		{name: "fragmented", data: concat(frame(0x01, "hel", false), frame(0x00, "l", false), frame(0x80, "o", false)), want: 1},
+		{name: "control frames", data: concat(frame(0x89, "ping", true), frame(0x8a, "pong", false), frame(0x88, "", false)), want: 0},
+		{name: "control frame between fragments", data: concat(frame(0x01, "a", false), frame(0x89, "", false), frame(0x80, "b", false)), want: 1},
+		{name: "HTTP header", skipHTTP: true, data: concat([]byte("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\n\r\n"), frame(0x81, "\r\n", false)), want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			is := is.New(t)
+
+			c := frameCounter{skipHTTP: tt.skipHTTP}
+			is.Equal(c.feed(tt.data), tt.want)
+			is.True(c.atBoundary())
+
+			// the result does not depend on how the stream is split
+			c = frameCounter{skipHTTP: tt.skipHTTP}
+			got := 0
+			for _, b := range tt.data {
+				got += c.feed([]byte{b})
+			}
+			is.Equal(got, tt.want)
+		})
+	}
+}
+
+// newGateway starts an upstream that echoes everything after switching protocols
+// and a gateway proxying to it. Stats of finished requests are sent on the returned channel.
+func newGateway(t *testing.T, opts Options) (*httptest.Server, *Tracker, chan *Stats) {
+	t.Helper()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !IsUpgrade(r) {
+			_, _ = w.Write([]byte("plain"))
+			return
+		}
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n")
+		_ = brw.Flush()
+		_, _ = io.Copy(conn, brw)
+	}))
+	t.Cleanup(upstream.Close)
+
+	u, _ := url.Parse(upstream.URL)
+	rp := httputil.NewSingleHostReverseProxy(u)
+
+	tracker := NewTracker()
+	statsCh := make(chan *Stats, 1)
+	h := tracker.Handler(opts, ika.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		rp.ServeHTTP(w, r)
+		return nil
+	}))
+	gw := httptest.NewServer(WithStats(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ika.ToHTTPHandler(h, nil).ServeHTTP(w, r)
+		if stats := StatsFrom(r.Context()); stats != nil {
+			select {
+			case statsCh <- stats:
+			default:
+			}
+		}
+	})))
+	t.Cleanup(gw.Close)
+
+	return gw, tracker, statsCh
+}
+
+// dial sends an upgrade request to the gateway and returns the connection and the response.
+func dial(t *testing.T, gw *httptest.Server, protocol string) (net.Conn, *bufio.Reader, *http.Response) {
+	t.Helper()
+	conn, err := net.Dial("tcp", gw.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: gateway\r\nConnection: Upgrade\r\nUpgrade: "+protocol+"\r\n\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, br, resp
+}
+
+func TestTracker_Handler(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		opts     Options
+		protocol string
+		want     int
+	}{
+		{name: "allowed by default", protocol: "websocket", want: http.StatusSwitchingProtocols},
+		{name: "allowed protocol", opts: Options{Protocols: []string{"websocket"}}, protocol: "WebSocket", want: http.StatusSwitchingProtocols},
+		{name: "disabled", opts: Options{Disabled: true}, protocol: "websocket", want: http.StatusForbidden},
+		{name: "protocol not allowed", opts: Options{Protocols: []string{"websocket"}}, protocol: "h2c", want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			is := is.New(t)
+
+			gw, _, _ := newGateway(t, tt.opts)
+			_, _, resp := dial(t, gw, tt.protocol)
+			is.Equal(resp.StatusCode, tt.want)
+		})
+	}
+
+	t.Run("plain requests are not affected", func(t *testing.T) {
+		t.Parallel()
+		is := is.New(t)
+
+		gw, _, _ := newGateway(t, Options{Disabled: true})
+		resp, err := http.Get(gw.URL)
+		is.NoErr(err)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		is.Equal(string(body), "plain")
+	})
+}
+
+func TestTracker_stats(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	gw, _, statsCh := newGateway(t, Options{})
+	conn, br, resp := dial(t, gw, "websocket")
+	is.Equal(resp.StatusCode, http.StatusSwitchingProtocols)
+
+	msgs := concat(frame(0x81, "hello", true), frame(0x89, "", true), frame(0x02, "wor", true), frame(0x80, "ld", true))
+	_, err := conn.Write(msgs)
+	is.NoErr(err)
+
+	echo := make([]byte, len(msgs))
+	_, err = io.ReadFull(br, echo)
+	is.NoErr(err)
+	is.NoErr(conn.Close())
+
+	select {
+	case stats := <-statsCh:
+		is.True(stats.Upgraded.Load())
+		is.Equal(stats.Protocol, "websocket")
+		is.Equal(stats.BytesIn.Load(), int64(len(msgs)))
+		is.True(stats.BytesOut.Load() > int64(len(msgs))) // the response is counted as well
+		is.Equal(stats.MessagesIn.Load(), int64(2))
+		is.Equal(stats.MessagesOut.Load(), int64(2))
+	case <-time.After(2 * time.Second):
+		t.Fatal("connection was not closed")
+	}
+}
+
+func TestTracker_limits(t *testing.T) {
+	t.Parallel()
+
+	// closed reports whether the gateway closes conn within timeout
+	closed := func(conn net.Conn, br *bufio.Reader, timeout time.Duration) bool {
+		_ = conn.SetReadDeadline(time.Now().Add(timeout))
+		_, err := io.Copy(io.Discard, br)
+		var netErr net.Error
+		return err == nil || !errors.As(err, &netErr) || !netErr.Timeout()
+	}
+
+	t.Run("idle timeout", func(t *testing.T) {
+		t.Parallel()
+		is := is.New(t)
+
+		gw, tracker, _ := newGateway(t, Options{IdleTimeout: 100 * time.Millisecond})
+		conn, br, _ := dial(t, gw, "websocket")
+		is.Equal(tracker.Len(), 1)
+		is.True(closed(conn, br, time.Second)) // idle connection is closed
+	})
+
+	t.Run("activity postpones idle timeout", func(t *testing.T) {
+		t.Parallel()
+		is := is.New(t)
+
+		gw, _, _ := newGateway(t, Options{IdleTimeout: 200 * time.Millisecond})
+		conn, br, _ := dial(t, gw, "websocket")
+		for range 4 {
+			time.Sleep(100 * time.Millisecond)
+			_, err := conn.Write(frame(0x81, "a", true))
+			is.NoErr(err)
+		}
+		is.True(!closed(conn, br, 50*time.Millisecond)) // connection is still open
+	})
+
+	t.Run("max lifetime", func(t *testing.T) {
+		t.Parallel()
+		is := is.New(t)
+
+		gw, tracker, _ := newGateway(t, Options{MaxLifetime: 100 * time.Millisecond})
+		conn, br, _ := dial(t, gw, "websocket")
+		is.True(closed(conn, br, time.Second))
+		time.Sleep(10 * time.Millisecond)
+		is.Equal(tracker.Len(), 0) // closed connections are forgotten
+	})
+
+	t.Run("shutdown", func(t *testing.T) {
+		t.Parallel()
+		is := is.New(t)
+
+		gw, tracker, _ := newGateway(t, Options{})
+		conn, br, _ := dial(t, gw, "websocket")
+		is.NoErr(tracker.Close(t.Context()))
+
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		rest, _ := io.ReadAll(br)
+		is.Equal(rest, []byte{0x88, 0x02, 0x03, 0xe9}) // client is told the gateway is going away
+
+		_, _, resp := dial(t, gw, "websocket")
+		is.Equal(resp.StatusCode, http.StatusBadGateway) // upgrades are rejected after shutdown
+	})
+}
@@ -1,6 +1,7 @@
 package ika
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
@@ -14,33 +15,63 @@ import (
 	"time"
 
 	"github.com/alx99/ika/internal/config"
-	"github.com/alx99/ika/internal/http/router"
 	"github.com/alx99/ika/internal/http/server"
 	"github.com/alx99/ika/internal/logger"
 )
 
 var start = time.Now()
 
+// Source describes where the configuration is loaded from.
+type Source struct {
+	// URI is the path or URL of the configuration.
+	URI string
+
+	// PollInterval is the interval at which the configuration is checked for changes.
+	// Polling is disabled if it is zero.
+	PollInterval time.Duration
+
+	// CachePath is where the last good configuration of a remote source is cached.
+	// If it is empty, a path in the user cache directory is used. "-" disables caching.
+	CachePath string
+}
+
 // Run starts Ika
-func Run(configPath string, options config.ComptimeOpts) {
-	cfg, err := config.Read(configPath)
+func Run(src Source, upgrade Upgrade, options config.ComptimeOpts) {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGQUIT, syscall.SIGTERM)
+	// an upgrade shuts down this process once the new one is ready
+	ctx, handOver := context.WithCancel(ctx)
+	defer handOver()
+
+	w, err := newWatcher(src, options)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
 	}
 
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGQUIT, syscall.SIGTERM)
+	cfg, data, cached, err := w.initial(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	if cached {
+		data = nil // already cached
+	}
 
 	makeServer := func(handler http.Handler, servers []config.Server) server.HTTPServer {
-		if options.Validate {
-			return &mockServer{onListenAndServe: func() { cancel() }}
-		}
 		return server.New(handler, servers)
 	}
 
 	exitOne := false
 
-	flush, err := run(ctx, makeServer, cfg, options)
+	flush, err := run(ctx, makeServer, cfg, options, func(log *slog.Logger, l *liveRouter, s server.HTTPServer) {
+		warnUnknownFields(log, w.uri, data, options.Plugins)
+		w.applied(log, data)
+		if w.interval > 0 {
+			go w.watch(ctx, l, cfg)
+		}
+		go upgrade.watchUpgrades(ctx, log, s, handOver)
+		notifyReady(log)
+	})
 	if err != nil {
 		slog.Error(err.Error())
 		exitOne = !errors.Is(err, context.Canceled)
@@ -58,21 +89,32 @@ func Run(configPath string, options config.ComptimeOpts) {
 	}
 }
 
+func newWatcher(src Source, options config.ComptimeOpts) (*watcher, error) {
+	source, err := config.OpenSource(src.URI, options.ConfigSources)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &watcher{uri: src.URI, source: source, interval: src.PollInterval}
+	if !config.IsLocal(source) && src.CachePath != "-" {
+		w.cachePath = cmp.Or(src.CachePath, config.DefaultCachePath(src.URI))
+	}
+	return w, nil
+}
+
+// run serves cfg until ctx is cancelled.
+// started is called once the servers are listening.
 func run(ctx context.Context,
 	makeServer func(handler http.Handler, servers []config.Server) server.HTTPServer,
 	cfg config.Config,
 	opts config.ComptimeOpts,
+	started func(log *slog.Logger, l *liveRouter, s server.HTTPServer),
 ) (func() error, error) {
 	log, flush := logger.Initialize(ctx, cfg.Ika.Logger)
 
-	router, err := router.New(cfg, opts, log)
-	if err != nil {
-		return flush, fmt.Errorf("failed to create router: %w", err)
-	}
-
-	err = router.Build(ctx)
+	router, err := newLiveRouter(ctx, cfg, opts, log)
 	if err != nil {
-		return flush, fmt.Errorf("failed to build router: %w", err)
+		return flush, err
 	}
 
 	s := makeServer(router, cfg.Servers)
@@ -80,6 +122,9 @@ func run(ctx context.Context,
 	if err != nil {
 		return flush, fmt.Errorf("failed to start: %w", err)
 	}
+	if err := router.start(ctx); err != nil {
+		return flush, errors.Join(fmt.Errorf("failed to start: %w", err), s.Shutdown(ctx), router.Shutdown(ctx))
+	}
 
 	attrs := []any{
 		slog.String("startupTime", time.Since(start).Round(time.Millisecond).String()),
@@ -93,9 +138,12 @@ func run(ctx context.Context,
 		)
 	}
 	log.Info("Ika has started", attrs...)
+	if started != nil {
+		started(log, router, s)
+	}
 
 	<-ctx.Done()
-	slog.Info("Caught shutdown signal, shutting down gracefully...")
+	slog.Info("Shutting down gracefully...")
 
 	ctx, cancel := context.WithTimeoutCause(
 		context.WithoutCancel(ctx),
@@ -134,10 +182,3 @@ func readConfig() (config.Config, error) {
 	}
 	return cfg, nil
 }
-
-type mockServer struct {
-	onListenAndServe func()
-}
-
-func (m *mockServer) ListenAndServe() error            { m.onListenAndServe(); return nil }
-func (m *mockServer) Shutdown(_ context.Context) error { return nil }
@@ -0,0 +1,273 @@
+package ika
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alx99/ika"
+	"github.com/alx99/ika/internal/config"
+	"github.com/alx99/ika/internal/http/router"
+	"github.com/alx99/ika/request"
+)
+
+// defaultDrainTimeout is used when no graceful shutdown timeout is configured.
+const defaultDrainTimeout = 30 * time.Second
+
+// liveRouter serves requests with the current router, which can be replaced at runtime.
+// Replaced routers are torn down once their in-flight requests have finished.
+type liveRouter struct {
+	current atomic.Pointer[servingRouter]
+	opts    config.ComptimeOpts
+	log     *slog.Logger
+	// readiness holds the readiness path of the servers declaring one by server name
+	readiness map[string]string
+	// started is set once the plugins of the first router are started
+	started atomic.Bool
+}
+
+type servingRouter struct {
+	*router.Router
+	// mu is held for reading while a request is served
+	// and acquired for writing when the router is retired.
+	mu sync.RWMutex
+}
+
+func newLiveRouter(ctx context.Context, cfg config.Config, opts config.ComptimeOpts, log *slog.Logger) (*liveRouter, error) {
+	r, err := buildRouter(ctx, cfg, opts, log, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &liveRouter{opts: opts, log: log, readiness: make(map[string]string)}
+	for _, s := range cfg.Servers {
+		if s.ReadinessPath != "" {
+			l.readiness[s.ServerName()] = s.ReadinessPath
+		}
+	}
+	l.current.Store(&servingRouter{Router: r})
+	warnOrder(log, r, nil)
+	return l, nil
+}
+
+// buildRouter builds a router for cfg, taking over the reloadable plugins of prev if it is not nil.
+func buildRouter(ctx context.Context, cfg config.Config, opts config.ComptimeOpts, log *slog.Logger, prev *router.Router) (*router.Router, error) {
+	r, err := router.New(cfg, opts, log)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create router: %w", err)
+	}
+	if prev != nil {
+		r.Inherit(prev)
+	}
+
+	if err = r.Build(ctx); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to build router: %w", err), r.Shutdown(ctx))
+	}
+	return r, nil
+}
+
+func (l *liveRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if path, ok := l.readiness[request.Server(req.Context())]; ok && req.URL.Path == path {
+		l.serveReadiness(w)
+		return
+	}
+
+	for {
+		sr := l.current.Load()
+		// Fails only if the router is being retired,
+		// in which case the replacement has already been stored.
+		if sr.mu.TryRLock() {
+			defer sr.mu.RUnlock()
+			sr.ServeHTTP(w, req)
+			return
+		}
+	}
+}
+
+// serveReadiness answers a readiness probe, which succeeds once the plugins
+// of the current router are started and ready.
+func (l *liveRouter) serveReadiness(w http.ResponseWriter) {
+	err := errors.New("not started")
+	if l.started.Load() {
+		err = l.current.Load().Ready()
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = fmt.Fprintln(w, err)
+		return
+	}
+	_, _ = fmt.Fprintln(w, "ready")
+}
+
+// start starts the plugins of the current router, once the servers are listening.
+func (l *liveRouter) start(ctx context.Context) error {
+	if err := l.current.Load().Start(ctx); err != nil {
+		return err
+	}
+	l.started.Store(true)
+	return nil
+}
+
+// reload builds and starts a router for cfg and replaces the current router with it.
+// The previous router keeps serving its in-flight requests for at most drainTimeout before it is torn down.
+// If the new router cannot be built or started, the current router is kept.
+func (l *liveRouter) reload(ctx context.Context, cfg config.Config, drainTimeout time.Duration) error {
+	r, err := buildRouter(ctx, cfg, l.opts, l.log, l.current.Load().Router)
+	if err != nil {
+		return err
+	}
+	if err := r.Start(ctx); err != nil {
+		return errors.Join(fmt.Errorf("failed to start router: %w", err), r.Shutdown(ctx))
+	}
+
+	old := l.current.Swap(&servingRouter{Router: r})
+	warnOrder(l.log, r, old.Router)
+	go l.retire(ctx, old, cmp.Or(drainTimeout, defaultDrainTimeout))
+	return nil
+}
+
+func (l *liveRouter) retire(ctx context.Context, sr *servingRouter, drainTimeout time.Duration) {
+	drained := make(chan struct{})
+	go func() {
+		// never unlocked, the router is not used again
+		sr.mu.Lock()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-time.After(drainTimeout):
+		l.log.Warn("Tearing down the previous router with requests still in flight", "drainTimeout", drainTimeout)
+	}
+
+	if err := sr.Shutdown(context.WithoutCancel(ctx)); err != nil {
+		l.log.Error("Failed to tear down the previous router", "error", err)
+	}
+}
+
+// Shutdown tears down the current router.
+func (l *liveRouter) Shutdown(ctx context.Context) error {
+	return l.current.Load().Shutdown(ctx)
+}
+
+// warnOrder logs the ordering constraints broken by the plugins of r which ignore their order,
+// except the ones that were already logged for prev.
+func warnOrder(log *slog.Logger, r, prev *router.Router) {
+	var logged config.Problems
+	if prev != nil {
+		logged = prev.Warnings()
+	}
+	for _, problem := range r.Warnings() {
+		if !slices.Contains(logged, problem) {
+			log.Warn("Plugin runs out of order", "path", problem.Path, "problem", problem.Message)
+		}
+	}
+}
+
+// watcher polls a configuration source for changes.
+type watcher struct {
+	uri      string
+	source   ika.ConfigSource
+	interval time.Duration
+	// cachePath is where the last good configuration is kept, empty if caching is disabled.
+	cachePath string
+}
+
+// initial loads the configuration to start with.
+// If the source cannot be loaded, the cached configuration is used instead.
+// It reports whether the configuration was read from the cache.
+func (w *watcher) initial(ctx context.Context) (config.Config, []byte, bool, error) {
+	cfg, data, err := config.Load(ctx, w.source)
+	if err == nil || w.cachePath == "" {
+		return cfg, data, false, err
+	}
+
+	var problems config.Problems
+	if errors.As(err, &problems) {
+		// the source is reachable, the configuration is broken
+		return cfg, data, false, err
+	}
+
+	cached, cacheErr := config.ReadCache(w.cachePath)
+	if cacheErr != nil {
+		return cfg, data, false, err
+	}
+	slog.Warn("Configuration source is unavailable, starting with the cached configuration",
+		"config", w.uri, "cache", w.cachePath, "error", err)
+	return cached, nil, true, nil
+}
+
+// applied records that data, the configuration loaded from the source last, is in use.
+// The source is told through [ika.ConfigCommitter] and data is cached as the last good configuration.
+// data is nil if the configuration was read from the cache.
+func (w *watcher) applied(log *slog.Logger, data []byte) {
+	if data == nil {
+		return
+	}
+	if c, ok := w.source.(ika.ConfigCommitter); ok {
+		c.Commit()
+	}
+	if w.cachePath == "" {
+		return
+	}
+	if err := config.WriteCache(w.cachePath, data); err != nil {
+		log.Warn("Failed to cache configuration", "cache", w.cachePath, "error", err)
+	}
+}
+
+// warnUnknownFields logs the fields of the configuration data which are unknown to Ika or to the
+// plugins created by factories, and therefore ignored.
+func warnUnknownFields(log *slog.Logger, uri string, data []byte, factories map[string]ika.PluginFactory) {
+	for _, problem := range config.UnknownFields(data, factories) {
+		log.Warn("Ignoring unknown configuration field", "config", uri, "path", problem.Path)
+	}
+}
+
+// watch polls the source until ctx is cancelled and applies every new configuration to l.
+func (w *watcher) watch(ctx context.Context, l *liveRouter, current config.Config) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		cfg, data, err := config.Load(ctx, w.source)
+		switch {
+		case errors.Is(err, ika.ErrConfigUnchanged):
+			continue
+		case err != nil:
+			l.log.Error("Failed to load configuration, keeping the current one", "config", w.uri, "error", err)
+			continue
+		}
+		warnUnknownFields(l.log, w.uri, data, l.opts.Plugins)
+
+		if !reflect.DeepEqual(cfg.Servers, current.Servers) || !reflect.DeepEqual(cfg.Ika, current.Ika) {
+			l.log.Warn("Changes to servers and ika require a restart and were not applied", "config", w.uri)
+		}
+		cfg.Servers, cfg.Ika = current.Servers, current.Ika
+
+		if err := l.reload(ctx, cfg, current.Ika.GracefulShutdownTimeout.Dur()); err != nil {
+			l.log.Error("Failed to apply configuration, keeping the current one", "config", w.uri, "error", err)
+			continue
+		}
+
+		current = cfg
+		w.applied(l.log, data)
+		l.log.Info("Configuration reloaded", "config", w.uri, "namespaceCount", len(cfg.Namespaces))
+	}
+}
@@ -0,0 +1,194 @@
+package ika
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alx99/ika"
+	"github.com/alx99/ika/internal/config"
+	"github.com/alx99/ika/request"
+	"github.com/matryer/is"
+)
+
+func TestWatcher_reload(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.Path))
+	}))
+	t.Cleanup(backend.Close)
+
+	path := filepath.Join(t.TempDir(), "ika.yaml")
+	writeConfig := func(route string) {
+		cfg := "servers: [{addr: ':0'}]\nnamespaces: {ns: {mounts: [''], routes: {" + route + ": {}}}}\n"
+		is.NoErr(os.WriteFile(path, []byte(cfg), 0o600))
+	}
+	status := func(l *liveRouter, path string) int {
+		rec := httptest.NewRecorder()
+		l.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, backend.URL+path, nil))
+		return rec.Code
+	}
+
+	writeConfig("/a")
+	w, err := newWatcher(Source{URI: path, PollInterval: 10 * time.Millisecond}, config.ComptimeOpts{})
+	is.NoErr(err)
+	is.Equal(w.cachePath, "") // local files are not cached
+
+	cfg, _, _, err := w.initial(t.Context())
+	is.NoErr(err)
+
+	l, err := newLiveRouter(t.Context(), cfg, config.ComptimeOpts{}, slog.New(slog.DiscardHandler))
+	is.NoErr(err)
+	go w.watch(t.Context(), l, cfg)
+
+	is.Equal(status(l, "/a"), http.StatusOK)
+	is.Equal(status(l, "/b"), http.StatusNotFound)
+
+	writeConfig("/b")
+	deadline := time.Now().Add(5 * time.Second)
+	for status(l, "/b") != http.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatal("configuration was not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	is.Equal(status(l, "/a"), http.StatusNotFound) // old route is gone
+
+	// a broken configuration keeps the current one
+	is.NoErr(os.WriteFile(path, []byte("servers: {"), 0o600))
+	time.Sleep(50 * time.Millisecond)
+	is.Equal(status(l, "/b"), http.StatusOK)
+}
+
+// flakyFactory fails to create its first plugin.
+type flakyFactory struct {
+	created atomic.Int32
+}
+
+func (*flakyFactory) Name() string { return "flaky" }
+
+func (f *flakyFactory) New(context.Context, ika.InjectionContext, map[string]any) (ika.Plugin, error) {
+	if f.created.Add(1) == 1 {
+		return nil, errors.New("temporarily unavailable")
+	}
+	return nopModifier{}, nil
+}
+
+type nopModifier struct{}
+
+func (nopModifier) ModifyRequest(*http.Request) error { return nil }
+func (nopModifier) Teardown(context.Context) error    { return nil }
+
+func TestWatcher_retry(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(backend.Close)
+
+	// the configuration is served over HTTP with an ETag, like a remote source would
+	var body atomic.Value
+	body.Store("servers: [{addr: ':0'}]\nnamespaces: {ns: {mounts: [''], routes: {/a: {}}}}\n")
+	src := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b := body.Load().(string)
+		etag := `"` + strconv.Itoa(len(b)) + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write([]byte(b))
+	}))
+	t.Cleanup(src.Close)
+
+	opts := config.ComptimeOpts{Plugins: map[string]ika.PluginFactory{"flaky": &flakyFactory{}}}
+	w, err := newWatcher(Source{URI: src.URL, PollInterval: 10 * time.Millisecond}, opts)
+	is.NoErr(err)
+
+	cfg, data, _, err := w.initial(t.Context())
+	is.NoErr(err)
+	l, err := newLiveRouter(t.Context(), cfg, opts, slog.New(slog.DiscardHandler))
+	is.NoErr(err)
+	w.applied(l.log, data)
+	go w.watch(t.Context(), l, cfg)
+
+	// the first attempt to apply the configuration fails, a later poll applies it
+	body.Store("servers: [{addr: ':0'}]\nnamespaces: {ns: {mounts: [''], reqModifiers: [{name: flaky}], routes: {/b: {}}}}\n")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rec := httptest.NewRecorder()
+		l.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, backend.URL+"/b", nil))
+		if rec.Code == http.StatusOK {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("configuration was not applied after the failed attempt")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLiveRouter_readiness(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	cfg := config.Config{
+		Servers:    []config.Server{{Addr: ":0", ReadinessPath: "/readyz"}, {Addr: ":1"}},
+		Namespaces: config.Namespaces{"ns": {Mounts: []string{""}, Routes: config.Routes{"/readyz": {}}}},
+	}
+	l, err := newLiveRouter(t.Context(), cfg, config.ComptimeOpts{}, slog.New(slog.DiscardHandler))
+	is.NoErr(err)
+	t.Cleanup(func() { _ = l.Shutdown(context.Background()) })
+
+	probe := func(server string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "http://gateway/readyz", nil)
+		rec := httptest.NewRecorder()
+		l.ServeHTTP(rec, req.WithContext(request.WithServer(req.Context(), server)))
+		return rec
+	}
+
+	rec := probe(":0")
+	is.Equal(rec.Code, http.StatusServiceUnavailable)
+	is.Equal(rec.Body.String(), "not started\n")
+
+	is.NoErr(l.start(t.Context()))
+	rec = probe(":0")
+	is.Equal(rec.Code, http.StatusOK)
+	is.Equal(rec.Body.String(), "ready\n")
+
+	is.Equal(probe(":1").Code, http.StatusBadGateway) // other servers route the path
+}
+
+func TestWatcher_initialFromCache(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	cachePath := filepath.Join(t.TempDir(), "config.json")
+	is.NoErr(config.WriteCache(cachePath, []byte(`{"servers":[{"addr":":8080"}]}`)))
+
+	// nothing listens on this address
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	w, err := newWatcher(Source{URI: srv.URL, CachePath: cachePath}, config.ComptimeOpts{})
+	is.NoErr(err)
+
+	cfg, _, cached, err := w.initial(t.Context())
+	is.NoErr(err)
+	is.True(cached) // source is unreachable
+	is.Equal(cfg.Servers[0].Addr, ":8080")
+
+	w.cachePath = ""
+	_, _, _, err = w.initial(t.Context())
+	is.True(err != nil) // without a cache the error is reported
+}
@@ -0,0 +1,123 @@
+package ika
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/alx99/ika/internal/config"
+	"github.com/alx99/ika/internal/http/router"
+	"github.com/alx99/ika/internal/http/router/caramel"
+)
+
+// PrintRoutes writes every route registered by the configuration at configPath to w.
+func PrintRoutes(ctx context.Context, w io.Writer, configPath string, options config.ComptimeOpts, format string) error {
+	return withRouter(ctx, configPath, options, func(r *router.Router) error {
+		routes := r.Routes()
+
+		switch format {
+		case "json":
+			return writeJSON(w, routes)
+		case "text":
+			tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "METHOD\tHOST\tPATH\tMATCH\tSERVERS\tNAMESPACE\tROUTE\tPLUGINS")
+			for _, route := range routes {
+				method, host, path := caramel.DecomposePattern(route.Pattern)
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+					orDash(method), orDash(host), path, orDash(route.Match), orDash(strings.Join(route.Servers, ",")),
+					route.Namespace, orDash(route.Route), orDash(strings.Join(route.Plugins, ",")))
+			}
+			return tw.Flush()
+		default:
+			return fmt.Errorf("unknown format %q", format)
+		}
+	})
+}
+
+type matchReport struct {
+	router.MatchResult
+	Method string `json:"method"`
+	URL    string `json:"upstreamURL"`
+	Host   string `json:"upstreamHost"`
+}
+
+// PrintMatch writes to w which route of the configuration at configPath would handle req,
+// and what the request would look like when sent upstream.
+// Nothing is sent upstream.
+func PrintMatch(ctx context.Context, w io.Writer, configPath string, options config.ComptimeOpts, format string, req *http.Request) error {
+	return withRouter(ctx, configPath, options, func(r *router.Router) error {
+		res, err := r.Match(req)
+		if errors.Is(err, router.ErrNoMatch) {
+			return fmt.Errorf("no route matches %s %s", req.Method, req.URL)
+		}
+		if err != nil {
+			return fmt.Errorf("request modifier failed for route %q: %w", res.Pattern, err)
+		}
+
+		report := matchReport{
+			MatchResult: res,
+			Method:      res.Upstream.Method,
+			URL:         res.Upstream.URL.String(),
+			Host:        res.Upstream.Host,
+		}
+
+		switch format {
+		case "json":
+			return writeJSON(w, report)
+		case "text":
+			tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			fmt.Fprintf(tw, "Namespace:\t%s\n", report.Namespace)
+			fmt.Fprintf(tw, "Mount:\t%s\n", orDash(report.Mount))
+			fmt.Fprintf(tw, "Route:\t%s\n", orDash(report.Route))
+			fmt.Fprintf(tw, "Pattern:\t%s\n", report.Pattern)
+			fmt.Fprintf(tw, "Match:\t%s\n", orDash(report.Match))
+			fmt.Fprintf(tw, "Servers:\t%s\n", orDash(strings.Join(report.Servers, ", ")))
+			fmt.Fprintf(tw, "Plugins:\t%s\n", orDash(strings.Join(report.Plugins, ", ")))
+			fmt.Fprintf(tw, "Trimmed path:\t%s\n", report.TrimmedPath)
+			fmt.Fprintf(tw, "Upstream:\t%s %s\n", report.Method, report.URL)
+			fmt.Fprintf(tw, "Host header:\t%s\n", report.Host)
+			return tw.Flush()
+		default:
+			return fmt.Errorf("unknown format %q", format)
+		}
+	})
+}
+
+// withRouter builds the router for the configuration at configPath,
+// calls fn with it and tears it down afterwards.
+func withRouter(ctx context.Context, configPath string, options config.ComptimeOpts, fn func(*router.Router) error) error {
+	cfg, _, err := loadConfig(ctx, configPath, options)
+	if err != nil {
+		return err
+	}
+
+	r, err := router.New(cfg, options, slog.New(slog.DiscardHandler))
+	if err != nil {
+		return err
+	}
+
+	if err := r.Build(ctx); err != nil {
+		return errors.Join(err, r.Shutdown(ctx))
+	}
+
+	return errors.Join(fn(r), r.Shutdown(ctx))
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,17 @@
+package ika
+
+import (
+	"io"
+
+	"github.com/alx99/ika/internal/config"
+)
+
+// PrintSchema writes the JSON Schema of the configuration to w,
+// including the config schemas of the registered plugins.
+func PrintSchema(w io.Writer, options config.ComptimeOpts) error {
+	s, err := config.Schema(options.Plugins)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, s)
+}
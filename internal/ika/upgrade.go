@@ -0,0 +1,159 @@
+package ika
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"time"
+
+	"github.com/alx99/ika/internal/http/server"
+)
+
+// envReadyFD is the file descriptor a process started by an upgrade reports its readiness on.
+const envReadyFD = "IKA_READY_FD"
+
+// defaultUpgradeTimeout is how long to wait for the new process of an upgrade by default.
+const defaultUpgradeTimeout = 30 * time.Second
+
+// executable is the path this process was started from, resolved before
+// the binary could have been replaced by a new version.
+var executable, _ = os.Executable()
+
+// Upgrade configures zero-downtime upgrades, where the running process starts
+// a new one from the binary at the path it was started from and hands over its listeners.
+type Upgrade struct {
+	// Binary is the path of the binary to start, the binary of the running process is used if it is empty.
+	Binary string
+
+	// Timeout is how long to wait for the new process to be ready before it is stopped and the upgrade is abandoned.
+	Timeout time.Duration
+}
+
+// handoffServer is a server which can hand its listeners over to another process.
+type handoffServer interface {
+	server.HTTPServer
+	Handoff(cmd *exec.Cmd) error
+	Detach()
+}
+
+// watchUpgrades upgrades the process once an upgrade signal is received.
+// If the new process is ready, done is called to shut down this process.
+func (u Upgrade) watchUpgrades(ctx context.Context, log *slog.Logger, s server.HTTPServer, done func()) {
+	hs, ok := s.(handoffServer)
+	if !ok || len(upgradeSignals) == 0 {
+		return
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, upgradeSignals...)
+	defer signal.Stop(sig)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sig:
+		}
+
+		start := time.Now()
+		log.Info("Upgrading")
+		pid, err := u.upgrade(ctx, hs)
+		if err != nil {
+			log.Error("Upgrade failed", slog.String("error", err.Error()))
+			continue
+		}
+
+		log.Info("Upgrade complete, shutting down",
+			slog.Int("pid", pid), slog.String("dur", time.Since(start).Round(time.Millisecond).String()))
+		hs.Detach()
+		done()
+		return
+	}
+}
+
+// upgrade starts the new process and waits until it is ready, returning its process ID.
+func (u Upgrade) upgrade(ctx context.Context, s handoffServer) (int, error) {
+	ready, readyW, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+	defer ready.Close()
+
+	//nolint:gosec // the binary is configured by the operator
+	cmd := exec.Command(cmp.Or(u.Binary, executable), os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = []*os.File{readyW}
+	cmd.Env = append(os.Environ(), envReadyFD+"=3")
+
+	err = s.Handoff(cmd)
+	if err == nil {
+		err = cmd.Start()
+	}
+	// the descriptors have been duplicated into the new process
+	for _, f := range cmd.ExtraFiles {
+		_ = f.Close()
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	notified := make(chan error, 1)
+	go func() {
+		_, err := ready.Read(make([]byte, 1))
+		notified <- err
+	}()
+
+	timeout := time.NewTimer(cmp.Or(u.Timeout, defaultUpgradeTimeout))
+	defer timeout.Stop()
+
+	select {
+	case err = <-notified:
+		if err == nil {
+			return cmd.Process.Pid, nil
+		}
+		// the process closed the pipe without reporting, which happens when it exits
+		err = exitError(<-exited)
+	case err = <-exited:
+		err = exitError(err)
+	case <-timeout.C:
+		err = errors.New("new process did not become ready in time")
+	case <-ctx.Done():
+		err = context.Cause(ctx)
+	}
+
+	_ = cmd.Process.Kill()
+	return 0, err
+}
+
+func exitError(err error) error {
+	return fmt.Errorf("new process exited: %w", cmp.Or(err, errors.New("exit status 0")))
+}
+
+// notifyReady reports to the process that started this one as part of an upgrade that it is ready.
+func notifyReady(log *slog.Logger) {
+	v, ok := os.LookupEnv(envReadyFD)
+	if !ok {
+		return
+	}
+	_ = os.Unsetenv(envReadyFD)
+
+	fd, err := strconv.Atoi(v)
+	if err != nil {
+		log.Error("Invalid "+envReadyFD, slog.String("value", v))
+		return
+	}
+	f := os.NewFile(uintptr(fd), "ready")
+	defer f.Close()
+	if _, err := f.Write([]byte{1}); err != nil {
+		log.Error("Failed to report readiness to the previous process", slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package ika
+
+import (
+	"os"
+	"syscall"
+)
+
+// upgradeSignals are the signals which start an upgrade.
+var upgradeSignals = []os.Signal{syscall.SIGUSR2}
@@ -0,0 +1,6 @@
+package ika
+
+import "os"
+
+// upgradeSignals are the signals which start an upgrade, upgrades are not supported on Windows.
+var upgradeSignals []os.Signal
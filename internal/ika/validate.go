@@ -0,0 +1,86 @@
+package ika
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+
+	"github.com/alx99/ika/internal/config"
+	"github.com/alx99/ika/internal/http/router"
+)
+
+type validationReport struct {
+	Config   string          `json:"config"`
+	Valid    bool            `json:"valid"`
+	Problems config.Problems `json:"problems"`
+}
+
+// Validate validates the configuration at configPath and writes a report
+// containing every problem found to w. The format is either "text" or "json".
+// It reports whether the configuration is valid.
+func Validate(ctx context.Context, w io.Writer, configPath string, options config.ComptimeOpts, format string) (bool, error) {
+	if format != "text" && format != "json" {
+		return false, fmt.Errorf("unknown format %q", format)
+	}
+
+	report := validationReport{Config: configPath}
+	report.Problems = validate(ctx, configPath, options)
+	report.Valid = len(report.Problems) == 0
+
+	if format == "json" {
+		if report.Problems == nil {
+			report.Problems = config.Problems{}
+		}
+		return report.Valid, writeJSON(w, report)
+	}
+
+	if report.Valid {
+		_, err := fmt.Fprintf(w, "%s: configuration is valid\n", configPath)
+		return true, err
+	}
+
+	if _, err := fmt.Fprintf(w, "%s: found %d problem(s)\n", configPath, len(report.Problems)); err != nil {
+		return false, err
+	}
+	for _, problem := range report.Problems {
+		if _, err := fmt.Fprintf(w, "  %s\n", problem); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+func validate(ctx context.Context, configPath string, options config.ComptimeOpts) config.Problems {
+	cfg, data, err := loadConfig(ctx, configPath, options)
+	if err != nil {
+		return config.ToProblems(err)
+	}
+	// unknown fields are only warned about when Ika runs, but fail validation
+	unknown := config.UnknownFields(data, options.Plugins)
+
+	// Plugins may log during creation, keep the report clean
+	log := slog.New(slog.DiscardHandler)
+
+	router, err := router.New(cfg, options, log)
+	if err != nil {
+		return config.ToProblems(err)
+	}
+	problems := append(unknown, router.Validate(ctx)...)
+	slices.SortFunc(problems, func(a, b config.Problem) int {
+		return cmp.Or(cmp.Compare(a.Path, b.Path), cmp.Compare(a.Message, b.Message))
+	})
+	return problems
+}
+
+// loadConfig loads the configuration at uri once.
+// Besides the configuration, it returns its JSON encoding.
+func loadConfig(ctx context.Context, uri string, options config.ComptimeOpts) (config.Config, []byte, error) {
+	src, err := config.OpenSource(uri, options.ConfigSources)
+	if err != nil {
+		return config.Config{}, nil, err
+	}
+	return config.Load(ctx, src)
+}
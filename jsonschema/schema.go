@@ -0,0 +1,188 @@
+// Package jsonschema generates JSON Schemas from Go types and validates values against them.
+// Only the subset of JSON Schema (draft 2020-12) needed to describe Ika configuration is supported.
+//
+// Plugins use it to describe their configuration, see ika.ConfigSchemaProvider.
+package jsonschema
+
+import (
+	"cmp"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Draft is the JSON Schema dialect produced by this package.
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is a JSON Schema.
+type Schema struct {
+	Schema      string             `json:"$schema,omitempty"`
+	ID          string             `json:"$id,omitempty"`
+	Ref         string             `json:"$ref,omitempty"`
+	Defs        map[string]*Schema `json:"$defs,omitempty"`
+	Title       string             `json:"title,omitempty"`
+	Description string             `json:"description,omitempty"`
+
+	Type    string   `json:"type,omitempty"`
+	Enum    []any    `json:"enum,omitempty"`
+	Const   any      `json:"const,omitempty"`
+	Pattern string   `json:"pattern,omitempty"`
+	Minimum *float64 `json:"minimum,omitempty"`
+
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+
+	AllOf []*Schema `json:"allOf,omitempty"`
+	AnyOf []*Schema `json:"anyOf,omitempty"`
+	If    *Schema   `json:"if,omitempty"`
+	Then  *Schema   `json:"then,omitempty"`
+
+	// Never is set for the boolean schema false, which no value satisfies.
+	Never bool `json:"-"`
+}
+
+// False returns the schema that no value satisfies.
+func False() *Schema {
+	return &Schema{Never: true}
+}
+
+func (s *Schema) MarshalJSON() ([]byte, error) {
+	if s.Never {
+		return []byte("false"), nil
+	}
+	type alias Schema
+	return json.Marshal((*alias)(s))
+}
+
+func (s *Schema) UnmarshalJSON(b []byte) error {
+	switch string(b) {
+	case "false":
+		*s = Schema{Never: true}
+		return nil
+	case "true":
+		*s = Schema{}
+		return nil
+	}
+	type alias Schema
+	return json.Unmarshal(b, (*alias)(s))
+}
+
+// Map converts the schema into its generic JSON representation.
+func (s *Schema) Map() map[string]any {
+	b, err := json.Marshal(s)
+	if err != nil {
+		panic(err) // a Schema always marshals
+	}
+	m := map[string]any{}
+	_ = json.Unmarshal(b, &m)
+	return m
+}
+
+// FromMap converts the generic JSON representation of a schema into a Schema.
+func FromMap(m map[string]any) (*Schema, error) {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	s := &Schema{}
+	return s, json.Unmarshal(b, s)
+}
+
+// Provider can be implemented by a type to describe its own schema
+// instead of having it derived through reflection.
+type Provider interface {
+	JSONSchema() *Schema
+}
+
+var providerType = reflect.TypeFor[Provider]()
+
+// Reflect derives a schema from the type of v.
+// Struct fields are named after their json tag and unknown properties are disallowed.
+// time.Duration is described as a duration string (e.g. "1m30s") or an integer amount of nanoseconds.
+func Reflect(v any) *Schema {
+	return Reflector{}.Reflect(v)
+}
+
+// Reflector derives schemas from Go types.
+type Reflector struct {
+	// Types overrides the schema of specific types.
+	Types map[reflect.Type]*Schema
+}
+
+// Reflect derives a schema from the type of v, see [Reflect].
+func (r Reflector) Reflect(v any) *Schema {
+	return r.reflectType(reflect.TypeOf(v))
+}
+
+// Duration returns the schema of a duration, which is either a string
+// such as "1m30s" or an integer amount of nanoseconds.
+func Duration() *Schema {
+	return &Schema{AnyOf: []*Schema{
+		{Type: "string", Pattern: `^[-+]?(((\d+(\.\d*)?|\.\d+)(ns|us|µs|μs|ms|s|m|h))+|0)$`},
+		{Type: "integer"},
+	}}
+}
+
+func (r Reflector) reflectType(t reflect.Type) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+
+	if s, ok := r.Types[t]; ok {
+		return s
+	}
+
+	if t.Implements(providerType) {
+		return reflect.Zero(t).Interface().(Provider).JSONSchema()
+	}
+	if reflect.PointerTo(t).Implements(providerType) {
+		return reflect.New(t).Interface().(Provider).JSONSchema()
+	}
+
+	if t == reflect.TypeFor[time.Duration]() {
+		return Duration()
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return r.reflectType(t.Elem())
+	case reflect.Interface:
+		return &Schema{}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Schema{Type: "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Minimum: new(float64)}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: r.reflectType(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: r.reflectType(t.Elem())}
+	case reflect.Struct:
+		s := &Schema{
+			Type:                 "object",
+			Properties:           map[string]*Schema{},
+			AdditionalProperties: False(),
+		}
+		for _, field := range reflect.VisibleFields(t) {
+			if !field.IsExported() || field.Anonymous {
+				continue
+			}
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			s.Properties[cmp.Or(name, field.Name)] = r.reflectType(field.Type)
+		}
+		return s
+	}
+
+	return &Schema{}
+}
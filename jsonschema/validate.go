@@ -0,0 +1,221 @@
+package jsonschema
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// UnknownProperty is the message of errors reporting properties not allowed by additionalProperties.
+const UnknownProperty = "unknown property"
+
+// Error describes a value that does not satisfy a schema.
+type Error struct {
+	// Path leads to the offending value. Elements are either
+	// property names (string) or array indexes (int).
+	// It is empty for the root value.
+	Path []any
+	// Message describes the violation.
+	Message string
+}
+
+func (e Error) Error() string {
+	var sb strings.Builder
+	for _, elem := range e.Path {
+		fmt.Fprintf(&sb, "/%v", elem)
+	}
+	return cmp.Or(sb.String(), "/") + ": " + e.Message
+}
+
+// Validate validates the decoded JSON value v (as produced by [json.Unmarshal] into an any)
+// against the schema s and returns every violation found.
+func Validate(s *Schema, v any) []Error {
+	vd := validator{root: s}
+	return vd.validate(s, nil, v)
+}
+
+type validator struct {
+	root *Schema
+}
+
+func (vd *validator) validate(s *Schema, path []any, v any) []Error {
+	if s == nil {
+		return nil
+	}
+	if s.Never {
+		return []Error{{Path: path, Message: "not allowed"}}
+	}
+
+	if s.Ref != "" {
+		ref, err := vd.resolve(s.Ref)
+		if err != nil {
+			return []Error{{Path: path, Message: err.Error()}}
+		}
+		if errs := vd.validate(ref, path, v); len(errs) > 0 {
+			return errs
+		}
+	}
+
+	if s.Type != "" && !hasType(v, s.Type) {
+		return []Error{{Path: path, Message: fmt.Sprintf("expected %s, got %s", s.Type, typeOf(v))}}
+	}
+
+	var errs []Error
+
+	if s.Enum != nil && !slices.ContainsFunc(s.Enum, func(e any) bool { return equal(e, v) }) {
+		errs = append(errs, Error{Path: path, Message: fmt.Sprintf("must be one of %s", formatEnum(s.Enum))})
+	}
+
+	if s.Const != nil && !equal(s.Const, v) {
+		errs = append(errs, Error{Path: path, Message: fmt.Sprintf("must be %v", s.Const)})
+	}
+
+	if str, ok := v.(string); ok && s.Pattern != "" {
+		re, err := compile(s.Pattern)
+		if err != nil {
+			errs = append(errs, Error{Path: path, Message: err.Error()})
+		} else if !re.MatchString(str) {
+			errs = append(errs, Error{Path: path, Message: fmt.Sprintf("%q does not match %s", str, s.Pattern)})
+		}
+	}
+
+	if n, ok := v.(float64); ok && s.Minimum != nil && n < *s.Minimum {
+		errs = append(errs, Error{Path: path, Message: fmt.Sprintf("must be at least %v", *s.Minimum)})
+	}
+
+	if obj, ok := v.(map[string]any); ok {
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				errs = append(errs, Error{Path: path, Message: fmt.Sprintf("missing required property %q", name)})
+			}
+		}
+		for _, key := range slices.Sorted(maps.Keys(obj)) {
+			keyPath := append(slices.Clip(path), key)
+			if prop, ok := s.Properties[key]; ok {
+				errs = append(errs, vd.validate(prop, keyPath, obj[key])...)
+				continue
+			}
+			if s.AdditionalProperties != nil {
+				if s.AdditionalProperties.Never {
+					errs = append(errs, Error{Path: keyPath, Message: UnknownProperty})
+					continue
+				}
+				errs = append(errs, vd.validate(s.AdditionalProperties, keyPath, obj[key])...)
+			}
+		}
+	}
+
+	if arr, ok := v.([]any); ok && s.Items != nil {
+		for i := range arr {
+			errs = append(errs, vd.validate(s.Items, append(slices.Clip(path), i), arr[i])...)
+		}
+	}
+
+	for _, sub := range s.AllOf {
+		errs = append(errs, vd.validate(sub, path, v)...)
+	}
+
+	if len(s.AnyOf) > 0 {
+		var anyErrs []Error
+		matched := false
+		for _, sub := range s.AnyOf {
+			subErrs := vd.validate(sub, path, v)
+			if len(subErrs) == 0 {
+				matched = true
+				break
+			}
+			anyErrs = append(anyErrs, subErrs...)
+		}
+		if !matched {
+			msgs := make([]string, len(anyErrs))
+			for i := range anyErrs {
+				msgs[i] = anyErrs[i].Message
+			}
+			errs = append(errs, Error{Path: path, Message: strings.Join(slices.Compact(msgs), " or ")})
+		}
+	}
+
+	if s.If != nil && len(vd.validate(s.If, path, v)) == 0 {
+		errs = append(errs, vd.validate(s.Then, path, v)...)
+	}
+
+	return errs
+}
+
+func (vd *validator) resolve(ref string) (*Schema, error) {
+	name, ok := strings.CutPrefix(ref, "#/$defs/")
+	if !ok {
+		return nil, fmt.Errorf("unsupported reference %q", ref)
+	}
+	def, ok := vd.root.Defs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown reference %q", ref)
+	}
+	return def, nil
+}
+
+func hasType(v any, typ string) bool {
+	got := typeOf(v)
+	return got == typ || (typ == "number" && got == "integer")
+}
+
+func typeOf(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func equal(a, b any) bool {
+	// normalize numbers and nested values through JSON
+	ab, errA := json.Marshal(a)
+	bb, errB := json.Marshal(b)
+	if errA != nil || errB != nil {
+		return reflect.DeepEqual(a, b)
+	}
+	return string(ab) == string(bb)
+}
+
+func formatEnum(enum []any) string {
+	vals := make([]string, len(enum))
+	for i := range enum {
+		b, _ := json.Marshal(enum[i])
+		vals[i] = string(b)
+	}
+	return strings.Join(vals, ", ")
+}
+
+var patterns sync.Map // map[string]*regexp.Regexp
+
+func compile(pattern string) (*regexp.Regexp, error) {
+	if re, ok := patterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	patterns.Store(pattern, re)
+	return re, nil
+}
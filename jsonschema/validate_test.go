@@ -0,0 +1,89 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+type testConfig struct {
+	Name     string            `json:"name"`
+	Timeout  time.Duration     `json:"timeout"`
+	Retries  uint              `json:"retries"`
+	Tags     []string          `json:"tags"`
+	Labels   map[string]string `json:"labels"`
+	Optional *struct {
+		Enabled bool `json:"enabled"`
+	} `json:"optional"`
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	s := Reflect(testConfig{})
+	s.Required = []string{"name"}
+	s.Properties["name"].Enum = []any{"a", "b"}
+
+	tests := []struct {
+		name  string
+		value string
+		want  []string
+	}{
+		{
+			name:  "valid",
+			value: `{"name":"a","timeout":"1m30s","retries":3,"tags":["x"],"labels":{"k":"v"},"optional":{"enabled":true}}`,
+		},
+		{
+			name:  "integer duration",
+			value: `{"name":"b","timeout":1000}`,
+		},
+		{
+			name:  "every violation is reported",
+			value: `{"timeout":"soon","retries":-1,"tags":[1],"labels":{"k":true},"optional":{"enabled":"yes","extra":1},"unknown":null}`,
+			want: []string{
+				`/: missing required property "name"`,
+				`/labels/k: expected string, got boolean`,
+				`/optional/enabled: expected boolean, got string`,
+				`/optional/extra: unknown property`,
+				`/retries: must be at least 0`,
+				`/tags/0: expected string, got integer`,
+				`/timeout: "soon" does not match ^[-+]?(((\d+(\.\d*)?|\.\d+)(ns|us|µs|μs|ms|s|m|h))+|0)$ or expected integer, got string`,
+				`/unknown: unknown property`,
+			},
+		},
+		{
+			name:  "enum",
+			value: `{"name":"c"}`,
+			want:  []string{`/name: must be one of "a", "b"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			is := is.New(t)
+
+			var v any
+			is.NoErr(json.Unmarshal([]byte(tt.value), &v))
+
+			var got []string
+			for _, err := range Validate(s, v) {
+				got = append(got, err.Error())
+			}
+			is.Equal(got, tt.want)
+		})
+	}
+}
+
+func TestSchema_roundTrip(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	s := Reflect(testConfig{})
+	got, err := FromMap(s.Map())
+	is.NoErr(err)
+	is.Equal(got, s)
+	is.True(got.AdditionalProperties.Never) // false schema survives the round trip
+}
@@ -10,8 +10,9 @@ import (
 	"strings"
 
 	"github.com/alx99/ika"
-	"github.com/alx99/ika/internal/http/request"
+	"github.com/alx99/ika/jsonschema"
 	"github.com/alx99/ika/pluginutil"
+	"github.com/alx99/ika/request"
 	"github.com/felixge/httpsnoop"
 )
 
@@ -22,7 +23,6 @@ type plugin struct {
 	includeHeaders     bool
 	includeQueryParams bool
 	queryParams        map[string]bool
-	next               ika.Handler
 	log                *slog.Logger
 }
 
@@ -34,6 +34,10 @@ func (*plugin) Name() string {
 	return "access-log"
 }
 
+func (*plugin) ConfigSchema() map[string]any {
+	return jsonschema.Reflect(pConfig{}).Map()
+}
+
 func (*plugin) New(ctx context.Context, ictx ika.InjectionContext, config map[string]any) (ika.Plugin, error) {
 	p := &plugin{}
 
@@ -55,15 +59,23 @@ func (*plugin) New(ctx context.Context, ictx ika.InjectionContext, config map[st
 }
 
 func (p *plugin) Handler(next ika.Handler) ika.Handler {
-	p.next = next
-	return p
+	return ika.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return p.serveHTTP(w, r, next)
+	})
 }
 
-func (p *plugin) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+func (p *plugin) serveHTTP(w http.ResponseWriter, r *http.Request, next ika.Handler) error {
 	var err error
 
 	metrics := httpsnoop.CaptureMetricsFn(w,
-		func(w http.ResponseWriter) { err = p.next.ServeHTTP(w, r) })
+		func(w http.ResponseWriter) { err = next.ServeHTTP(w, r) })
+
+	// the response to an upgrade is written to the hijacked connection
+	stats := request.UpgradeStatsFrom(r.Context())
+	upgraded := stats != nil && stats.Upgraded.Load()
+	if upgraded {
+		metrics.Code = http.StatusSwitchingProtocols
+	}
 
 	attrs := []slog.Attr{
 		slog.Group("request", p.makeReqAttrs(r)...),
@@ -76,6 +88,15 @@ func (p *plugin) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
 			slog.String("pattern", r.Pattern),
 		),
 	}
+	if upgraded {
+		attrs = append(attrs, slog.Group("upgrade",
+			slog.String("protocol", stats.Protocol),
+			slog.Int64("bytesIn", stats.BytesIn.Load()),
+			slog.Int64("bytesOut", stats.BytesOut.Load()),
+			slog.Int64("messagesIn", stats.MessagesIn.Load()),
+			slog.Int64("messagesOut", stats.MessagesOut.Load()),
+		))
+	}
 	if err != nil {
 		attrs = append(attrs, slog.String("error", err.Error()))
 	}
@@ -98,6 +119,17 @@ func (p *plugin) makeReqAttrs(r *http.Request) []any {
 		requestAttrs = append(requestAttrs, slog.String("remoteAddr", r.RemoteAddr))
 	}
 
+	// attributes set by other plugins
+	if id, ok := request.RequestID.Get(r); ok {
+		requestAttrs = append(requestAttrs, slog.String("id", id))
+	}
+	if principal, ok := request.Principal.Get(r); ok {
+		requestAttrs = append(requestAttrs, slog.String("principal", principal))
+	}
+	if ip, ok := request.ClientIP.Get(r); ok {
+		requestAttrs = append(requestAttrs, slog.String("clientIP", ip.String()))
+	}
+
 	if p.includeHeaders {
 		attrs := make([]any, 0, len(p.cfg.Headers))
 		for _, key := range p.cfg.Headers {
@@ -160,6 +192,7 @@ func (p *plugin) getQueryVals(r *http.Request) url.Values {
 }
 
 var (
-	_ ika.OnRequestHook = &plugin{}
-	_ ika.PluginFactory = &plugin{}
+	_ ika.OnRequestHook        = &plugin{}
+	_ ika.PluginFactory        = &plugin{}
+	_ ika.ConfigSchemaProvider = &plugin{}
 )
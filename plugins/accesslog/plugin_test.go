@@ -6,11 +6,13 @@ import (
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
 	"net/url"
 	"strings"
 	"testing"
 
 	"github.com/alx99/ika"
+	"github.com/alx99/ika/request"
 	"github.com/matryer/is"
 )
 
@@ -93,6 +95,7 @@ func TestPlugin_ServeHTTP(t *testing.T) {
 		name          string
 		config        map[string]any
 		request       *http.Request
+		next          ika.HandlerFunc
 		wantLogFields map[string]any
 	}{
 		{
@@ -196,6 +199,29 @@ func TestPlugin_ServeHTTP(t *testing.T) {
 				"request.query.あ": "hi%20there",
 			},
 		},
+		{
+			name:   "with attributes set by other plugins",
+			config: map[string]any{},
+			request: func() *http.Request {
+				req := request.WithAttributes(httptest.NewRequest("GET", "/test", nil))
+				req.Pattern = "/test"
+				return req
+			}(),
+			next: func(w http.ResponseWriter, r *http.Request) error {
+				// set on a copy of the request the access log holds
+				r = r.WithContext(r.Context())
+				request.RequestID.Set(r, "123")
+				request.Principal.Set(r, "alice")
+				request.ClientIP.Set(r, netip.MustParseAddr("192.0.2.1"))
+				w.WriteHeader(200)
+				return nil
+			},
+			wantLogFields: map[string]any{
+				"request.id":        "123",
+				"request.principal": "alice",
+				"request.clientIP":  "192.0.2.1",
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -213,13 +239,15 @@ func TestPlugin_ServeHTTP(t *testing.T) {
 			}, tt.config)
 			is.NoErr(err)
 
-			plugin := p.(*plugin)
-			plugin.next = ika.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+			var next ika.Handler = ika.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
 				w.WriteHeader(200)
 				return nil
 			})
+			if tt.next != nil {
+				next = tt.next
+			}
 
-			err = plugin.ServeHTTP(httptest.NewRecorder(), tt.request)
+			err = p.(*plugin).Handler(next).ServeHTTP(httptest.NewRecorder(), tt.request)
 			is.NoErr(err)
 
 			// Split log entries (there might be multiple JSON objects)
@@ -9,18 +9,20 @@ import (
 	"net/http"
 
 	"github.com/alx99/ika"
+	"github.com/alx99/ika/jsonschema"
 	"github.com/alx99/ika/pluginutil"
 	"github.com/alx99/ika/pluginutil/httperr"
+	"github.com/alx99/ika/request"
 )
 
 type plugin struct {
 	inCreds          []credential
 	strip            bool
 	outUser, outPass string
-	next             ika.Handler
 }
 
 type credential struct {
+	name string
 	user []byte
 	pass []byte
 }
@@ -33,6 +35,14 @@ func (*plugin) Name() string {
 	return "basic-auth"
 }
 
+func (*plugin) ConfigSchema() map[string]any {
+	s := jsonschema.Reflect(pConfig{})
+	credentialTypes := []any{"static", "env"}
+	s.Properties["incoming"].Properties["credentials"].Items.Properties["type"].Enum = credentialTypes
+	s.Properties["outgoing"].Properties["type"].Enum = credentialTypes
+	return s.Map()
+}
+
 func (*plugin) New(ctx context.Context, ictx ika.InjectionContext, config map[string]any) (ika.Plugin, error) {
 	p := &plugin{}
 
@@ -49,6 +59,7 @@ func (*plugin) New(ctx context.Context, ictx ika.InjectionContext, config map[st
 				return nil, err
 			}
 			p.inCreds[i] = credential{
+				name: cred.Name,
 				user: []byte(user),
 				pass: []byte(pass),
 			}
@@ -68,11 +79,12 @@ func (*plugin) New(ctx context.Context, ictx ika.InjectionContext, config map[st
 }
 
 func (p *plugin) Handler(next ika.Handler) ika.Handler {
-	p.next = next
-	return p
+	return ika.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return p.serveHTTP(w, r, next)
+	})
 }
 
-func (p *plugin) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+func (p *plugin) serveHTTP(w http.ResponseWriter, r *http.Request, next ika.Handler) error {
 	if len(p.inCreds) > 0 {
 		invalidCredsErr := httperr.New(http.StatusUnauthorized).
 			WithErr(errors.New("invalid credentials")).
@@ -87,6 +99,7 @@ func (p *plugin) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
 			if subtle.ConstantTimeCompare([]byte(user), cred.user) == 1 &&
 				subtle.ConstantTimeCompare([]byte(pass), cred.pass) == 1 {
 				// Found valid credentials
+				request.Principal.Set(r, cred.name)
 				goto authorized
 			}
 		}
@@ -100,7 +113,7 @@ authorized:
 		r.SetBasicAuth(p.outUser, p.outPass)
 	}
 
-	return p.next.ServeHTTP(w, r)
+	return next.ServeHTTP(w, r)
 }
 
 func (*plugin) Teardown(context.Context) error {
@@ -108,6 +121,7 @@ func (*plugin) Teardown(context.Context) error {
 }
 
 var (
-	_ ika.Middleware    = &plugin{}
-	_ ika.PluginFactory = &plugin{}
+	_ ika.Middleware           = &plugin{}
+	_ ika.PluginFactory        = &plugin{}
+	_ ika.ConfigSchemaProvider = &plugin{}
 )
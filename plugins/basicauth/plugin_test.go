@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/alx99/ika"
+	"github.com/alx99/ika/request"
 	"github.com/matryer/is"
 )
 
@@ -23,12 +24,13 @@ func Test_plugin_ServeHTTP(t *testing.T) {
 		r *http.Request
 	}
 	tests := []struct {
-		name        string
-		fields      fields
-		args        args
-		wantErr     bool
-		wantOutUser string
-		wantOutPass string
+		name          string
+		fields        fields
+		args          args
+		wantErr       bool
+		wantOutUser   string
+		wantOutPass   string
+		wantPrincipal string
 	}{
 		{
 			name: "no incoming credentials",
@@ -114,10 +116,12 @@ func Test_plugin_ServeHTTP(t *testing.T) {
 			fields: fields{
 				inCreds: []credential{
 					{
+						name: "admin",
 						user: []byte("admin"),
 						pass: []byte("adminpass"),
 					},
 					{
+						name: "user",
 						user: []byte("user"),
 						pass: []byte("userpass"),
 					},
@@ -133,19 +137,22 @@ func Test_plugin_ServeHTTP(t *testing.T) {
 					return req
 				}(),
 			},
-			wantErr:     false,
-			wantOutUser: "outUser",
-			wantOutPass: "outPass",
+			wantErr:       false,
+			wantOutUser:   "outUser",
+			wantOutPass:   "outPass",
+			wantPrincipal: "admin",
 		},
 		{
 			name: "multiple valid credentials - second matches",
 			fields: fields{
 				inCreds: []credential{
 					{
+						name: "admin",
 						user: []byte("admin"),
 						pass: []byte("adminpass"),
 					},
 					{
+						name: "user",
 						user: []byte("user"),
 						pass: []byte("userpass"),
 					},
@@ -161,9 +168,10 @@ func Test_plugin_ServeHTTP(t *testing.T) {
 					return req
 				}(),
 			},
-			wantErr:     false,
-			wantOutUser: "outUser",
-			wantOutPass: "outPass",
+			wantErr:       false,
+			wantOutUser:   "outUser",
+			wantOutPass:   "outPass",
+			wantPrincipal: "user",
 		},
 		{
 			name: "strip incoming credentials",
@@ -224,11 +232,12 @@ func Test_plugin_ServeHTTP(t *testing.T) {
 				strip:   tt.fields.strip,
 				outUser: tt.fields.outUser,
 				outPass: tt.fields.outPass,
-				next: ika.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
-					return nil
-				}),
 			}
-			err := p.ServeHTTP(tt.args.w, tt.args.r)
+			next := ika.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+				return nil
+			})
+			r := request.WithAttributes(tt.args.r)
+			err := p.Handler(next).ServeHTTP(tt.args.w, r)
 			if !tt.wantErr {
 				is.NoErr(err)
 			} else {
@@ -236,6 +245,9 @@ func Test_plugin_ServeHTTP(t *testing.T) {
 				return // wanted error
 			}
 
+			principal, _ := request.Principal.Get(r)
+			is.Equal(principal, tt.wantPrincipal)
+
 			user, pass, ok := tt.args.r.BasicAuth()
 			is.True(ok == (tt.wantOutUser != "" || tt.wantOutPass != ""))
 			if tt.wantOutUser != "" || tt.wantOutPass != "" {
@@ -0,0 +1,32 @@
+package bodylimit
+
+import "errors"
+
+type pConfig struct {
+	// MaxRequestBodySize is the largest request body in bytes that is accepted.
+	// Larger requests are rejected with 413 Request Entity Too Large.
+	// Zero means no limit.
+	MaxRequestBodySize int64 `json:"maxRequestBodySize"`
+
+	// BufferRequest reads the whole request body before the request is proxied,
+	// so the upstream never waits for a slow client. It requires MaxRequestBodySize.
+	BufferRequest bool `json:"bufferRequest"`
+
+	// MaxResponseBodySize is the largest response body in bytes that is accepted from the upstream.
+	// Larger responses are replaced with 502 Bad Gateway.
+	// Zero means no limit.
+	MaxResponseBodySize int64 `json:"maxResponseBodySize"`
+}
+
+func (c *pConfig) Validate() error {
+	if c.MaxRequestBodySize < 0 {
+		return errors.New("maxRequestBodySize must not be negative")
+	}
+	if c.MaxResponseBodySize < 0 {
+		return errors.New("maxResponseBodySize must not be negative")
+	}
+	if c.BufferRequest && c.MaxRequestBodySize == 0 {
+		return errors.New("bufferRequest requires maxRequestBodySize")
+	}
+	return nil
+}
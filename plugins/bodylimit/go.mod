@@ -0,0 +1,9 @@
+module github.com/alx99/ika/plugins/bodylimit
+
+go 1.24.0
+
+require (
+	github.com/alx99/ika v0.0.40
+	github.com/alx99/ika/pluginutil v0.0.1
+	github.com/matryer/is v1.4.1
+)
@@ -0,0 +1,208 @@
+// Package bodylimit contains a plugin for limiting the size of request and response bodies in the ika API Gateway.
+package bodylimit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"strconv"
+
+	"github.com/alx99/ika"
+	"github.com/alx99/ika/jsonschema"
+	"github.com/alx99/ika/pluginutil"
+	"github.com/alx99/ika/pluginutil/httperr"
+)
+
+type plugin struct {
+	cfg pConfig
+	log *slog.Logger
+}
+
+func Factory() ika.PluginFactory {
+	return &plugin{}
+}
+
+func (*plugin) Name() string {
+	return "body-limit"
+}
+
+func (*plugin) ConfigSchema() map[string]any {
+	return jsonschema.Reflect(pConfig{}).Map()
+}
+
+func (*plugin) New(_ context.Context, ictx ika.InjectionContext, config map[string]any) (ika.Plugin, error) {
+	p := &plugin{
+		log: ictx.Logger,
+	}
+
+	if err := pluginutil.UnmarshalCfg(config, &p.cfg); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (p *plugin) Handler(next ika.Handler) ika.Handler {
+	return ika.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (err error) {
+		if err := p.limitRequest(w, r); err != nil {
+			return err
+		}
+
+		if p.cfg.MaxResponseBodySize == 0 {
+			return requestError(next.ServeHTTP(w, r))
+		}
+
+		lw := &limitWriter{
+			ResponseWriter: w,
+			max:            p.cfg.MaxResponseBodySize,
+			head:           r.Method == http.MethodHead,
+			header:         w.Header().Clone(),
+		}
+		defer func() {
+			if !lw.suppressed {
+				return
+			}
+			// the proxy aborts the response once it fails to write the body,
+			// nothing has been sent to the client yet so an error response can be written instead
+			if v := recover(); v != nil && v != http.ErrAbortHandler {
+				panic(v)
+			}
+			p.log.LogAttrs(r.Context(), slog.LevelDebug, "Response body too large", slog.Int64("limit", lw.max))
+			err = httperr.New(http.StatusBadGateway).
+				WithErr(fmt.Errorf("response body exceeds %d bytes", lw.max)).
+				WithTitle("Upstream response too large")
+		}()
+
+		return requestError(next.ServeHTTP(lw, r))
+	})
+}
+
+func (*plugin) Teardown(context.Context) error {
+	return nil
+}
+
+// limitRequest limits the body of r, reading it into memory if BufferRequest is set.
+func (p *plugin) limitRequest(w http.ResponseWriter, r *http.Request) error {
+	limit := p.cfg.MaxRequestBodySize
+	if limit == 0 || r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+	if r.ContentLength > limit {
+		return requestTooLarge(limit, fmt.Errorf("content length %d exceeds %d bytes", r.ContentLength, limit))
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	if !p.cfg.BufferRequest {
+		return nil
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return requestTooLarge(limit, err)
+		}
+		return httperr.New(http.StatusBadRequest).
+			WithErr(fmt.Errorf("failed to read request body: %w", err)).
+			WithTitle("Failed to read request body")
+	}
+
+	r.ContentLength = int64(len(body))
+	r.TransferEncoding = nil
+	r.Body = http.NoBody
+	r.GetBody = func() (io.ReadCloser, error) { return http.NoBody, nil }
+	if len(body) > 0 {
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	}
+	return nil
+}
+
+// requestError turns errors caused by a request body exceeding the limit into 413 responses.
+func requestError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return requestTooLarge(maxBytesErr.Limit, err)
+	}
+	return err
+}
+
+func requestTooLarge(limit int64, err error) error {
+	return httperr.New(http.StatusRequestEntityTooLarge).
+		WithErr(err).
+		WithTitle("Request body too large").
+		WithDetail(fmt.Sprintf("The request body must not exceed %d bytes.", limit))
+}
+
+var errResponseTooLarge = errors.New("response body too large")
+
+// limitWriter fails writes once the response body exceeds max bytes.
+// A response whose Content-Length exceeds max is not passed on at all.
+// Responses of unknown length are not buffered, so their headers are sent before the limit can be exceeded;
+// such a response is cut off after max bytes and the proxy aborts the connection.
+type limitWriter struct {
+	http.ResponseWriter
+	max     int64
+	written int64
+	// head is set for HEAD requests, whose responses have no body
+	head bool
+	// header holds the response headers set before the upstream was called
+	header http.Header
+
+	wroteHeader bool
+	// suppressed is set if the response was held back because of its Content-Length
+	suppressed bool
+}
+
+func (w *limitWriter) WriteHeader(code int) {
+	// informational responses may precede the final one
+	if code >= http.StatusOK && !w.wroteHeader {
+		w.wroteHeader = true
+		n, err := strconv.ParseInt(w.Header().Get("Content-Length"), 10, 64)
+		if err == nil && n > w.max && !w.head {
+			w.suppressed = true
+			// the headers of the upstream must not end up in the error response,
+			// the ones set by earlier handlers are kept
+			clear(w.Header())
+			maps.Copy(w.Header(), w.header)
+			return
+		}
+	}
+	if !w.suppressed {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *limitWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.suppressed {
+		return 0, errResponseTooLarge
+	}
+
+	if int64(len(b)) > w.max-w.written {
+		n, _ := w.ResponseWriter.Write(b[:w.max-w.written])
+		w.written += int64(n)
+		return n, errResponseTooLarge
+	}
+
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	return n, err
+}
+
+func (w *limitWriter) Flush() {
+	if !w.suppressed {
+		_ = http.NewResponseController(w.ResponseWriter).Flush()
+	}
+}
+
+func (w *limitWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
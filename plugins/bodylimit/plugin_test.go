@@ -0,0 +1,188 @@
+package bodylimit
+
+import (
+	"cmp"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/alx99/ika"
+	"github.com/matryer/is"
+)
+
+// newGateway starts an upstream serving body and echoing the request body length in a header,
+// and a gateway proxying to it through the plugin.
+func newGateway(t *testing.T, config map[string]any, body string, knownLength bool) *httptest.Server {
+	t.Helper()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, err := io.Copy(io.Discard, r.Body)
+		if err != nil {
+			return
+		}
+		w.Header().Set("X-Received", strconv.FormatInt(n, 10))
+		w.Header().Set("X-Content-Length", strconv.FormatInt(r.ContentLength, 10))
+		if knownLength {
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		} else {
+			_ = http.NewResponseController(w).Flush() // forces a chunked response
+		}
+		_, _ = io.WriteString(w, body)
+	}))
+	t.Cleanup(upstream.Close)
+
+	p, err := Factory().New(t.Context(), ika.InjectionContext{Logger: slog.New(slog.DiscardHandler)}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, _ := url.Parse(upstream.URL)
+	rp := httputil.NewSingleHostReverseProxy(u)
+	var proxyErr error
+	rp.ErrorHandler = func(_ http.ResponseWriter, _ *http.Request, err error) { proxyErr = err }
+
+	h := p.(ika.Middleware).Handler(ika.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		proxyErr = nil
+		rp.ServeHTTP(w, r)
+		return proxyErr
+	}))
+	hh := ika.ToHTTPHandler(h, nil)
+	gw := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Gateway", "1") // set by a handler running before the plugin
+		hh.ServeHTTP(w, r)
+	}))
+	t.Cleanup(gw.Close)
+	return gw
+}
+
+func TestPlugin_Setup(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		config    map[string]any
+		wantError bool
+	}{
+		{name: "valid config", config: map[string]any{"maxRequestBodySize": 1024, "bufferRequest": true, "maxResponseBodySize": 4096}},
+		{name: "negative request size", config: map[string]any{"maxRequestBodySize": -1}, wantError: true},
+		{name: "negative response size", config: map[string]any{"maxResponseBodySize": -1}, wantError: true},
+		{name: "buffering without limit", config: map[string]any{"bufferRequest": true}, wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			is := is.New(t)
+
+			_, err := Factory().New(t.Context(), ika.InjectionContext{Logger: slog.New(slog.DiscardHandler)}, tt.config)
+			if tt.wantError {
+				is.True(err != nil) // expected an error
+			} else {
+				is.NoErr(err)
+			}
+		})
+	}
+}
+
+func TestPlugin_requestLimit(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		config       map[string]any
+		body         string
+		chunked      bool
+		wantStatus   int
+		wantLength   string // Content-Length seen by the upstream
+		wantReceived string
+	}{
+		{name: "within limit", config: map[string]any{"maxRequestBodySize": 5}, body: "hello", wantStatus: http.StatusOK, wantLength: "5", wantReceived: "5"},
+		{name: "known length", config: map[string]any{"maxRequestBodySize": 4}, body: "hello", wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "streamed", config: map[string]any{"maxRequestBodySize": 4}, body: "hello", chunked: true, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "streamed within limit", config: map[string]any{"maxRequestBodySize": 5}, body: "hello", chunked: true, wantStatus: http.StatusOK, wantLength: "-1", wantReceived: "5"},
+		{name: "buffered", config: map[string]any{"maxRequestBodySize": 5, "bufferRequest": true}, body: "hello", chunked: true, wantStatus: http.StatusOK, wantLength: "5", wantReceived: "5"},
+		{name: "buffered too large", config: map[string]any{"maxRequestBodySize": 4, "bufferRequest": true}, body: "hello", chunked: true, wantStatus: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			is := is.New(t)
+
+			gw := newGateway(t, tt.config, "ok", true)
+
+			var body io.Reader = strings.NewReader(tt.body)
+			if tt.chunked {
+				body = io.MultiReader(body) // hides the length
+			}
+			req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, gw.URL, body)
+			is.NoErr(err)
+			resp, err := http.DefaultClient.Do(req)
+			is.NoErr(err)
+			defer resp.Body.Close()
+
+			is.Equal(resp.StatusCode, tt.wantStatus)
+			is.Equal(resp.Header.Get("X-Content-Length"), tt.wantLength)
+			is.Equal(resp.Header.Get("X-Received"), tt.wantReceived)
+		})
+	}
+}
+
+func TestPlugin_responseLimit(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		body        string
+		knownLength bool
+		method      string
+		wantStatus  int
+		wantBody    string
+		wantErr     bool
+	}{
+		{name: "within limit", body: "hello", knownLength: true, wantStatus: http.StatusOK, wantBody: "hello"},
+		{name: "known length", body: "hello world", knownLength: true, wantStatus: http.StatusBadGateway},
+		{name: "HEAD", body: "hello world", knownLength: true, method: http.MethodHead, wantStatus: http.StatusOK},
+		{name: "streamed within limit", body: "hello", wantStatus: http.StatusOK, wantBody: "hello"},
+		{name: "streamed", body: "hello world", wantStatus: http.StatusOK, wantBody: "hello wo", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			is := is.New(t)
+
+			gw := newGateway(t, map[string]any{"maxResponseBodySize": 8}, tt.body, tt.knownLength)
+
+			req, err := http.NewRequestWithContext(t.Context(), cmp.Or(tt.method, http.MethodGet), gw.URL, nil)
+			is.NoErr(err)
+			resp, err := http.DefaultClient.Do(req)
+			is.NoErr(err)
+			defer resp.Body.Close()
+
+			is.Equal(resp.StatusCode, tt.wantStatus)
+			is.Equal(resp.Header.Get("X-Gateway"), "1") // headers set before the plugin are kept
+			if tt.wantStatus == http.StatusBadGateway {
+				is.Equal(resp.Header.Get("X-Received"), "") // upstream headers are dropped
+			}
+			body, err := io.ReadAll(resp.Body)
+			if tt.wantErr {
+				// the chunked response is aborted once the limit is exceeded, after max bytes were sent
+				is.True(errors.Is(err, io.ErrUnexpectedEOF))
+				is.Equal(string(body), tt.wantBody)
+				return
+			}
+			is.NoErr(err)
+			if tt.wantStatus == http.StatusOK {
+				is.Equal(string(body), tt.wantBody)
+			}
+		})
+	}
+}
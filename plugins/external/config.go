@@ -0,0 +1,68 @@
+package external
+
+import (
+	"cmp"
+	"errors"
+	"time"
+)
+
+type pConfig struct {
+	// Socket is the path of the Unix socket the plugin process listens on.
+	// If Command is set, it defaults to a socket in a temporary directory, and a
+	// configured path is given a unique suffix for every launched process.
+	Socket string `json:"socket"`
+
+	// Command launches the plugin process, which must listen on the socket given by
+	// the IKA_PLUGIN_SOCKET environment variable. If it is empty, Ika connects to
+	// a process listening on Socket which is managed elsewhere.
+	Command []string `json:"command"`
+
+	// Config is passed to the launched process encoded as JSON, in a file readable only by the
+	// user running Ika whose path is given by the IKA_PLUGIN_CONFIG_FILE environment variable.
+	Config map[string]any `json:"config"`
+
+	// Timeout limits how long the plugin process may take to decide on a request.
+	//
+	// Defaults to 500ms
+	Timeout time.Duration `json:"timeout"`
+
+	// FailOpen passes requests on unmodified if the plugin process cannot decide on them,
+	// for example because it is not running or does not answer in time.
+	// Otherwise such requests fail with 503 Service Unavailable.
+	FailOpen bool `json:"failOpen"`
+
+	// StartTimeout limits how long a launched process may take to listen on the socket.
+	//
+	// Defaults to 5s
+	StartTimeout time.Duration `json:"startTimeout"`
+
+	// RestartDelay is the time to wait before a launched process that exited is started again.
+	//
+	// Defaults to 1s
+	RestartDelay time.Duration `json:"restartDelay"`
+}
+
+func (c *pConfig) SetDefaults() {
+	c.Timeout = cmp.Or(c.Timeout, 500*time.Millisecond)
+	c.StartTimeout = cmp.Or(c.StartTimeout, 5*time.Second)
+	c.RestartDelay = cmp.Or(c.RestartDelay, time.Second)
+}
+
+func (c *pConfig) Validate() error {
+	if c.Socket == "" && len(c.Command) == 0 {
+		return errors.New("socket or command is required")
+	}
+	if c.Config != nil && len(c.Command) == 0 {
+		return errors.New("config requires command")
+	}
+	if c.Timeout < 0 {
+		return errors.New("timeout must not be negative")
+	}
+	if c.StartTimeout < 0 {
+		return errors.New("startTimeout must not be negative")
+	}
+	if c.RestartDelay < 0 {
+		return errors.New("restartDelay must not be negative")
+	}
+	return nil
+}
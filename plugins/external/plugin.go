@@ -0,0 +1,184 @@
+// Package external contains a plugin delegating decisions on requests to a process outside of the ika API Gateway.
+package external
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/alx99/ika"
+	"github.com/alx99/ika/jsonschema"
+	"github.com/alx99/ika/pluginutil"
+	"github.com/alx99/ika/pluginutil/httperr"
+	"github.com/alx99/ika/request"
+)
+
+type plugin struct {
+	cfg    pConfig
+	log    *slog.Logger
+	dialer net.Dialer
+
+	// ownSocket is set if the socket is chosen by the plugin rather than configured
+	ownSocket bool
+	// configFile is the file holding the configuration of the launched process
+	configFile string
+	// running is set while the launched process is running
+	running atomic.Bool
+	// wg tracks the goroutine supervising the launched process
+	wg sync.WaitGroup
+}
+
+func Factory() ika.PluginFactory {
+	return &plugin{}
+}
+
+func (*plugin) Name() string {
+	return "external"
+}
+
+func (*plugin) ConfigSchema() map[string]any {
+	return jsonschema.Reflect(pConfig{}).Map()
+}
+
+func (*plugin) New(_ context.Context, ictx ika.InjectionContext, config map[string]any) (ika.Plugin, error) {
+	p := &plugin{
+		log: ictx.Logger,
+	}
+
+	if err := pluginutil.UnmarshalCfg(config, &p.cfg); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case p.cfg.Socket == "":
+		p.cfg.Socket = filepath.Join(os.TempDir(), "ika-plugin-"+rand.Text()+".sock")
+		p.ownSocket = true
+	case len(p.cfg.Command) > 0:
+		// the instance replacing this one on a reload launches a process of its own,
+		// which must not take over the socket while this process is still serving
+		ext := filepath.Ext(p.cfg.Socket)
+		p.cfg.Socket = strings.TrimSuffix(p.cfg.Socket, ext) + "-" + rand.Text()[:8] + ext
+		p.ownSocket = true
+	}
+
+	return p, nil
+}
+
+func (p *plugin) ModifyRequest(r *http.Request) error {
+	d, err := p.decide(r)
+	if err != nil {
+		if p.cfg.FailOpen {
+			p.log.LogAttrs(r.Context(), slog.LevelWarn, "Passing on request without decision", slog.String("error", err.Error()))
+			return nil
+		}
+		return httperr.New(http.StatusServiceUnavailable).
+			WithErr(err).
+			WithTitle("Plugin unavailable")
+	}
+	return apply(r, d)
+}
+
+func (p *plugin) Handler(next ika.Handler) ika.Handler {
+	return ika.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		if err := p.ModifyRequest(r); err != nil {
+			return err
+		}
+		return next.ServeHTTP(w, r)
+	})
+}
+
+// decide sends r to the plugin process and returns its decision.
+func (p *plugin) decide(r *http.Request) (*Decision, error) {
+	ctx, cancel := context.WithTimeout(r.Context(), p.cfg.Timeout)
+	defer cancel()
+
+	conn, err := p.dialer.DialContext(ctx, "unix", p.cfg.Socket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to plugin process: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if err := writeMessage(conn, newRequest(r)); err != nil {
+		return nil, fmt.Errorf("failed to send request to plugin process: %w", err)
+	}
+	var d Decision
+	if err := readMessage(conn, &d); err != nil {
+		return nil, fmt.Errorf("failed to receive decision of plugin process: %w", err)
+	}
+	return &d, nil
+}
+
+func newRequest(r *http.Request) *Request {
+	req := &Request{
+		Method:  r.Method,
+		Host:    r.Host,
+		Path:    request.GetPath(r),
+		Query:   r.URL.RawQuery,
+		Header:  r.Header,
+		Pattern: r.Pattern,
+		Params:  request.RouteParams(r),
+	}
+
+	if ip, ok := request.ClientIP.Get(r); ok {
+		req.ClientIP = ip.String()
+	} else if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		req.ClientIP = host
+	}
+	req.Principal, _ = request.Principal.Get(r)
+	req.RequestID, _ = request.RequestID.Get(r)
+	return req
+}
+
+// apply applies d to r, returning an error if d denies r.
+func apply(r *http.Request, d *Decision) error {
+	if d.Deny {
+		status := d.Status
+		if status == 0 {
+			status = http.StatusForbidden
+		}
+		if status < 400 || status > 599 {
+			return fmt.Errorf("plugin process denied request with invalid status %d", status)
+		}
+		err := httperr.New(status).WithErr(errors.New("request denied by plugin process"))
+		if d.Message != "" {
+			err = err.WithDetail(d.Message)
+		}
+		return err
+	}
+
+	for _, name := range d.RemoveHeaders {
+		r.Header.Del(name)
+	}
+	for name, value := range d.SetHeaders {
+		r.Header.Set(name, value)
+	}
+	for name, value := range d.AddHeaders {
+		r.Header.Add(name, value)
+	}
+
+	if d.Path != "" {
+		path, err := url.PathUnescape(d.Path)
+		if err != nil {
+			return fmt.Errorf("plugin process returned invalid path %q: %w", d.Path, err)
+		}
+		r.URL.RawPath = d.Path
+		r.URL.Path = path
+	}
+	if d.Query != nil {
+		r.URL.RawQuery = *d.Query
+	}
+	return nil
+}
@@ -0,0 +1,297 @@
+package external
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alx99/ika"
+	"github.com/alx99/ika/pluginutil/httperr"
+	"github.com/matryer/is"
+)
+
+func TestMain(m *testing.M) {
+	// the test binary serves as the plugin process launched by the tests
+	if socket := os.Getenv("IKA_PLUGIN_SOCKET"); socket != "" {
+		data, err := os.ReadFile(os.Getenv("IKA_PLUGIN_CONFIG_FILE"))
+		if err != nil {
+			panic(err)
+		}
+		var cfg map[string]string
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			panic(err)
+		}
+		l, err := net.Listen("unix", socket)
+		if err != nil {
+			panic(err)
+		}
+		if err := Serve(l, decider(cfg["name"])); err != nil {
+			panic(err)
+		}
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// decider returns a decision function acting on the headers of the requests.
+func decider(name string) func(*Request) *Decision {
+	return func(req *Request) *Decision {
+		switch {
+		case req.Header.Get("X-Deny") != "":
+			return &Decision{Deny: true, Status: http.StatusUnauthorized, Message: "denied"}
+		case req.Header.Get("X-Sleep") != "":
+			time.Sleep(time.Second)
+		case req.Header.Get("X-Crash") != "":
+			os.Exit(1)
+		}
+
+		d := &Decision{
+			SetHeaders:    map[string]string{"X-Decided": name},
+			AddHeaders:    map[string]string{"X-Client": req.ClientIP},
+			RemoveHeaders: []string{"X-Remove"},
+		}
+		if rest, ok := strings.CutPrefix(req.Path, "/old/"); ok {
+			d.Path = "/new/" + rest
+		}
+		if req.Query != "" {
+			query := "rewritten=1"
+			d.Query = &query
+		}
+		return d
+	}
+}
+
+// listen serves decider on a new socket, whose path is returned.
+func listen(t *testing.T) string {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), "plugin.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go func() { _ = Serve(l, decider("connected")) }()
+	return socket
+}
+
+func newPlugin(t *testing.T, config map[string]any) *plugin {
+	t.Helper()
+
+	p, err := Factory().New(t.Context(), ika.InjectionContext{Logger: slog.New(slog.DiscardHandler)}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p.(*plugin)
+}
+
+func TestPlugin_Setup(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		config    map[string]any
+		wantError bool
+	}{
+		{name: "socket", config: map[string]any{"socket": "/run/plugin.sock", "failOpen": true}},
+		{name: "command", config: map[string]any{"command": []string{"plugin"}, "config": map[string]any{"key": "value"}, "timeout": "1s"}},
+		{name: "missing socket and command", config: map[string]any{}, wantError: true},
+		{name: "config without command", config: map[string]any{"socket": "/run/plugin.sock", "config": map[string]any{}}, wantError: true},
+		{name: "negative timeout", config: map[string]any{"socket": "/run/plugin.sock", "timeout": "-1s"}, wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			is := is.New(t)
+
+			_, err := Factory().New(t.Context(), ika.InjectionContext{Logger: slog.New(slog.DiscardHandler)}, tt.config)
+			if tt.wantError {
+				is.True(err != nil) // expected an error
+			} else {
+				is.NoErr(err)
+			}
+		})
+	}
+}
+
+func TestPlugin_ModifyRequest(t *testing.T) {
+	t.Parallel()
+
+	socket := listen(t)
+
+	tests := []struct {
+		name       string
+		target     string
+		header     http.Header
+		wantStatus int // status of the error, if the request fails
+		wantHeader http.Header
+		wantURI    string
+	}{
+		{
+			name:       "request is modified",
+			target:     "/old/path?a=1",
+			header:     http.Header{"X-Remove": {"true"}},
+			wantHeader: http.Header{"X-Decided": {"connected"}, "X-Client": {"192.0.2.1"}, "X-Remove": nil},
+			wantURI:    "/new/path?rewritten=1",
+		},
+		{
+			name:       "request is passed on",
+			target:     "/path",
+			wantHeader: http.Header{"X-Decided": {"connected"}},
+			wantURI:    "/path",
+		},
+		{
+			name:       "request is denied",
+			target:     "/",
+			header:     http.Header{"X-Deny": {"true"}},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "decision times out",
+			target:     "/",
+			header:     http.Header{"X-Sleep": {"true"}},
+			wantStatus: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			is := is.New(t)
+
+			p := newPlugin(t, map[string]any{"socket": socket, "timeout": "100ms"})
+
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+			for name, values := range tt.header {
+				req.Header[name] = values
+			}
+
+			err := p.ModifyRequest(req)
+			if tt.wantStatus != 0 {
+				var httpErr *httperr.Error
+				is.True(errors.As(err, &httpErr))
+				is.Equal(httpErr.Status(), tt.wantStatus)
+				return
+			}
+			is.NoErr(err)
+			for name, values := range tt.wantHeader {
+				is.Equal(req.Header.Values(name), values)
+			}
+			is.Equal(req.URL.RequestURI(), tt.wantURI)
+		})
+	}
+}
+
+func TestPlugin_failOpen(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		failOpen bool
+		wantErr  bool
+	}{
+		{name: "fail closed", wantErr: true},
+		{name: "fail open", failOpen: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			is := is.New(t)
+
+			// nothing listens on the socket
+			p := newPlugin(t, map[string]any{"socket": filepath.Join(t.TempDir(), "plugin.sock"), "failOpen": tt.failOpen})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			err := p.ModifyRequest(req)
+			is.Equal(err != nil, tt.wantErr)
+			is.Equal(p.Ready() != nil, tt.wantErr) // the plugin is not ready if requests fail
+			is.Equal(req.Header.Get("X-Decided"), "")
+		})
+	}
+}
+
+func TestPlugin_process(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	p := newPlugin(t, map[string]any{
+		"command":      []string{os.Args[0]},
+		"config":       map[string]any{"name": "launched"},
+		"restartDelay": "10ms",
+	})
+	is.True(p.Ready() != nil) // the process is not launched yet
+
+	ctx, cancel := context.WithCancel(t.Context())
+	is.NoErr(p.Start(ctx))
+	is.NoErr(p.Ready())
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	is.NoErr(p.ModifyRequest(req))
+	is.Equal(req.Header.Get("X-Decided"), "launched")
+
+	// the process crashes and is restarted
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Crash", "true")
+	is.True(p.ModifyRequest(req) != nil)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		if p.ModifyRequest(req) == nil {
+			break
+		}
+		is.True(time.Now().Before(deadline)) // the process is restarted in time
+		time.Sleep(10 * time.Millisecond)
+	}
+	is.Equal(req.Header.Get("X-Decided"), "launched")
+
+	cancel()
+	is.NoErr(p.Teardown(t.Context()))
+	is.True(p.Ready() != nil) // the process is stopped
+	_, err := os.Stat(p.cfg.Socket)
+	is.True(errors.Is(err, os.ErrNotExist)) // the socket is removed
+	_, err = os.Stat(p.configFile)
+	is.True(errors.Is(err, os.ErrNotExist)) // the config file is removed
+}
+
+func TestPlugin_processReplaced(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	config := map[string]any{
+		"socket":  filepath.Join(t.TempDir(), "plugin.sock"),
+		"command": []string{os.Args[0]},
+		"config":  map[string]any{"name": "launched"},
+	}
+
+	// on a reload, the new instance is started before the old one is torn down
+	oldCtx, cancelOld := context.WithCancel(t.Context())
+	old := newPlugin(t, config)
+	is.NoErr(old.Start(oldCtx))
+	p := newPlugin(t, config)
+	is.True(p.cfg.Socket != old.cfg.Socket) // every process listens on a socket of its own
+	ctx, cancel := context.WithCancel(t.Context())
+	is.NoErr(p.Start(ctx))
+
+	cancelOld()
+	is.NoErr(old.Teardown(t.Context()))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	is.NoErr(p.ModifyRequest(req)) // the process of the new instance is still reachable
+	is.Equal(req.Header.Get("X-Decided"), "launched")
+
+	cancel()
+	is.NoErr(p.Teardown(t.Context()))
+}
@@ -0,0 +1,222 @@
+package external
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// Start launches the plugin process, if the plugin is configured with a command,
+// and restarts it whenever it exits until ctx ends.
+func (p *plugin) Start(ctx context.Context) error {
+	if len(p.cfg.Command) == 0 {
+		return nil
+	}
+
+	if err := p.writeConfig(); err != nil {
+		return err
+	}
+
+	cmd, exited, err := p.launch(ctx)
+	if err != nil {
+		return errors.Join(err, p.removeFiles())
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.supervise(ctx, cmd, exited)
+	}()
+	return nil
+}
+
+// writeConfig writes the configuration of the process to a file only the user running Ika can read,
+// as the environment of a process may be visible to other users.
+func (p *plugin) writeConfig() error {
+	cfg, err := json.Marshal(p.cfg.Config)
+	if err != nil {
+		return fmt.Errorf("failed to encode process config: %w", err)
+	}
+
+	f, err := os.CreateTemp("", "ika-plugin-*.json") // created with mode 0600
+	if err != nil {
+		return fmt.Errorf("failed to write process config: %w", err)
+	}
+	p.configFile = f.Name()
+	_, err = f.Write(cfg)
+	if err = errors.Join(err, f.Close()); err != nil {
+		return errors.Join(fmt.Errorf("failed to write process config: %w", err), p.removeFiles())
+	}
+	return nil
+}
+
+// supervise waits for the launched process to exit and launches it again after RestartDelay.
+func (p *plugin) supervise(ctx context.Context, cmd *exec.Cmd, exited <-chan error) {
+	for {
+		select {
+		case err := <-exited:
+			p.running.Store(false)
+			if ctx.Err() != nil {
+				return
+			}
+			p.log.LogAttrs(ctx, slog.LevelError, "Plugin process exited",
+				slog.Int("pid", cmd.Process.Pid), slog.Any("error", err))
+		case <-ctx.Done():
+			stop(cmd, exited)
+			p.running.Store(false)
+			return
+		}
+
+		for {
+			select {
+			case <-time.After(p.cfg.RestartDelay):
+			case <-ctx.Done():
+				return
+			}
+
+			var err error
+			cmd, exited, err = p.launch(ctx)
+			if err == nil {
+				p.log.LogAttrs(ctx, slog.LevelInfo, "Plugin process restarted", slog.Int("pid", cmd.Process.Pid))
+				break
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			p.log.LogAttrs(ctx, slog.LevelError, "Failed to restart plugin process", slog.String("error", err.Error()))
+		}
+	}
+}
+
+// launch starts the plugin process and waits until it listens on the socket.
+// The returned channel receives the result of the process once it exits.
+func (p *plugin) launch(ctx context.Context) (*exec.Cmd, <-chan error, error) {
+	// a socket left behind by a previous process would keep the new one from listening
+	if err := os.Remove(p.cfg.Socket); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("failed to remove socket: %w", err)
+	}
+
+	cmd := exec.CommandContext(ctx, p.cfg.Command[0], p.cfg.Command[1:]...)
+	cmd.Env = append(os.Environ(), "IKA_PLUGIN_SOCKET="+p.cfg.Socket, "IKA_PLUGIN_CONFIG_FILE="+p.configFile)
+	cmd.Stdout = &logWriter{log: p.log, stream: "stdout"}
+	cmd.Stderr = &logWriter{log: p.log, stream: "stderr"}
+	// the process is asked to exit, and killed if it does not in time
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+	cmd.WaitDelay = 5 * time.Second
+
+	if err := cmd.Start(); err != nil {
+		return nil, nil, fmt.Errorf("failed to start plugin process: %w", err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.After(p.cfg.StartTimeout)
+	for {
+		conn, err := p.dialer.DialContext(ctx, "unix", p.cfg.Socket)
+		if err == nil {
+			_ = conn.Close()
+			p.running.Store(true)
+			return cmd, exited, nil
+		}
+
+		select {
+		case <-ticker.C:
+		case err := <-exited:
+			return nil, nil, fmt.Errorf("plugin process exited before listening on %s: %w", p.cfg.Socket, err)
+		case <-timeout:
+			_ = cmd.Process.Kill()
+			<-exited
+			return nil, nil, fmt.Errorf("plugin process did not listen on %s within %s", p.cfg.Socket, p.cfg.StartTimeout)
+		case <-ctx.Done():
+			stop(cmd, exited)
+			return nil, nil, ctx.Err()
+		}
+	}
+}
+
+// stop waits for the process of cmd, whose context has ended, to exit after being interrupted,
+// and kills it if it does not exit within the wait delay of cmd.
+func stop(cmd *exec.Cmd, exited <-chan error) {
+	select {
+	case <-exited:
+		return
+	case <-time.After(cmd.WaitDelay):
+	}
+	_ = cmd.Process.Kill()
+	<-exited
+}
+
+// Ready reports the plugin as not ready if requests fail because the plugin process cannot be reached.
+func (p *plugin) Ready() error {
+	if p.cfg.FailOpen {
+		return nil
+	}
+	if len(p.cfg.Command) > 0 && !p.running.Load() {
+		return errors.New("plugin process is not running")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.cfg.Timeout)
+	defer cancel()
+	conn, err := p.dialer.DialContext(ctx, "unix", p.cfg.Socket)
+	if err != nil {
+		return fmt.Errorf("failed to connect to plugin process: %w", err)
+	}
+	return conn.Close()
+}
+
+// Teardown waits for the launched process to exit, which is stopped once the context of Start ends.
+// The files of the process are removed even if it does not exit in time.
+func (p *plugin) Teardown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	return errors.Join(err, p.removeFiles())
+}
+
+// removeFiles removes the socket, if it is owned by the plugin, and the configuration file of the process.
+func (p *plugin) removeFiles() error {
+	var errs []error
+	if p.ownSocket {
+		if err := os.Remove(p.cfg.Socket); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	if p.configFile != "" {
+		if err := os.Remove(p.configFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// logWriter logs the lines written by the plugin process.
+type logWriter struct {
+	log    *slog.Logger
+	stream string
+}
+
+func (w *logWriter) Write(b []byte) (int, error) {
+	for line := range bytes.Lines(b) {
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			w.log.LogAttrs(context.Background(), slog.LevelInfo, string(line), slog.String("stream", w.stream))
+		}
+	}
+	return len(b), nil
+}
@@ -0,0 +1,122 @@
+package external
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+)
+
+// maxMessageSize is the size of the largest message accepted from the other side of a connection.
+const maxMessageSize = 1 << 20
+
+// Request describes a request the plugin process decides on.
+// It is sent as a message, which is a JSON document preceded by its length as a 4 byte big-endian integer.
+type Request struct {
+	Method string `json:"method"`
+	Host   string `json:"host"`
+	// Path is the escaped path of the request
+	Path  string `json:"path"`
+	Query string `json:"query"`
+	// Header holds the request headers by their canonical names
+	Header http.Header `json:"header"`
+	// ClientIP is the IP address of the client, see request.ClientIP
+	ClientIP string `json:"clientIP"`
+	// Pattern is the pattern of the route the request matched
+	Pattern string `json:"pattern"`
+	// Params holds the values of the wildcards of the route pattern
+	Params map[string]string `json:"params,omitempty"`
+	// Principal is the principal authenticated by a previous plugin, if any
+	Principal string `json:"principal,omitempty"`
+	// RequestID is the ID of the request assigned by a previous plugin, if any
+	RequestID string `json:"requestID,omitempty"`
+}
+
+// Decision is the answer of the plugin process to a [Request], sent as a message as well.
+// The zero value passes the request on unmodified.
+type Decision struct {
+	// Deny rejects the request with Status and Message
+	Deny bool `json:"deny"`
+	// Status is the status of the response to a denied request, 403 Forbidden by default
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+
+	// SetHeaders sets request headers, replacing their values
+	SetHeaders map[string]string `json:"setHeaders"`
+	// AddHeaders adds values to request headers
+	AddHeaders map[string]string `json:"addHeaders"`
+	// RemoveHeaders removes request headers, before any header is set or added
+	RemoveHeaders []string `json:"removeHeaders"`
+
+	// Path replaces the escaped path of the request, if it is not empty
+	Path string `json:"path"`
+	// Query replaces the raw query of the request, if it is not nil
+	Query *string `json:"query"`
+}
+
+func writeMessage(w io.Writer, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if len(b) > maxMessageSize {
+		return fmt.Errorf("message of %d bytes exceeds %d bytes", len(b), maxMessageSize)
+	}
+	msg := binary.BigEndian.AppendUint32(make([]byte, 0, 4+len(b)), uint32(len(b)))
+	_, err = w.Write(append(msg, b...))
+	return err
+}
+
+func readMessage(r io.Reader, v any) error {
+	var size uint32
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		return err
+	}
+	if size > maxMessageSize {
+		return fmt.Errorf("message of %d bytes exceeds %d bytes", size, maxMessageSize)
+	}
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// Serve serves the plugin protocol on l, calling decide for every request received.
+// Connections may carry any number of requests one after another.
+// It returns once l is closed.
+//
+// Serve is meant for plugin processes written in Go, processes written in other languages
+// implement the protocol on their own.
+func Serve(l net.Listener, decide func(*Request) *Decision) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			r := bufio.NewReader(conn)
+			for {
+				var req Request
+				if err := readMessage(r, &req); err != nil {
+					return
+				}
+				d := decide(&req)
+				if d == nil {
+					d = &Decision{}
+				}
+				if err := writeMessage(conn, d); err != nil {
+					return
+				}
+			}
+		}()
+	}
+}
@@ -19,7 +19,7 @@ type pConfig struct {
 	BanDuration time.Duration `json:"banDuration"`
 
 	// IDHeader is the header containing the identifier to ban.
-	// If empty, the remote IP address will be used.
+	// If empty, the client IP address found by a previous plugin or the remote IP address will be used.
 	// Common values might be "X-Real-IP", "X-Forwarded-For", or "CF-Connecting-IP"
 	IDHeader string `json:"idHeader"`
 }
@@ -7,24 +7,27 @@ import (
 	"log/slog"
 	"net"
 	"net/http"
+	"net/netip"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/alx99/ika"
+	"github.com/alx99/ika/jsonschema"
 	"github.com/alx99/ika/pluginutil"
 	"github.com/alx99/ika/pluginutil/httperr"
+	ikarequest "github.com/alx99/ika/request"
 	"github.com/felixge/httpsnoop"
 )
 
 type plugin struct {
-	cfg pConfig
+	// cfg is replaced when the configuration is reloaded
+	cfg atomic.Pointer[pConfig]
 
-	// tracks failed attempts by IP
+	// tracks failed attempts by IP, kept across configuration reloads
 	attempts *sync.Map // map[string]*ipAttempts
 
-	next ika.Handler
-	log  *slog.Logger
-	once sync.Once
+	log *slog.Logger
 }
 
 type ipAttempts struct {
@@ -42,29 +45,52 @@ func (*plugin) Name() string {
 	return "fail2ban"
 }
 
-func (*plugin) New(ctx context.Context, ictx ika.InjectionContext, config map[string]any) (ika.Plugin, error) {
+func (*plugin) ConfigSchema() map[string]any {
+	s := jsonschema.Reflect(pConfig{})
+	s.Required = []string{"maxRetries", "window"}
+	return s.Map()
+}
+
+// Dependencies makes fail2ban run before basic-auth, as it counts the attempts basic-auth rejects.
+func (*plugin) Dependencies() ika.Dependencies {
+	return ika.Dependencies{Before: []string{"basic-auth"}}
+}
+
+func (*plugin) New(_ context.Context, ictx ika.InjectionContext, config map[string]any) (ika.Plugin, error) {
 	p := &plugin{
 		attempts: &sync.Map{},
 		log:      ictx.Logger,
 	}
 
-	if err := pluginutil.UnmarshalCfg(config, &p.cfg); err != nil {
+	if err := p.Reload(context.Background(), config); err != nil {
 		return nil, err
 	}
+	return p, nil
+}
 
-	p.once.Do(func() {
-		go p.cleanupLoop(ctx)
-	})
+// Start cleans up expired attempts until the plugin is torn down.
+func (p *plugin) Start(ctx context.Context) error {
+	go p.cleanupLoop(ctx)
+	return nil
+}
 
-	return p, nil
+// Reload applies config, keeping the attempts and bans recorded so far.
+func (p *plugin) Reload(_ context.Context, config map[string]any) error {
+	var cfg pConfig
+	if err := pluginutil.UnmarshalCfg(config, &cfg); err != nil {
+		return err
+	}
+	p.cfg.Store(&cfg)
+	return nil
 }
 
 func (p *plugin) Handler(next ika.Handler) ika.Handler {
-	p.next = next
-	return p
+	return ika.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return p.serveHTTP(w, r, next)
+	})
 }
 
-func (p *plugin) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+func (p *plugin) serveHTTP(w http.ResponseWriter, r *http.Request, next ika.Handler) error {
 	ip, err := p.getIP(r)
 	if err != nil {
 		return err
@@ -78,7 +104,7 @@ func (p *plugin) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
 	}
 
 	metrics := httpsnoop.CaptureMetrics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		err = p.next.ServeHTTP(w, r)
+		err = next.ServeHTTP(w, r)
 	}), w, r)
 
 	var httpErr *httperr.Error
@@ -97,12 +123,21 @@ func (p *plugin) Teardown(context.Context) error {
 
 func (p *plugin) getIP(r *http.Request) (string, error) {
 	// If identifier header is set, use that
-	if p.cfg.IDHeader != "" {
-		if id := r.Header.Get(p.cfg.IDHeader); id != "" {
+	if header := p.cfg.Load().IDHeader; header != "" {
+		if id := r.Header.Get(header); id != "" {
+			// an address in the header is the one of the client, which other plugins can use too
+			if ip, err := netip.ParseAddr(id); err == nil {
+				ikarequest.ClientIP.Set(r, ip)
+			}
 			return id, nil
 		}
 	}
 
+	// Then the client address found by a previous plugin
+	if ip, ok := ikarequest.ClientIP.Get(r); ok {
+		return ip.String(), nil
+	}
+
 	// Otherwise use RemoteAddr
 	ip, _, err := net.SplitHostPort(r.RemoteAddr)
 	return ip, err
@@ -124,11 +159,12 @@ func (p *plugin) isBanned(ip string) bool {
 		return false
 	}
 
-	return att.fails >= p.cfg.MaxRetries
+	return att.fails >= p.cfg.Load().MaxRetries
 }
 
 func (p *plugin) recordFailedAttempt(ctx context.Context, ip string) {
 	now := time.Now()
+	cfg := p.cfg.Load()
 
 	val, _ := p.attempts.LoadOrStore(ip, &ipAttempts{})
 	att := val.(*ipAttempts)
@@ -136,15 +172,15 @@ func (p *plugin) recordFailedAttempt(ctx context.Context, ip string) {
 	defer att.Unlock()
 
 	// Reset count if window expired
-	if now.Sub(att.lastTry) > p.cfg.Window {
+	if now.Sub(att.lastTry) > cfg.Window {
 		att.fails = 0
 	}
 
 	att.fails++
 	att.lastTry = now
 
-	if att.fails >= p.cfg.MaxRetries {
-		att.banUntil = now.Add(p.cfg.BanDuration)
+	if att.fails >= cfg.MaxRetries {
+		att.banUntil = now.Add(cfg.BanDuration)
 		p.log.LogAttrs(ctx, slog.LevelInfo, "IP banned", slog.Any("ip", ip), slog.Time("until", att.banUntil))
 	}
 	p.attempts.Store(ip, att)
@@ -153,10 +189,11 @@ func (p *plugin) recordFailedAttempt(ctx context.Context, ip string) {
 // cleanupLoop cleans up expired attempts
 func (p *plugin) cleanupLoop(ctx context.Context) {
 	for {
+		window := p.cfg.Load().Window
 		select {
 		case <-ctx.Done():
 			return
-		case <-time.After(p.cfg.Window):
+		case <-time.After(window):
 			now := time.Now()
 			p.attempts.Range(func(key, value interface{}) bool {
 				att := value.(*ipAttempts)
@@ -164,7 +201,7 @@ func (p *plugin) cleanupLoop(ctx context.Context) {
 				defer att.Unlock()
 
 				// Delete if last attempt was too old or ban expired
-				if now.Sub(att.lastTry) > p.cfg.Window || (!att.banUntil.IsZero() && now.After(att.banUntil)) {
+				if now.Sub(att.lastTry) > window || (!att.banUntil.IsZero() && now.After(att.banUntil)) {
 					p.attempts.Delete(key)
 				}
 
@@ -175,6 +212,7 @@ func (p *plugin) cleanupLoop(ctx context.Context) {
 }
 
 var (
-	_ ika.Middleware    = &plugin{}
-	_ ika.PluginFactory = &plugin{}
+	_ ika.Middleware           = &plugin{}
+	_ ika.PluginFactory        = &plugin{}
+	_ ika.ConfigSchemaProvider = &plugin{}
 )
@@ -5,11 +5,13 @@ import (
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
 	"testing"
 	"time"
 
 	"github.com/alx99/ika"
 	"github.com/alx99/ika/pluginutil/httperr"
+	ikarequest "github.com/alx99/ika/request"
 	"github.com/matryer/is"
 )
 
@@ -149,6 +151,18 @@ func TestPlugin_ServeHTTP(t *testing.T) {
 			wantBanned:     true,
 			wantStatusCode: http.StatusTooManyRequests,
 		},
+		{
+			name:        "client IP from previous plugin",
+			maxRetries:  2,
+			window:      time.Minute,
+			banDuration: time.Minute,
+			requests: []request{
+				{ip: "192.0.2.1:1234", clientIP: "10.0.0.1", wantStatus: http.StatusUnauthorized},
+				{ip: "192.0.2.2:1234", clientIP: "10.0.0.1", wantStatus: http.StatusUnauthorized},
+			},
+			wantBanned:     true,
+			wantStatusCode: http.StatusTooManyRequests,
+		},
 	}
 
 	for _, tt := range tests {
@@ -166,19 +180,22 @@ func TestPlugin_ServeHTTP(t *testing.T) {
 			is.NoErr(err)
 
 			plugin := p.(*plugin)
-			plugin.next = ika.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+			handler := plugin.Handler(ika.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
 				return httperr.New(http.StatusUnauthorized)
-			})
+			}))
 
 			// Run requests
 			for _, req := range tt.requests {
-				r := httptest.NewRequest("GET", "/", nil)
+				r := ikarequest.WithAttributes(httptest.NewRequest("GET", "/", nil))
 				r.RemoteAddr = req.ip
+				if req.clientIP != "" {
+					ikarequest.ClientIP.Set(r, netip.MustParseAddr(req.clientIP))
+				}
 				for k, v := range req.headers {
 					r.Header.Set(k, v)
 				}
 
-				err := plugin.ServeHTTP(httptest.NewRecorder(), r)
+				err := handler.ServeHTTP(httptest.NewRecorder(), r)
 				is.True(err != nil)
 				var httpErr *httperr.Error
 				is.True(errors.As(err, &httpErr))
@@ -186,12 +203,15 @@ func TestPlugin_ServeHTTP(t *testing.T) {
 			}
 
 			// Verify final state
-			r := httptest.NewRequest("GET", "/", nil)
+			r := ikarequest.WithAttributes(httptest.NewRequest("GET", "/", nil))
 			r.RemoteAddr = tt.requests[len(tt.requests)-1].ip
+			if clientIP := tt.requests[len(tt.requests)-1].clientIP; clientIP != "" {
+				ikarequest.ClientIP.Set(r, netip.MustParseAddr(clientIP))
+			}
 			if tt.idHeader != "" {
 				r.Header.Set(tt.idHeader, tt.requests[len(tt.requests)-1].headers[tt.idHeader])
 			}
-			err = plugin.ServeHTTP(httptest.NewRecorder(), r)
+			err = handler.ServeHTTP(httptest.NewRecorder(), r)
 			is.True(err != nil)
 			var httpErr *httperr.Error
 			is.True(errors.As(err, &httpErr))
@@ -215,21 +235,22 @@ func TestPlugin_Cleanup(t *testing.T) {
 	is.NoErr(err)
 
 	plugin := p.(*plugin)
-	plugin.next = ika.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+	handler := plugin.Handler(ika.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
 		return httperr.New(http.StatusUnauthorized)
-	})
+	}))
+	is.NoErr(plugin.Start(t.Context()))
 
 	// Make requests to get banned
-	r := httptest.NewRequest("GET", "/", nil)
+	r := ikarequest.WithAttributes(httptest.NewRequest("GET", "/", nil))
 	r.RemoteAddr = "192.0.2.1:1234"
 
 	for i := 0; i < 2; i++ {
-		err := plugin.ServeHTTP(httptest.NewRecorder(), r)
+		err := handler.ServeHTTP(httptest.NewRecorder(), r)
 		is.True(err != nil)
 	}
 
 	// Verify banned
-	err = plugin.ServeHTTP(httptest.NewRecorder(), r)
+	err = handler.ServeHTTP(httptest.NewRecorder(), r)
 	is.True(err != nil)
 	var httpErr *httperr.Error
 	is.True(errors.As(err, &httpErr))
@@ -239,14 +260,46 @@ func TestPlugin_Cleanup(t *testing.T) {
 	time.Sleep(100 * time.Millisecond)
 
 	// Should be unbanned
-	err = plugin.ServeHTTP(httptest.NewRecorder(), r)
+	err = handler.ServeHTTP(httptest.NewRecorder(), r)
 	is.True(err != nil)
 	is.True(errors.As(err, &httpErr))
 	is.Equal(httpErr.Status(), http.StatusUnauthorized)
 }
 
+func TestPlugin_Reload(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	p, err := Factory().New(t.Context(), ika.InjectionContext{
+		Logger: slog.New(slog.DiscardHandler),
+	}, map[string]any{"maxRetries": 2, "window": "1m"})
+	is.NoErr(err)
+
+	plugin := p.(*plugin)
+	handler := plugin.Handler(ika.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return httperr.New(http.StatusUnauthorized)
+	}))
+	status := func(ip string) int {
+		r := ikarequest.WithAttributes(httptest.NewRequest("GET", "/", nil))
+		r.RemoteAddr = ip + ":1234"
+		var httpErr *httperr.Error
+		is.True(errors.As(handler.ServeHTTP(httptest.NewRecorder(), r), &httpErr))
+		return httpErr.Status()
+	}
+
+	status("192.0.2.1")
+	status("192.0.2.1")
+	is.Equal(status("192.0.2.1"), http.StatusTooManyRequests)
+
+	is.True(plugin.Reload(t.Context(), map[string]any{"maxRetries": 0, "window": "1m"}) != nil) // invalid configuration
+	is.NoErr(plugin.Reload(t.Context(), map[string]any{"maxRetries": 2, "window": "1h", "idHeader": "X-Real-IP"}))
+	is.Equal(plugin.cfg.Load().BanDuration, 2*time.Hour)
+	is.Equal(status("192.0.2.1"), http.StatusTooManyRequests) // bans are kept
+}
+
 type request struct {
 	ip         string
+	clientIP   string // set by a previous plugin
 	headers    map[string]string
 	wantStatus int
 }
@@ -0,0 +1,77 @@
+package mirror
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+type pConfig struct {
+	// Host is the shadow upstream requests are mirrored to. Must be a valid URL including scheme.
+	// For example: https://shadow.internal
+	Host string `json:"host"`
+
+	// Percentage of requests to mirror, between 0 and 100.
+	//
+	// Defaults to 100
+	Percentage *float64 `json:"percentage"`
+
+	// MaxBodySize is the largest request body in bytes that is recorded for mirroring.
+	// Requests with larger bodies are not mirrored, 0 only mirrors requests without a body.
+	//
+	// Defaults to 1 MiB
+	MaxBodySize *int64 `json:"maxBodySize"`
+
+	// Timeout limits how long a mirrored request may take.
+	//
+	// Defaults to 5s
+	Timeout time.Duration `json:"timeout"`
+
+	// MaxConcurrency is the maximum number of mirrored requests in flight.
+	// Requests exceeding it are not mirrored.
+	//
+	// Defaults to 100
+	MaxConcurrency int `json:"maxConcurrency"`
+
+	// RetainHostHeader controls whether to keep the Host header of the primary request.
+	// If false, the Host header is set to the host of the shadow upstream.
+	RetainHostHeader bool `json:"retainHostHeader"`
+}
+
+func (c *pConfig) SetDefaults() {
+	if c.Percentage == nil {
+		c.Percentage = new(float64)
+		*c.Percentage = 100
+	}
+	if c.MaxBodySize == nil {
+		c.MaxBodySize = new(int64)
+		*c.MaxBodySize = 1 << 20
+	}
+	c.Timeout = cmp.Or(c.Timeout, 5*time.Second)
+	c.MaxConcurrency = cmp.Or(c.MaxConcurrency, 100)
+}
+
+func (c *pConfig) Validate() error {
+	u, err := url.Parse(c.Host)
+	if err != nil {
+		return fmt.Errorf("invalid host URL: %w", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("host must be a URL including scheme, got %q", c.Host)
+	}
+	if *c.Percentage < 0 || *c.Percentage > 100 {
+		return errors.New("percentage must be between 0 and 100")
+	}
+	if *c.MaxBodySize < 0 {
+		return errors.New("maxBodySize must not be negative")
+	}
+	if c.Timeout < 0 {
+		return errors.New("timeout must not be negative")
+	}
+	if c.MaxConcurrency < 0 {
+		return errors.New("maxConcurrency must not be negative")
+	}
+	return nil
+}
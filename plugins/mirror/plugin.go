@@ -0,0 +1,262 @@
+// Package mirror contains a plugin for mirroring requests to a shadow upstream in the ika API Gateway.
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/alx99/ika"
+	"github.com/alx99/ika/jsonschema"
+	"github.com/alx99/ika/pluginutil"
+)
+
+// maxDrainSize limits how much of a shadow response is read to reuse its connection.
+const maxDrainSize = 64 << 10
+
+type plugin struct {
+	cfg pConfig
+
+	scheme string
+	host   string
+
+	// client sends mirrored requests with a transport of its own,
+	// so the shadow upstream cannot exhaust the connections of the primary one.
+	client *http.Client
+	// sem limits the number of mirrored requests in flight
+	sem chan struct{}
+
+	// ctx is cancelled on teardown, aborting mirrored requests
+	ctx    context.Context
+	cancel context.CancelFunc
+	// wg tracks mirrored requests, from acquiring their slot until they are done.
+	// mu guards adding to it, which must not happen once Teardown waits for it.
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	closed bool
+
+	log *slog.Logger
+}
+
+func Factory() ika.PluginFactory {
+	return &plugin{}
+}
+
+func (*plugin) Name() string {
+	return "mirror"
+}
+
+func (*plugin) ConfigSchema() map[string]any {
+	s := jsonschema.Reflect(pConfig{})
+	s.Required = []string{"host"}
+	return s.Map()
+}
+
+func (*plugin) New(ctx context.Context, ictx ika.InjectionContext, config map[string]any) (ika.Plugin, error) {
+	p := &plugin{
+		log: ictx.Logger,
+	}
+
+	if err := pluginutil.UnmarshalCfg(config, &p.cfg); err != nil {
+		return nil, err
+	}
+
+	u, _ := url.Parse(p.cfg.Host) // validated by pConfig.Validate
+	p.scheme, p.host = u.Scheme, u.Host
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = p.cfg.MaxConcurrency
+	p.client = &http.Client{
+		Transport: transport,
+		Timeout:   p.cfg.Timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	p.sem = make(chan struct{}, p.cfg.MaxConcurrency)
+	p.ctx, p.cancel = context.WithCancel(context.WithoutCancel(ctx))
+
+	return p, nil
+}
+
+func (p *plugin) HookTripper(rt http.RoundTripper) (http.RoundTripper, error) {
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		return rt.RoundTrip(p.mirror(r))
+	}), nil
+}
+
+// Teardown waits for mirrored requests in flight until ctx is done, then aborts the remaining ones.
+func (p *plugin) Teardown(ctx context.Context) error {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+
+	p.cancel()
+	p.client.CloseIdleConnections()
+	return nil
+}
+
+// mirror sends a copy of r to the shadow upstream in the background.
+// It returns the request to send to the primary upstream. If r has a body, the copy is sent
+// once the primary upstream has read the body, which is recorded while it is being read.
+func (p *plugin) mirror(r *http.Request) *http.Request {
+	if rand.Float64()*100 >= *p.cfg.Percentage {
+		return r
+	}
+	if r.ContentLength > *p.cfg.MaxBodySize {
+		p.log.LogAttrs(r.Context(), slog.LevelDebug, "Request not mirrored, body too large")
+		return r
+	}
+	if !p.acquire() {
+		p.log.LogAttrs(r.Context(), slog.LevelDebug, "Request not mirrored, too many mirrored requests in flight")
+		return r
+	}
+
+	out := r.Clone(p.ctx) // detached from the primary request, which may finish first
+	out.URL.Scheme = p.scheme
+	out.URL.Host = p.host
+	if !p.cfg.RetainHostHeader {
+		out.Host = p.host
+	}
+	out.Body = http.NoBody
+	out.GetBody = nil
+
+	if r.Body == nil || r.Body == http.NoBody {
+		go p.send(out, nil)
+		return r
+	}
+
+	r = r.WithContext(r.Context())
+	r.Body = &teeBody{
+		body:  r.Body,
+		limit: *p.cfg.MaxBodySize,
+		size:  r.ContentLength,
+		done: func(body []byte, ok bool) {
+			if !ok {
+				p.log.LogAttrs(p.ctx, slog.LevelDebug, "Request not mirrored, body too large or not read completely")
+				p.release()
+				return
+			}
+			go p.send(out, body)
+		},
+	}
+	return r
+}
+
+// acquire reserves a slot for a mirrored request, unless too many are in flight
+// or the plugin is torn down. The slot must be given back with release.
+func (p *plugin) acquire() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return false
+	}
+	select {
+	case p.sem <- struct{}{}:
+	default:
+		return false
+	}
+	p.wg.Add(1)
+	return true
+}
+
+func (p *plugin) release() {
+	<-p.sem
+	p.wg.Done()
+}
+
+// send sends out with body to the shadow upstream and releases its slot.
+func (p *plugin) send(out *http.Request, body []byte) {
+	defer p.release()
+
+	out.ContentLength = int64(len(body))
+	if len(body) > 0 {
+		out.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	resp, err := p.client.Do(out)
+	if err != nil {
+		p.log.LogAttrs(p.ctx, slog.LevelDebug, "Mirrored request failed", slog.String("error", err.Error()))
+		return
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainSize))
+	_ = resp.Body.Close()
+}
+
+// teeBody records the body of the primary request while it is read, up to limit bytes.
+// done is called once, with the recorded body and whether it is complete,
+// when the body is read to its end, exceeds the limit or is closed.
+type teeBody struct {
+	body io.ReadCloser
+	// limit is the largest body recorded, size the announced length of the body or -1
+	limit, size int64
+	done        func(body []byte, ok bool)
+
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	finished bool
+}
+
+func (b *teeBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.finished {
+		return n, err
+	}
+	switch {
+	case int64(b.buf.Len()+n) > b.limit:
+		b.finish(false)
+	case err == io.EOF:
+		b.buf.Write(p[:n])
+		b.finish(true)
+	case err != nil:
+		b.finish(false)
+	default:
+		b.buf.Write(p[:n])
+	}
+	return n, err
+}
+
+func (b *teeBody) Close() error {
+	b.mu.Lock()
+	if !b.finished {
+		// the transport stops reading once it has read the announced length
+		b.finish(b.size > 0 && int64(b.buf.Len()) == b.size)
+	}
+	b.mu.Unlock()
+	return b.body.Close()
+}
+
+func (b *teeBody) finish(ok bool) {
+	b.finished = true
+	if ok {
+		b.done(b.buf.Bytes(), true)
+		return
+	}
+	b.buf = bytes.Buffer{}
+	b.done(nil, false)
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
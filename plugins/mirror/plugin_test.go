@@ -0,0 +1,247 @@
+package mirror
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alx99/ika"
+	"github.com/matryer/is"
+)
+
+type received struct {
+	method string
+	uri    string
+	host   string
+	header string
+	body   string
+}
+
+// newUpstream starts a server that reports every request it receives on the returned channel.
+func newUpstream(t *testing.T, delay time.Duration) (*httptest.Server, chan received) {
+	t.Helper()
+	ch := make(chan received, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		time.Sleep(delay)
+		ch <- received{method: r.Method, uri: r.RequestURI, host: r.Host, header: r.Header.Get("X-Test"), body: string(body)}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, ch
+}
+
+func newTripper(t *testing.T, config map[string]any) (http.RoundTripper, *plugin) {
+	t.Helper()
+	p, err := Factory().New(t.Context(), ika.InjectionContext{
+		Scope:  ika.ScopeNamespace,
+		Logger: slog.New(slog.DiscardHandler),
+	}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt, err := p.(ika.TripperHook).HookTripper(http.DefaultTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = p.Teardown(context.Background()) })
+	return rt, p.(*plugin)
+}
+
+func send(t *testing.T, rt http.RoundTripper, url, body string) received {
+	t.Helper()
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, url+"/path?q=1", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Test", "value")
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return received{body: string(b)}
+}
+
+func wait(t *testing.T, ch chan received) (received, bool) {
+	t.Helper()
+	select {
+	case r := <-ch:
+		return r, true
+	case <-time.After(200 * time.Millisecond):
+		return received{}, false
+	}
+}
+
+func TestPlugin_Setup(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		config    map[string]any
+		wantError bool
+	}{
+		{name: "valid config", config: map[string]any{"host": "http://shadow", "percentage": 10, "timeout": "1s"}},
+		{name: "missing host", config: map[string]any{}, wantError: true},
+		{name: "host without scheme", config: map[string]any{"host": "shadow"}, wantError: true},
+		{name: "invalid percentage", config: map[string]any{"host": "http://shadow", "percentage": 101}, wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			is := is.New(t)
+
+			_, err := Factory().New(t.Context(), ika.InjectionContext{Logger: slog.New(slog.DiscardHandler)}, tt.config)
+			if tt.wantError {
+				is.True(err != nil) // expected an error
+			} else {
+				is.NoErr(err)
+			}
+		})
+	}
+}
+
+func TestPlugin_mirror(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	primary, primaryCh := newUpstream(t, 0)
+	shadow, shadowCh := newUpstream(t, 0)
+
+	rt, _ := newTripper(t, map[string]any{"host": shadow.URL})
+
+	resp := send(t, rt, primary.URL, "hello")
+	is.Equal(resp.body, "ok")
+
+	got, ok := wait(t, primaryCh)
+	is.True(ok)
+	is.Equal(got.body, "hello") // primary receives the body
+
+	got, ok = wait(t, shadowCh)
+	is.True(ok) // request is mirrored
+	is.Equal(got, received{
+		method: http.MethodPost,
+		uri:    "/path?q=1",
+		host:   strings.TrimPrefix(shadow.URL, "http://"),
+		header: "value",
+		body:   "hello",
+	})
+}
+
+func TestPlugin_bodyTooLarge(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	primary, primaryCh := newUpstream(t, 0)
+	shadow, shadowCh := newUpstream(t, 0)
+
+	rt, _ := newTripper(t, map[string]any{"host": shadow.URL, "maxBodySize": 4})
+
+	send(t, rt, primary.URL, "hello world")
+	got, ok := wait(t, primaryCh)
+	is.True(ok)
+	is.Equal(got.body, "hello world") // primary receives the whole body
+
+	_, ok = wait(t, shadowCh)
+	is.True(!ok) // large bodies are not mirrored
+}
+
+func TestPlugin_bodyOfUnknownLength(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	primary, primaryCh := newUpstream(t, 0)
+	shadow, shadowCh := newUpstream(t, 0)
+
+	rt, _ := newTripper(t, map[string]any{"host": shadow.URL, "maxBodySize": 4})
+
+	for _, body := range []string{"abc", "hello world"} {
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, primary.URL, io.MultiReader(strings.NewReader(body)))
+		is.NoErr(err)
+		resp, err := rt.RoundTrip(req)
+		is.NoErr(err)
+		_ = resp.Body.Close()
+
+		got, ok := wait(t, primaryCh)
+		is.True(ok)
+		is.Equal(got.body, body) // primary receives the whole body
+	}
+
+	got, ok := wait(t, shadowCh)
+	is.True(ok)
+	is.Equal(got.body, "abc") // body is recorded while the primary reads it
+	_, ok = wait(t, shadowCh)
+	is.True(!ok) // large bodies are not mirrored
+}
+
+func TestPlugin_noBody(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	primary, _ := newUpstream(t, 0)
+	shadow, shadowCh := newUpstream(t, 0)
+
+	rt, _ := newTripper(t, map[string]any{"host": shadow.URL, "maxBodySize": 0})
+
+	send(t, rt, primary.URL, "hello")
+	_, ok := wait(t, shadowCh)
+	is.True(!ok) // requests with a body are not mirrored
+
+	send(t, rt, primary.URL, "")
+	got, ok := wait(t, shadowCh)
+	is.True(ok) // requests without a body are mirrored
+	is.Equal(got.body, "")
+}
+
+func TestPlugin_isolation(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	primary, primaryCh := newUpstream(t, 0)
+	shadow, shadowCh := newUpstream(t, 500*time.Millisecond)
+
+	rt, _ := newTripper(t, map[string]any{"host": shadow.URL, "maxConcurrency": 1, "timeout": "2s"})
+
+	start := time.Now()
+	send(t, rt, primary.URL, "a")
+	send(t, rt, primary.URL, "b")
+	is.True(time.Since(start) < 250*time.Millisecond) // a slow shadow does not slow the primary down
+
+	_, _ = wait(t, primaryCh)
+	_, _ = wait(t, primaryCh)
+
+	select {
+	case got := <-shadowCh:
+		is.Equal(got.body, "a") // only one request fits the concurrency cap
+	case <-time.After(2 * time.Second):
+		t.Fatal("request was not mirrored")
+	}
+	_, ok := wait(t, shadowCh)
+	is.True(!ok) // second request was dropped
+
+	// an unreachable shadow does not fail the primary
+	shadow.Close()
+	rt, _ = newTripper(t, map[string]any{"host": shadow.URL})
+	is.Equal(send(t, rt, primary.URL, "c").body, "ok")
+}
+
+func TestPlugin_percentage(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	primary, _ := newUpstream(t, 0)
+	shadow, shadowCh := newUpstream(t, 0)
+
+	rt, _ := newTripper(t, map[string]any{"host": shadow.URL, "percentage": 0})
+
+	send(t, rt, primary.URL, "")
+	_, ok := wait(t, shadowCh)
+	is.True(!ok) // nothing is mirrored
+}
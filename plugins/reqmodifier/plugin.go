@@ -13,8 +13,9 @@ import (
 	"sync"
 
 	"github.com/alx99/ika"
-	"github.com/alx99/ika/internal/http/request"
+	"github.com/alx99/ika/jsonschema"
 	"github.com/alx99/ika/pluginutil"
+	"github.com/alx99/ika/request"
 )
 
 // segmentPattern matches path segments like {id} or {wildcard...}
@@ -48,6 +49,10 @@ func (*plugin) Name() string {
 	return "req-modifier"
 }
 
+func (*plugin) ConfigSchema() map[string]any {
+	return jsonschema.Reflect(pConfig{}).Map()
+}
+
 func (*plugin) New(ctx context.Context, ictx ika.InjectionContext, config map[string]any) (ika.Plugin, error) {
 	p := &plugin{
 		log: ictx.Logger,
@@ -241,6 +246,7 @@ func decomposePattern(pattern string) (method, host, path string) {
 }
 
 var (
-	_ ika.RequestModifier = &plugin{}
-	_ ika.PluginFactory   = &plugin{}
+	_ ika.RequestModifier      = &plugin{}
+	_ ika.PluginFactory        = &plugin{}
+	_ ika.ConfigSchemaProvider = &plugin{}
 )
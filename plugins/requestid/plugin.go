@@ -13,14 +13,15 @@ import (
 	"time"
 
 	"github.com/alx99/ika"
+	"github.com/alx99/ika/jsonschema"
 	"github.com/alx99/ika/pluginutil"
+	"github.com/alx99/ika/request"
 	"github.com/google/uuid"
 	"github.com/rs/xid"
 	"github.com/segmentio/ksuid"
 )
 
 type plugin struct {
-	next  ika.Handler
 	cfg   pConfig
 	genID func() (string, error)
 
@@ -36,6 +37,12 @@ func (*plugin) Name() string {
 	return "request-id"
 }
 
+func (*plugin) ConfigSchema() map[string]any {
+	s := jsonschema.Reflect(pConfig{})
+	s.Properties["variant"].Enum = []any{vUUIDv4, vUUIDv7, vKSUID, vXID}
+	return s.Map()
+}
+
 func (f *plugin) New(ctx context.Context, ictx ika.InjectionContext, config map[string]any) (ika.Plugin, error) {
 	p := &plugin{}
 
@@ -60,11 +67,12 @@ func (f *plugin) New(ctx context.Context, ictx ika.InjectionContext, config map[
 }
 
 func (p *plugin) Handler(next ika.Handler) ika.Handler {
-	p.next = next
-	return p
+	return ika.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return p.serveHTTP(w, r, next)
+	})
 }
 
-func (p *plugin) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+func (p *plugin) serveHTTP(w http.ResponseWriter, r *http.Request, next ika.Handler) error {
 	reqID, err := p.genID()
 	if err != nil {
 		return err
@@ -72,6 +80,13 @@ func (p *plugin) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
 
 	existingID := r.Header.Get(p.cfg.Header)
 
+	// the ID of the client is kept unless it is overridden or appended to
+	if existingID != "" && !*p.cfg.Override && !p.cfg.Append {
+		request.RequestID.Set(r, existingID)
+	} else {
+		request.RequestID.Set(r, reqID)
+	}
+
 	switch {
 	case *p.cfg.Override:
 		r.Header.Set(p.cfg.Header, reqID)
@@ -92,7 +107,7 @@ func (p *plugin) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
 		}
 	}
 
-	return p.next.ServeHTTP(w, r)
+	return next.ServeHTTP(w, r)
 }
 
 func (*plugin) Teardown(context.Context) error {
@@ -151,6 +166,7 @@ func makeRandFun(variant string) (func() (string, error), error) {
 }
 
 var (
-	_ ika.OnRequestHook = &plugin{}
-	_ ika.PluginFactory = &plugin{}
+	_ ika.OnRequestHook        = &plugin{}
+	_ ika.PluginFactory        = &plugin{}
+	_ ika.ConfigSchemaProvider = &plugin{}
 )
@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/alx99/ika"
+	"github.com/alx99/ika/request"
 	"github.com/matryer/is"
 )
 
@@ -21,6 +22,7 @@ func TestPlugin_ModifyRequest(t *testing.T) {
 		r              *http.Request
 		wantHeader     http.Header
 		wantRespHeader http.Header
+		wantID         string
 	}{
 		{
 			name: "no override header",
@@ -31,7 +33,6 @@ func TestPlugin_ModifyRequest(t *testing.T) {
 					Expose:   &[]bool{true}[0],
 				},
 				genID: genID,
-				next:  next,
 			},
 			r: func() *http.Request {
 				req := httptest.NewRequest("GET", "/", nil)
@@ -40,6 +41,7 @@ func TestPlugin_ModifyRequest(t *testing.T) {
 			}(),
 			wantHeader:     http.Header{"X-Request-Id": {"test"}},
 			wantRespHeader: http.Header{"X-Request-Id": {"test"}},
+			wantID:         "test",
 		},
 		{
 			name: "override header",
@@ -51,7 +53,6 @@ func TestPlugin_ModifyRequest(t *testing.T) {
 					Expose:   &[]bool{true}[0],
 				},
 				genID: genID,
-				next:  next,
 			},
 			r: func() *http.Request {
 				req := httptest.NewRequest("GET", "/", nil)
@@ -60,6 +61,7 @@ func TestPlugin_ModifyRequest(t *testing.T) {
 			}(),
 			wantHeader:     http.Header{"X-Request-Id": {"request-id"}},
 			wantRespHeader: http.Header{"X-Request-Id": {"request-id"}},
+			wantID:         "request-id",
 		},
 		{
 			name: "append header",
@@ -72,7 +74,6 @@ func TestPlugin_ModifyRequest(t *testing.T) {
 					Expose:   &[]bool{true}[0],
 				},
 				genID: genID,
-				next:  next,
 			},
 			r: func() *http.Request {
 				req := httptest.NewRequest("GET", "/", nil)
@@ -81,6 +82,7 @@ func TestPlugin_ModifyRequest(t *testing.T) {
 			}(),
 			wantHeader:     http.Header{"X-Request-Id": {"test", "request-id"}},
 			wantRespHeader: http.Header{"X-Request-Id": {"test"}},
+			wantID:         "request-id",
 		},
 		{
 			name: "expose disabled",
@@ -91,7 +93,6 @@ func TestPlugin_ModifyRequest(t *testing.T) {
 					Expose:   &[]bool{false}[0],
 				},
 				genID: genID,
-				next:  next,
 			},
 			r: func() *http.Request {
 				req := httptest.NewRequest("GET", "/", nil)
@@ -99,6 +100,7 @@ func TestPlugin_ModifyRequest(t *testing.T) {
 				return req
 			}(),
 			wantHeader: http.Header{"X-Request-Id": {"test"}},
+			wantID:     "test",
 		},
 		{
 			name: "expose header with no existing ID",
@@ -109,13 +111,13 @@ func TestPlugin_ModifyRequest(t *testing.T) {
 					Expose:   &[]bool{true}[0],
 				},
 				genID: genID,
-				next:  next,
 			},
 			r: func() *http.Request {
 				return httptest.NewRequest("GET", "/", nil)
 			}(),
 			wantHeader:     http.Header{"X-Request-Id": {"request-id"}},
 			wantRespHeader: http.Header{"X-Request-Id": {"request-id"}},
+			wantID:         "request-id",
 		},
 		{
 			name: "expose header with existing ID",
@@ -126,7 +128,6 @@ func TestPlugin_ModifyRequest(t *testing.T) {
 					Expose:   &[]bool{true}[0],
 				},
 				genID: genID,
-				next:  next,
 			},
 			r: func() *http.Request {
 				req := httptest.NewRequest("GET", "/", nil)
@@ -135,6 +136,7 @@ func TestPlugin_ModifyRequest(t *testing.T) {
 			}(),
 			wantHeader:     http.Header{"X-Request-Id": {"test"}},
 			wantRespHeader: http.Header{"X-Request-Id": {"test"}},
+			wantID:         "test",
 		},
 		{
 			name: "expose header with override",
@@ -145,7 +147,6 @@ func TestPlugin_ModifyRequest(t *testing.T) {
 					Expose:   &[]bool{true}[0],
 				},
 				genID: genID,
-				next:  next,
 			},
 			r: func() *http.Request {
 				req := httptest.NewRequest("GET", "/", nil)
@@ -154,6 +155,7 @@ func TestPlugin_ModifyRequest(t *testing.T) {
 			}(),
 			wantHeader:     http.Header{"X-Request-Id": {"request-id"}},
 			wantRespHeader: http.Header{"X-Request-Id": {"request-id"}},
+			wantID:         "request-id",
 		},
 	}
 	for _, tt := range tests {
@@ -161,8 +163,9 @@ func TestPlugin_ModifyRequest(t *testing.T) {
 			t.Parallel()
 			is := is.New(t)
 
+			r := request.WithAttributes(tt.r)
 			w := httptest.NewRecorder()
-			err := tt.p.ServeHTTP(w, tt.r)
+			err := tt.p.Handler(next).ServeHTTP(w, r)
 			is.NoErr(err)
 
 			if tt.wantHeader != nil {
@@ -172,6 +175,9 @@ func TestPlugin_ModifyRequest(t *testing.T) {
 			if tt.wantRespHeader != nil {
 				is.Equal(tt.wantRespHeader.Get("X-Request-Id"), w.Header().Get("X-Request-Id"))
 			}
+
+			id, _ := request.RequestID.Get(r)
+			is.Equal(id, tt.wantID)
 		})
 	}
 }
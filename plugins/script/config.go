@@ -0,0 +1,34 @@
+package script
+
+import (
+	"cmp"
+	"errors"
+)
+
+type pConfig struct {
+	// Script is the source of the script.
+	Script string `json:"script"`
+
+	// File is the path of a file holding the source of the script, used instead of Script.
+	File string `json:"file"`
+
+	// MaxSteps limits the number of steps a single call of the script may execute.
+	// Calls exceeding it are aborted and the request fails with 500 Internal Server Error.
+	//
+	// Defaults to 1000000
+	MaxSteps uint64 `json:"maxSteps"`
+}
+
+func (c *pConfig) SetDefaults() {
+	c.MaxSteps = cmp.Or(c.MaxSteps, 1_000_000)
+}
+
+func (c *pConfig) Validate() error {
+	if c.Script == "" && c.File == "" {
+		return errors.New("script or file is required")
+	}
+	if c.Script != "" && c.File != "" {
+		return errors.New("script and file are mutually exclusive")
+	}
+	return nil
+}
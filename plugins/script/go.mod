@@ -0,0 +1,12 @@
+module github.com/alx99/ika/plugins/script
+
+go 1.24.0
+
+require (
+	github.com/alx99/ika v0.0.40
+	github.com/alx99/ika/pluginutil v0.0.1
+	github.com/matryer/is v1.4.1
+	go.starlark.net v0.0.0-20260210143700-b62fd896b91b
+)
+
+require golang.org/x/sys v0.30.0 // indirect
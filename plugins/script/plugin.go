@@ -0,0 +1,148 @@
+// Package script contains a plugin running request logic written in Starlark in the ika API Gateway.
+package script
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/alx99/ika"
+	"github.com/alx99/ika/jsonschema"
+	"github.com/alx99/ika/pluginutil"
+	"github.com/alx99/ika/pluginutil/httperr"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+type plugin struct {
+	cfg pConfig
+	log *slog.Logger
+	// handle is the handle function defined by the script
+	handle starlark.Callable
+}
+
+func Factory() ika.PluginFactory {
+	return &plugin{}
+}
+
+func (*plugin) Name() string {
+	return "script"
+}
+
+func (*plugin) ConfigSchema() map[string]any {
+	return jsonschema.Reflect(pConfig{}).Map()
+}
+
+func (*plugin) New(ctx context.Context, ictx ika.InjectionContext, config map[string]any) (ika.Plugin, error) {
+	p := &plugin{
+		log: ictx.Logger,
+	}
+
+	if err := pluginutil.UnmarshalCfg(config, &p.cfg); err != nil {
+		return nil, err
+	}
+
+	if err := p.load(ctx); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// load compiles and executes the script, which must define the handle function.
+// The globals of the script are frozen afterwards, so calls on concurrent requests cannot modify them.
+func (p *plugin) load(ctx context.Context) error {
+	filename, src := "script", p.cfg.Script
+	if p.cfg.File != "" {
+		b, err := os.ReadFile(p.cfg.File)
+		if err != nil {
+			return fmt.Errorf("failed to read script: %w", err)
+		}
+		filename, src = p.cfg.File, string(b)
+	}
+
+	predeclared := starlark.StringDict{
+		"reject": starlark.NewBuiltin("reject", reject),
+	}
+	globals, err := starlark.ExecFileOptions(&syntax.FileOptions{}, p.newThread(ctx), filename, src, predeclared)
+	if err != nil {
+		return fmt.Errorf("failed to load script: %s", describe(err))
+	}
+
+	handle, ok := globals["handle"].(starlark.Callable)
+	if !ok {
+		return errors.New("script must define a function handle(req)")
+	}
+	p.handle = handle
+	return nil
+}
+
+func (p *plugin) ModifyRequest(r *http.Request) error {
+	_, err := starlark.Call(p.newThread(r.Context()), p.handle, starlark.Tuple{newRequest(r)}, nil)
+	if err == nil {
+		return nil
+	}
+
+	var httpErr *httperr.Error
+	if errors.As(err, &httpErr) {
+		return httpErr
+	}
+	return fmt.Errorf("script failed: %s", describe(err))
+}
+
+func (p *plugin) Handler(next ika.Handler) ika.Handler {
+	return ika.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		if err := p.ModifyRequest(r); err != nil {
+			return err
+		}
+		return next.ServeHTTP(w, r)
+	})
+}
+
+func (*plugin) Teardown(context.Context) error {
+	return nil
+}
+
+// newThread returns a thread for a single call of the script, limited to MaxSteps.
+// Output of the print function is logged.
+func (p *plugin) newThread(ctx context.Context) *starlark.Thread {
+	thread := &starlark.Thread{
+		Name: "script",
+		Print: func(_ *starlark.Thread, msg string) {
+			p.log.LogAttrs(ctx, slog.LevelInfo, msg)
+		},
+	}
+	thread.SetMaxExecutionSteps(p.cfg.MaxSteps)
+	return thread
+}
+
+// reject implements the reject builtin, failing the request with the given status and message.
+func reject(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		status  int
+		message string
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "status", &status, "message?", &message); err != nil {
+		return nil, err
+	}
+	if status < 400 || status > 599 {
+		return nil, fmt.Errorf("%s: invalid status %d, want 4xx or 5xx", b.Name(), status)
+	}
+
+	err := httperr.New(status).WithErr(errors.New("request rejected by script"))
+	if message != "" {
+		err = err.WithDetail(message)
+	}
+	return nil, err
+}
+
+// describe returns the message of err along with the position it occurred at in the script.
+func describe(err error) string {
+	var evalErr *starlark.EvalError
+	if errors.As(err, &evalErr) {
+		return evalErr.Backtrace()
+	}
+	return err.Error()
+}
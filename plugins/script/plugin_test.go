@@ -0,0 +1,283 @@
+package script
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alx99/ika"
+	"github.com/alx99/ika/pluginutil/httperr"
+	"github.com/matryer/is"
+)
+
+func TestPlugin_Setup(t *testing.T) {
+	t.Parallel()
+
+	file := filepath.Join(t.TempDir(), "script.star")
+	if err := os.WriteFile(file, []byte("def handle(req):\n    pass\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		config    map[string]any
+		wantError bool
+	}{
+		{name: "valid script", config: map[string]any{"script": "def handle(req):\n    pass\n", "maxSteps": 100}},
+		{name: "valid file", config: map[string]any{"file": file}},
+		{name: "missing script", config: map[string]any{}, wantError: true},
+		{name: "script and file", config: map[string]any{"script": "def handle(req):\n    pass\n", "file": file}, wantError: true},
+		{name: "missing file", config: map[string]any{"file": filepath.Join(t.TempDir(), "missing.star")}, wantError: true},
+		{name: "syntax error", config: map[string]any{"script": "def handle(req)\n    pass\n"}, wantError: true},
+		{name: "undefined name", config: map[string]any{"script": "def handle(req):\n    missing()\n"}, wantError: true},
+		{name: "missing handle", config: map[string]any{"script": "x = 1\n"}, wantError: true},
+		{name: "handle is not a function", config: map[string]any{"script": "handle = 1\n"}, wantError: true},
+		{name: "failing script", config: map[string]any{"script": "fail('broken')\n"}, wantError: true},
+		{name: "script exceeding max steps", config: map[string]any{"script": "[x for x in range(1000)]\ndef handle(req):\n    pass\n", "maxSteps": 100}, wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			is := is.New(t)
+
+			p, err := Factory().New(t.Context(), ika.InjectionContext{Logger: slog.New(slog.DiscardHandler)}, tt.config)
+			if tt.wantError {
+				is.True(err != nil) // expected an error
+			} else {
+				is.NoErr(err)
+				is.NoErr(p.Teardown(t.Context()))
+			}
+		})
+	}
+}
+
+func TestPlugin_ModifyRequest(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		script     string
+		maxSteps   int
+		target     string
+		header     http.Header
+		wantHeader http.Header
+		wantPath   string
+		wantURI    string
+		wantStatus int    // status of the expected httperr.Error
+		wantDetail string // detail of the expected httperr.Error
+		wantError  bool   // whether an error other than httperr.Error is expected
+	}{
+		{
+			name: "header is set from cookie",
+			script: `
+def handle(req):
+    req.headers.set("X-Session", req.cookie("session") or "none")
+    req.headers.remove("Cookie")
+`,
+			target:     "/",
+			header:     http.Header{"Cookie": {"session=abc; theme=dark"}},
+			wantHeader: http.Header{"X-Session": {"abc"}, "Cookie": nil},
+			wantURI:    "/",
+		},
+		{
+			name: "headers are read",
+			script: `
+def handle(req):
+    if "x-token" in req.headers and req.headers["X-Token"] == "secret":
+        req.headers.add("X-Tags", str(len(req.headers.values("x-tags"))))
+        req.headers.set("X-Missing", req.headers.get("X-Missing", "default"))
+`,
+			target:     "/",
+			header:     http.Header{"X-Token": {"secret"}, "X-Tags": {"a", "b"}},
+			wantHeader: http.Header{"X-Tags": {"a", "b", "2"}, "X-Missing": {"default"}},
+			wantURI:    "/",
+		},
+		{
+			name: "request is rejected",
+			script: `
+def handle(req):
+    if not req.query.get("token"):
+        reject(401, "token is required")
+    req.headers.set("X-Reached", "true")
+`,
+			target:     "/items",
+			wantStatus: http.StatusUnauthorized,
+			wantDetail: "token is required",
+		},
+		{
+			name: "request is not rejected",
+			script: `
+def handle(req):
+    if not req.query.get("token"):
+        reject(401, "token is required")
+`,
+			target:  "/items?token=abc",
+			wantURI: "/items?token=abc",
+		},
+		{
+			name: "path and query are rewritten",
+			script: `
+def handle(req):
+    req.path = "/v2" + req.path
+    req.query.set("version", "2")
+    req.query.add("tag", req.method.lower())
+    req.query.remove("debug")
+`,
+			target:   "/items%2F1?debug=1&tag=a",
+			wantPath: "/v2/items/1",
+			wantURI:  "/v2/items%2F1?tag=a&tag=get&version=2",
+		},
+		{
+			name: "params and client are read",
+			script: `
+def handle(req):
+    req.headers.set("X-User", req.params["id"])
+    req.headers.set("X-Client-Ip", req.client_ip)
+    req.headers.set("X-Principal", req.principal or "anonymous")
+    req.headers.set("X-Host", req.host)
+`,
+			target:     "/users/42",
+			wantHeader: http.Header{"X-User": {"42"}, "X-Client-Ip": {"192.0.2.1"}, "X-Principal": {"anonymous"}, "X-Host": {"example.com"}},
+			wantURI:    "/users/42",
+		},
+		{
+			name: "script fails",
+			script: `
+def handle(req):
+    req.headers["X-Missing"]
+`,
+			target:    "/",
+			wantError: true,
+		},
+		{
+			name: "reject with invalid status",
+			script: `
+def handle(req):
+    reject(200)
+`,
+			target:    "/",
+			wantError: true,
+		},
+		{
+			name: "read-only field is set",
+			script: `
+def handle(req):
+    req.method = "POST"
+`,
+			target:    "/",
+			wantError: true,
+		},
+		{
+			name: "globals are frozen",
+			script: `
+seen = []
+
+def handle(req):
+    seen.append(req.path)
+`,
+			target:    "/",
+			wantError: true,
+		},
+		{
+			name: "max steps are exceeded",
+			script: `
+def handle(req):
+    for i in range(1000000000):
+        pass
+`,
+			maxSteps:  1000,
+			target:    "/",
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			is := is.New(t)
+
+			config := map[string]any{"script": tt.script}
+			if tt.maxSteps != 0 {
+				config["maxSteps"] = tt.maxSteps
+			}
+			p := newPlugin(t, config)
+
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+			req.Pattern = "/users/{id}"
+			req.SetPathValue("id", "42")
+			for name, values := range tt.header {
+				req.Header[name] = values
+			}
+
+			err := p.ModifyRequest(req)
+			var httpErr *httperr.Error
+			switch {
+			case tt.wantError:
+				is.True(err != nil)                // expected an error
+				is.True(!errors.As(err, &httpErr)) // the error is not an error response
+				return
+			case tt.wantStatus != 0:
+				is.True(errors.As(err, &httpErr)) // expected an error response
+				is.Equal(httpErr.Status(), tt.wantStatus)
+				is.Equal(httpErr.Detail(), tt.wantDetail)
+				return
+			}
+
+			is.NoErr(err)
+			for name, values := range tt.wantHeader {
+				is.Equal(req.Header.Values(name), values)
+			}
+			if tt.wantPath != "" {
+				is.Equal(req.URL.Path, tt.wantPath)
+			}
+			is.Equal(req.URL.RequestURI(), tt.wantURI)
+		})
+	}
+}
+
+func TestPlugin_Handler(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	p := newPlugin(t, map[string]any{"script": `
+def handle(req):
+    if req.method != "GET":
+        reject(405)
+    req.headers.set("X-Script", "true")
+`})
+
+	var upstream *http.Request
+	h := ika.ToHTTPHandler(p.Handler(ika.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		upstream = r
+		return nil
+	})), nil)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	is.Equal(rec.Code, http.StatusOK)
+	is.True(upstream != nil) // the request reached the upstream
+	is.Equal(upstream.Header.Get("X-Script"), "true")
+
+	upstream = nil
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+	is.Equal(rec.Code, http.StatusMethodNotAllowed)
+	is.True(upstream == nil) // the request did not reach the upstream
+}
+
+func newPlugin(t *testing.T, config map[string]any) *plugin {
+	t.Helper()
+
+	p, err := Factory().New(t.Context(), ika.InjectionContext{Logger: slog.New(slog.DiscardHandler)}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = p.Teardown(t.Context()) })
+	return p.(*plugin)
+}
@@ -0,0 +1,278 @@
+package script
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"slices"
+
+	"github.com/alx99/ika/request"
+	"go.starlark.net/starlark"
+)
+
+// requestValue exposes a request to the script as the req parameter of the handle function.
+type requestValue struct {
+	r      *http.Request
+	header *multiMap
+	query  *multiMap
+	params *starlark.Dict
+}
+
+var (
+	_ starlark.HasSetField = (*requestValue)(nil)
+	_ starlark.Mapping     = (*multiMap)(nil)
+)
+
+func newRequest(r *http.Request) *requestValue {
+	// invalid pairs are dropped, which only affects the request if the script modifies the query
+	query, _ := url.ParseQuery(r.URL.RawQuery)
+
+	params := starlark.NewDict(0)
+	for name, value := range request.RouteParams(r) {
+		_ = params.SetKey(starlark.String(name), starlark.String(value))
+	}
+	params.Freeze()
+
+	return &requestValue{
+		r: r,
+		header: &multiMap{
+			typ:       "headers",
+			values:    r.Header,
+			canonical: textproto.CanonicalMIMEHeaderKey,
+		},
+		query: &multiMap{
+			typ:     "query",
+			values:  query,
+			changed: func() { r.URL.RawQuery = query.Encode() },
+		},
+		params: params,
+	}
+}
+
+var requestMethods = map[string]*starlark.Builtin{
+	"cookie": starlark.NewBuiltin("cookie", requestCookie),
+}
+
+func (v *requestValue) String() string {
+	return fmt.Sprintf("<request %s %s>", v.r.Method, v.r.URL.Path)
+}
+func (v *requestValue) Type() string          { return "request" }
+func (v *requestValue) Freeze()               {} // the request is only used by a single call
+func (v *requestValue) Truth() starlark.Bool  { return starlark.True }
+func (v *requestValue) Hash() (uint32, error) { return 0, fmt.Errorf("unhashable type: %s", v.Type()) }
+
+func (v *requestValue) Attr(name string) (starlark.Value, error) {
+	switch name {
+	case "method":
+		return starlark.String(v.r.Method), nil
+	case "host":
+		return starlark.String(v.r.Host), nil
+	case "path":
+		return starlark.String(request.GetPath(v.r)), nil
+	case "headers":
+		return v.header, nil
+	case "query":
+		return v.query, nil
+	case "params":
+		return v.params, nil
+	case "client_ip":
+		if ip, ok := request.ClientIP.Get(v.r); ok {
+			return starlark.String(ip.String()), nil
+		}
+		if host, _, err := net.SplitHostPort(v.r.RemoteAddr); err == nil {
+			return starlark.String(host), nil
+		}
+		return starlark.None, nil
+	case "principal":
+		return optional(request.Principal.Get(v.r)), nil
+	case "request_id":
+		return optional(request.RequestID.Get(v.r)), nil
+	}
+	if m, ok := requestMethods[name]; ok {
+		return m.BindReceiver(v), nil
+	}
+	return nil, nil
+}
+
+func (v *requestValue) AttrNames() []string {
+	return []string{"client_ip", "cookie", "headers", "host", "method", "params", "path", "principal", "query", "request_id"}
+}
+
+func (v *requestValue) SetField(name string, val starlark.Value) error {
+	if name != "path" {
+		return fmt.Errorf("cannot set .%s of request", name)
+	}
+	rawPath, ok := starlark.AsString(val)
+	if !ok {
+		return fmt.Errorf("cannot set .path of request to %s, want string", val.Type())
+	}
+	path, err := url.PathUnescape(rawPath)
+	if err != nil {
+		return fmt.Errorf("invalid path %q: %w", rawPath, err)
+	}
+	v.r.URL.RawPath = rawPath
+	v.r.URL.Path = path
+	return nil
+}
+
+// requestCookie implements req.cookie(name), returning the value of a cookie or None.
+func requestCookie(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &name); err != nil {
+		return nil, err
+	}
+	c, err := b.Receiver().(*requestValue).r.Cookie(name)
+	if err != nil {
+		return starlark.None, nil
+	}
+	return starlark.String(c.Value), nil
+}
+
+// multiMap exposes the headers or the query parameters of a request to the script.
+// Indexing it returns the first value of a name, failing if there is none.
+type multiMap struct {
+	typ    string
+	values map[string][]string
+	// canonical returns the canonical form of a name, if names are not case-sensitive
+	canonical func(string) string
+	// changed is called once the values are modified
+	changed func()
+}
+
+var multiMapMethods = map[string]*starlark.Builtin{
+	"get":    starlark.NewBuiltin("get", multiMapGet),
+	"values": starlark.NewBuiltin("values", multiMapValues),
+	"keys":   starlark.NewBuiltin("keys", multiMapKeys),
+	"set":    starlark.NewBuiltin("set", multiMapSet),
+	"add":    starlark.NewBuiltin("add", multiMapAdd),
+	"remove": starlark.NewBuiltin("remove", multiMapRemove),
+}
+
+func (v *multiMap) String() string        { return fmt.Sprintf("<%s>", v.typ) }
+func (v *multiMap) Type() string          { return v.typ }
+func (v *multiMap) Freeze()               {} // the request is only used by a single call
+func (v *multiMap) Truth() starlark.Bool  { return len(v.values) > 0 }
+func (v *multiMap) Hash() (uint32, error) { return 0, fmt.Errorf("unhashable type: %s", v.Type()) }
+
+func (v *multiMap) Attr(name string) (starlark.Value, error) {
+	if m, ok := multiMapMethods[name]; ok {
+		return m.BindReceiver(v), nil
+	}
+	return nil, nil
+}
+
+func (v *multiMap) AttrNames() []string {
+	return slices.Sorted(maps.Keys(multiMapMethods))
+}
+
+// Get implements indexing and the in operator.
+func (v *multiMap) Get(k starlark.Value) (starlark.Value, bool, error) {
+	name, ok := starlark.AsString(k)
+	if !ok {
+		return nil, false, fmt.Errorf("%s: got %s, want string", v.typ, k.Type())
+	}
+	if values := v.values[v.key(name)]; len(values) > 0 {
+		return starlark.String(values[0]), true, nil
+	}
+	return nil, false, nil
+}
+
+func (v *multiMap) key(name string) string {
+	if v.canonical == nil {
+		return name
+	}
+	return v.canonical(name)
+}
+
+func (v *multiMap) modify(fn func(map[string][]string)) {
+	fn(v.values)
+	if v.changed != nil {
+		v.changed()
+	}
+}
+
+// multiMapGet implements get(name, default=None), returning the first value of a name.
+func multiMapGet(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		name string
+		def  starlark.Value = starlark.None
+	)
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &name, &def); err != nil {
+		return nil, err
+	}
+	value, found, err := b.Receiver().(*multiMap).Get(starlark.String(name))
+	if err != nil || !found {
+		return def, err
+	}
+	return value, nil
+}
+
+// multiMapValues implements values(name), returning all values of a name as a list.
+func multiMapValues(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &name); err != nil {
+		return nil, err
+	}
+	v := b.Receiver().(*multiMap)
+	var list []starlark.Value
+	for _, value := range v.values[v.key(name)] {
+		list = append(list, starlark.String(value))
+	}
+	return starlark.NewList(list), nil
+}
+
+// multiMapKeys implements keys(), returning the sorted names having values.
+func multiMapKeys(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	var list []starlark.Value
+	for _, name := range slices.Sorted(maps.Keys(b.Receiver().(*multiMap).values)) {
+		list = append(list, starlark.String(name))
+	}
+	return starlark.NewList(list), nil
+}
+
+// multiMapSet implements set(name, value), replacing the values of a name.
+func multiMapSet(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name, value string
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 2, &name, &value); err != nil {
+		return nil, err
+	}
+	v := b.Receiver().(*multiMap)
+	v.modify(func(values map[string][]string) { values[v.key(name)] = []string{value} })
+	return starlark.None, nil
+}
+
+// multiMapAdd implements add(name, value), adding a value to a name.
+func multiMapAdd(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name, value string
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 2, &name, &value); err != nil {
+		return nil, err
+	}
+	v := b.Receiver().(*multiMap)
+	v.modify(func(values map[string][]string) { values[v.key(name)] = append(values[v.key(name)], value) })
+	return starlark.None, nil
+}
+
+// multiMapRemove implements remove(name), removing all values of a name.
+func multiMapRemove(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &name); err != nil {
+		return nil, err
+	}
+	v := b.Receiver().(*multiMap)
+	v.modify(func(values map[string][]string) { delete(values, v.key(name)) })
+	return starlark.None, nil
+}
+
+// optional returns value as a string, or None if it is not set.
+func optional(value string, ok bool) starlark.Value {
+	if !ok {
+		return starlark.None
+	}
+	return starlark.String(value)
+}
@@ -0,0 +1,91 @@
+package trafficsplit
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+type pConfig struct {
+	// Variants are the upstreams traffic is split between.
+	Variants []variant `json:"variants"`
+
+	// StickyCookie is the name of a cookie that stores the variant assigned to a client,
+	// keeping the client on the same variant across requests.
+	StickyCookie string `json:"stickyCookie"`
+
+	// StickyCookieMaxAge is how long the sticky cookie is kept by the client.
+	// The cookie lasts for the browser session if unset.
+	StickyCookieMaxAge time.Duration `json:"stickyCookieMaxAge"`
+
+	// StickyHeader is a request header, such as a user ID, whose value is hashed to assign a variant.
+	// Clients sending the same value always get the same variant.
+	StickyHeader string `json:"stickyHeader"`
+
+	// OverrideHeader is a request header naming the variant to use,
+	// bypassing the weights. Useful for testing a variant before ramping it up.
+	OverrideHeader string `json:"overrideHeader"`
+
+	// RetainHostHeader controls whether to keep the original Host header.
+	// If false, the Host header is set to the host of the variant.
+	RetainHostHeader bool `json:"retainHostHeader"`
+}
+
+type variant struct {
+	// Name identifies the variant in cookies and the override header.
+	Name string `json:"name"`
+
+	// Host is the upstream of the variant. Must be a valid URL including scheme.
+	// For example: https://api-v2.internal, or unix:///run/api-v2.sock for a Unix domain socket.
+	Host string `json:"host"`
+
+	// Weight is the share of traffic the variant receives, relative to the other variants.
+	Weight uint32 `json:"weight"`
+}
+
+func (c *pConfig) Validate() error {
+	if len(c.Variants) == 0 {
+		return errors.New("at least one variant must be set")
+	}
+
+	var total uint64
+	seen := make(map[string]bool, len(c.Variants))
+	for i, v := range c.Variants {
+		if v.Name == "" {
+			return fmt.Errorf("variants[%d]: name must be set", i)
+		}
+		if seen[v.Name] {
+			return fmt.Errorf("variants[%d]: duplicate name %q", i, v.Name)
+		}
+		seen[v.Name] = true
+
+		u, err := url.Parse(v.Host)
+		if err != nil {
+			return fmt.Errorf("variants[%d]: invalid host URL: %w", i, err)
+		}
+		if u.Scheme == "" || upstreamHost(u) == "" {
+			return fmt.Errorf("variants[%d]: host must be a URL including scheme, got %q", i, v.Host)
+		}
+		total += uint64(v.Weight)
+	}
+
+	if total == 0 {
+		return errors.New("at least one variant must have a weight greater than 0")
+	}
+	if c.StickyCookie != "" && c.StickyHeader != "" {
+		return errors.New("only one of stickyCookie and stickyHeader can be set")
+	}
+	if c.StickyCookieMaxAge < 0 {
+		return errors.New("stickyCookieMaxAge must not be negative")
+	}
+	return nil
+}
+
+// upstreamHost returns the host of an upstream URL, which is the socket path for Unix domain sockets.
+func upstreamHost(u *url.URL) string {
+	if u.Scheme == "unix" {
+		return u.Path
+	}
+	return u.Host
+}
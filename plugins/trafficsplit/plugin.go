@@ -0,0 +1,194 @@
+// Package trafficsplit contains a plugin for splitting traffic between weighted upstream variants in the ika API Gateway.
+package trafficsplit
+
+import (
+	"context"
+	"hash/fnv"
+	"log/slog"
+	"math"
+	"math/bits"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+
+	"github.com/alx99/ika"
+	"github.com/alx99/ika/jsonschema"
+	"github.com/alx99/ika/pluginutil"
+)
+
+type plugin struct {
+	cfg pConfig
+
+	targets []target
+	// total is the sum of all weights
+	total uint64
+
+	log *slog.Logger
+}
+
+type target struct {
+	name   string
+	scheme string
+	host   string
+	weight uint64
+}
+
+func Factory() ika.PluginFactory {
+	return &plugin{}
+}
+
+func (*plugin) Name() string {
+	return "traffic-split"
+}
+
+func (*plugin) ConfigSchema() map[string]any {
+	s := jsonschema.Reflect(pConfig{})
+	s.Required = []string{"variants"}
+	s.Properties["variants"].Items.Required = []string{"name", "host", "weight"}
+	return s.Map()
+}
+
+func (*plugin) New(_ context.Context, ictx ika.InjectionContext, config map[string]any) (ika.Plugin, error) {
+	p := &plugin{
+		log: ictx.Logger,
+	}
+
+	if err := pluginutil.UnmarshalCfg(config, &p.cfg); err != nil {
+		return nil, err
+	}
+
+	for _, v := range p.cfg.Variants {
+		u, _ := url.Parse(v.Host) // validated by pConfig.Validate
+		p.targets = append(p.targets, target{
+			name:   v.Name,
+			scheme: u.Scheme,
+			host:   upstreamHost(u),
+			weight: uint64(v.Weight),
+		})
+		p.total += uint64(v.Weight)
+	}
+
+	return p, nil
+}
+
+func (p *plugin) Handler(next ika.Handler) ika.Handler {
+	return ika.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		t, assigned := p.choose(r)
+
+		if assigned && p.cfg.StickyCookie != "" {
+			http.SetCookie(w, &http.Cookie{
+				Name:     p.cfg.StickyCookie,
+				Value:    t.name,
+				Path:     "/",
+				MaxAge:   int(p.cfg.StickyCookieMaxAge.Seconds()),
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+
+		if !p.cfg.RetainHostHeader {
+			r.Host = t.host // this overrides the Host header
+		}
+		r.URL.Host = t.host
+		r.URL.Scheme = t.scheme
+
+		p.log.LogAttrs(r.Context(), slog.LevelDebug, "Variant selected",
+			slog.String("variant", t.name), slog.String("host", t.host))
+
+		return next.ServeHTTP(w, r)
+	})
+}
+
+func (*plugin) Teardown(context.Context) error {
+	return nil
+}
+
+// choose selects the variant for r.
+// It reports whether the variant was newly assigned and should be stored in the sticky cookie.
+func (p *plugin) choose(r *http.Request) (*target, bool) {
+	if p.cfg.OverrideHeader != "" {
+		// variants without weight can still be selected explicitly
+		if t := p.lookup(r.Header.Get(p.cfg.OverrideHeader)); t != nil {
+			return t, false
+		}
+	}
+
+	if p.cfg.StickyCookie != "" {
+		if c, err := r.Cookie(p.cfg.StickyCookie); err == nil {
+			// clients are reassigned once their variant is ramped down to zero
+			if t := p.lookup(c.Value); t != nil && t.weight > 0 {
+				return t, false
+			}
+		}
+		return p.pick(rand.Uint64()), true
+	}
+
+	if p.cfg.StickyHeader != "" {
+		if v := r.Header.Get(p.cfg.StickyHeader); v != "" {
+			return p.hashed(v), false
+		}
+	}
+
+	return p.pick(rand.Uint64()), false
+}
+
+func (p *plugin) lookup(name string) *target {
+	if name == "" {
+		return nil
+	}
+	for i := range p.targets {
+		if p.targets[i].name == name {
+			return &p.targets[i]
+		}
+	}
+	return nil
+}
+
+// pick maps n, uniformly distributed over all uint64 values, onto the variants according to their weights.
+func (p *plugin) pick(n uint64) *target {
+	point, _ := bits.Mul64(n, p.total) // in [0, total)
+	for i := range p.targets {
+		if point < p.targets[i].weight {
+			return &p.targets[i]
+		}
+		point -= p.targets[i].weight
+	}
+	return &p.targets[len(p.targets)-1] // unreachable
+}
+
+// hashed selects the variant for key by weighted rendezvous hashing: every variant scores the key,
+// and the variant with the lowest score wins. Changing the weight of a variant only moves keys
+// into or out of that variant, the keys of the other variants keep theirs.
+func (p *plugin) hashed(key string) *target {
+	var best *target
+	bestScore := math.Inf(1)
+	for i := range p.targets {
+		t := &p.targets[i]
+		if t.weight == 0 {
+			continue
+		}
+
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(t.name))
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(key))
+		u := (float64(mix(h.Sum64())>>11) + 1) / (1 << 53) // in (0, 1]
+
+		// exponentially distributed with rate weight, so a variant wins with the probability of its share
+		if score := -math.Log(u) / float64(t.weight); score < bestScore {
+			best, bestScore = t, score
+		}
+	}
+	return best
+}
+
+// mix spreads the bits of an FNV hash, whose high bits barely change for similar inputs.
+// It is the finalizer of SplitMix64.
+func mix(h uint64) uint64 {
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
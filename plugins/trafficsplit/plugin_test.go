@@ -0,0 +1,247 @@
+package trafficsplit
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/alx99/ika"
+	"github.com/matryer/is"
+)
+
+func newPlugin(t *testing.T, config map[string]any) (*plugin, error) {
+	t.Helper()
+	p, err := Factory().New(t.Context(), ika.InjectionContext{
+		Scope:  ika.ScopeRoute,
+		Logger: slog.New(slog.DiscardHandler),
+	}, config)
+	if err != nil {
+		return nil, err
+	}
+	return p.(*plugin), nil
+}
+
+func variants(weights ...int) []any {
+	names := []string{"stable", "canary", "next"}
+	vs := make([]any, len(weights))
+	for i, w := range weights {
+		vs[i] = map[string]any{"name": names[i], "host": "http://" + names[i] + ".internal", "weight": w}
+	}
+	return vs
+}
+
+func TestPlugin_Setup(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		config    map[string]any
+		wantError bool
+	}{
+		{
+			name:   "valid config",
+			config: map[string]any{"variants": variants(99, 1), "stickyCookie": "variant", "stickyCookieMaxAge": "24h"},
+		},
+		{
+			name:      "no variants",
+			config:    map[string]any{},
+			wantError: true,
+		},
+		{
+			name:      "no weight",
+			config:    map[string]any{"variants": variants(0, 0)},
+			wantError: true,
+		},
+		{
+			name:      "host without scheme",
+			config:    map[string]any{"variants": []any{map[string]any{"name": "a", "host": "a.internal", "weight": 1}}},
+			wantError: true,
+		},
+		{
+			name:   "unix socket",
+			config: map[string]any{"variants": []any{map[string]any{"name": "a", "host": "unix:///run/a.sock", "weight": 1}}},
+		},
+		{
+			name:      "unix socket without path",
+			config:    map[string]any{"variants": []any{map[string]any{"name": "a", "host": "unix://", "weight": 1}}},
+			wantError: true,
+		},
+		{
+			name: "duplicate name",
+			config: map[string]any{"variants": []any{
+				map[string]any{"name": "a", "host": "http://a", "weight": 1},
+				map[string]any{"name": "a", "host": "http://b", "weight": 1},
+			}},
+			wantError: true,
+		},
+		{
+			name:      "cookie and header",
+			config:    map[string]any{"variants": variants(1), "stickyCookie": "c", "stickyHeader": "h"},
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			is := is.New(t)
+
+			_, err := newPlugin(t, tt.config)
+			if tt.wantError {
+				is.True(err != nil) // expected an error
+			} else {
+				is.NoErr(err)
+			}
+		})
+	}
+}
+
+func TestPlugin_pick(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	p, err := newPlugin(t, map[string]any{"variants": variants(3, 1)})
+	is.NoErr(err)
+
+	is.Equal(p.pick(0).name, "stable")
+	is.Equal(p.pick(3<<62-1).name, "stable")
+	is.Equal(p.pick(3<<62).name, "canary")
+	is.Equal(p.pick(math.MaxUint64).name, "canary")
+
+	// ramping the canary up only moves clients from stable to canary
+	ramped, err := newPlugin(t, map[string]any{"variants": variants(1, 1)})
+	is.NoErr(err)
+	for n := uint64(0); n < math.MaxUint64-math.MaxUint64/100; n += math.MaxUint64 / 100 {
+		if p.pick(n).name == "canary" {
+			is.Equal(ramped.pick(n).name, "canary") // client moved back to stable
+		}
+	}
+}
+
+func TestPlugin_hashed(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	p, err := newPlugin(t, map[string]any{"variants": variants(2, 1, 1)})
+	is.NoErr(err)
+	ramped, err := newPlugin(t, map[string]any{"variants": variants(2, 1, 3)})
+	is.NoErr(err)
+
+	counts := make(map[string]int)
+	for i := range 10000 {
+		key := strconv.Itoa(i)
+		name := p.hashed(key).name
+		counts[name]++
+		is.Equal(p.hashed(key).name, name) // same key maps to the same variant
+
+		// ramping next up only moves clients from the other variants to next
+		if got := ramped.hashed(key).name; got != name {
+			is.Equal(got, "next") // client moved between variants that were not ramped
+		}
+	}
+	is.True(counts["stable"] > 4500 && counts["stable"] < 5500) // stable receives half of the clients
+	is.True(counts["next"] > 2000 && counts["next"] < 3000)     // next receives a quarter of the clients
+}
+
+func TestPlugin_Handler(t *testing.T) {
+	t.Parallel()
+
+	serve := func(p *plugin, r *http.Request) (*http.Request, *httptest.ResponseRecorder) {
+		var upstream *http.Request
+		h := p.Handler(ika.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) error {
+			upstream = r
+			return nil
+		}))
+		rec := httptest.NewRecorder()
+		if err := h.ServeHTTP(rec, r); err != nil {
+			t.Fatal(err)
+		}
+		return upstream, rec
+	}
+
+	t.Run("override header", func(t *testing.T) {
+		t.Parallel()
+		is := is.New(t)
+
+		p, err := newPlugin(t, map[string]any{"variants": variants(1, 0), "overrideHeader": "X-Variant"})
+		is.NoErr(err)
+
+		r := httptest.NewRequest(http.MethodGet, "http://gateway/a?b=c", nil)
+		r.Header.Set("X-Variant", "canary")
+		upstream, _ := serve(p, r)
+		is.Equal(upstream.URL.String(), "http://canary.internal/a?b=c") // weightless variants can be selected explicitly
+		is.Equal(upstream.Host, "canary.internal")
+	})
+
+	t.Run("sticky cookie", func(t *testing.T) {
+		t.Parallel()
+		is := is.New(t)
+
+		p, err := newPlugin(t, map[string]any{
+			"variants":           variants(1, 1),
+			"stickyCookie":       "variant",
+			"stickyCookieMaxAge": "1h",
+		})
+		is.NoErr(err)
+
+		upstream, rec := serve(p, httptest.NewRequest(http.MethodGet, "http://gateway/", nil))
+		cookies := rec.Result().Cookies()
+		is.Equal(len(cookies), 1) // variant is assigned
+		is.Equal(cookies[0].Value+".internal", upstream.URL.Host)
+		is.Equal(cookies[0].MaxAge, 3600)
+
+		for range 20 {
+			r := httptest.NewRequest(http.MethodGet, "http://gateway/", nil)
+			r.AddCookie(cookies[0])
+			upstream, rec := serve(p, r)
+			is.Equal(upstream.URL.Host, cookies[0].Value+".internal") // client sticks to its variant
+			is.Equal(len(rec.Result().Cookies()), 0)                  // cookie is not set again
+		}
+	})
+
+	t.Run("ramped down cookie is reassigned", func(t *testing.T) {
+		t.Parallel()
+		is := is.New(t)
+
+		p, err := newPlugin(t, map[string]any{"variants": variants(1, 0), "stickyCookie": "variant"})
+		is.NoErr(err)
+
+		r := httptest.NewRequest(http.MethodGet, "http://gateway/", nil)
+		r.AddCookie(&http.Cookie{Name: "variant", Value: "canary"})
+		upstream, rec := serve(p, r)
+		is.Equal(upstream.URL.Host, "stable.internal")
+		is.Equal(rec.Result().Cookies()[0].Value, "stable")
+	})
+
+	t.Run("sticky header", func(t *testing.T) {
+		t.Parallel()
+		is := is.New(t)
+
+		p, err := newPlugin(t, map[string]any{
+			"variants":         variants(1, 1, 1),
+			"stickyHeader":     "X-User",
+			"retainHostHeader": true,
+		})
+		is.NoErr(err)
+
+		seen := map[string]bool{}
+		for i := range 50 {
+			user := "user-" + strconv.Itoa(i)
+			var hosts []string
+			for range 3 {
+				r := httptest.NewRequest(http.MethodGet, "http://gateway/", nil)
+				r.Header.Set("X-User", user)
+				upstream, _ := serve(p, r)
+				is.Equal(upstream.Host, "gateway") // host header is retained
+				hosts = append(hosts, upstream.URL.Host)
+			}
+			is.Equal(hosts[0], hosts[1]) // same user, same variant
+			is.Equal(hosts[1], hosts[2])
+			seen[hosts[0]] = true
+		}
+		is.Equal(len(seen), 3) // users are spread over every variant
+	})
+}
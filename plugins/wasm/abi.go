@@ -0,0 +1,187 @@
+package wasm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/alx99/ika/pluginutil/httperr"
+	"github.com/alx99/ika/request"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+)
+
+// The functions exported by modules, which are called for every request.
+// Both are optional, but a module must export at least one of them.
+const (
+	handleRequest  = "handle_request"
+	handleResponse = "handle_response"
+)
+
+// The kinds of headers passed to the header functions of the host module.
+const (
+	kindRequest uint32 = iota
+	kindResponse
+)
+
+// exchange is the request and response a call into a module operates on.
+type exchange struct {
+	r *http.Request
+	// header is the header of the response, which is written after the request is handled
+	header http.Header
+	// status is the status code of the response, zero until the upstream has responded
+	status int
+	// rejected is the error rejecting the request, if the module rejected it
+	rejected error
+}
+
+type exchangeKey struct{}
+
+func withExchange(ctx context.Context, ex *exchange) context.Context {
+	return context.WithValue(ctx, exchangeKey{}, ex)
+}
+
+// exchangeFrom returns the exchange of the current call, which is not set
+// while the module is initialized.
+func exchangeFrom(ctx context.Context) *exchange {
+	ex, ok := ctx.Value(exchangeKey{}).(*exchange)
+	if !ok {
+		panic(errors.New("function called outside of a request"))
+	}
+	return ex
+}
+
+func (ex *exchange) headers(kind uint32) http.Header {
+	switch kind {
+	case kindRequest:
+		return ex.r.Header
+	case kindResponse:
+		return ex.header
+	default:
+		panic(fmt.Errorf("unknown header kind %d", kind))
+	}
+}
+
+// read returns a copy of size bytes of the memory of m at offset.
+func read(m api.Module, offset, size uint32) string {
+	b, ok := m.Memory().Read(offset, size)
+	if !ok {
+		panic(fmt.Errorf("out of range memory access at %d with size %d", offset, size))
+	}
+	return string(b)
+}
+
+// write writes s to the buffer of m at offset if it fits into size bytes.
+// It returns the length of s, so the module can retry with a larger buffer.
+func write(m api.Module, offset, size uint32, s string) int32 {
+	if len(s) <= int(size) && !m.Memory().WriteString(offset, s) {
+		panic(fmt.Errorf("out of range memory access at %d with size %d", offset, size))
+	}
+	return int32(len(s))
+}
+
+// instantiateHost instantiates the host module "ika", whose functions modules import
+// to access the request and response they are called for.
+func instantiateHost(ctx context.Context, r wazero.Runtime, log *slog.Logger, config string) error {
+	b := r.NewHostModuleBuilder("ika")
+	export := func(name string, fn any) {
+		b.NewFunctionBuilder().WithFunc(fn).Export(name)
+	}
+
+	export("log", func(ctx context.Context, m api.Module, level int32, msg, msgLen uint32) {
+		log.Log(ctx, slog.Level(level), read(m, msg, msgLen))
+	})
+	export("get_config", func(_ context.Context, m api.Module, buf, bufLen uint32) int32 {
+		return write(m, buf, bufLen, config)
+	})
+
+	export("get_method", func(ctx context.Context, m api.Module, buf, bufLen uint32) int32 {
+		return write(m, buf, bufLen, exchangeFrom(ctx).r.Method)
+	})
+	export("get_path", func(ctx context.Context, m api.Module, buf, bufLen uint32) int32 {
+		return write(m, buf, bufLen, request.GetPath(exchangeFrom(ctx).r))
+	})
+	export("set_path", func(ctx context.Context, m api.Module, path, pathLen uint32) {
+		r := exchangeFrom(ctx).r
+		newPath := read(m, path, pathLen)
+		unescaped, err := url.PathUnescape(newPath)
+		if err != nil {
+			panic(fmt.Errorf("invalid path %q: %w", newPath, err))
+		}
+		r.URL.RawPath = newPath
+		r.URL.Path = unescaped
+	})
+	export("get_query", func(ctx context.Context, m api.Module, buf, bufLen uint32) int32 {
+		return write(m, buf, bufLen, exchangeFrom(ctx).r.URL.RawQuery)
+	})
+	export("set_query", func(ctx context.Context, m api.Module, query, queryLen uint32) {
+		exchangeFrom(ctx).r.URL.RawQuery = read(m, query, queryLen)
+	})
+	export("get_client_ip", func(ctx context.Context, m api.Module, buf, bufLen uint32) int32 {
+		r := exchangeFrom(ctx).r
+		if ip, ok := request.ClientIP.Get(r); ok {
+			return write(m, buf, bufLen, ip.String())
+		}
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		return write(m, buf, bufLen, host)
+	})
+
+	export("get_header", func(ctx context.Context, m api.Module, kind, name, nameLen, buf, bufLen uint32) int32 {
+		values := exchangeFrom(ctx).headers(kind).Values(read(m, name, nameLen))
+		if len(values) == 0 {
+			return -1
+		}
+		return write(m, buf, bufLen, strings.Join(values, ", "))
+	})
+	export("set_header", func(ctx context.Context, m api.Module, kind, name, nameLen, value, valueLen uint32) {
+		exchangeFrom(ctx).headers(kind).Set(read(m, name, nameLen), read(m, value, valueLen))
+	})
+	export("add_header", func(ctx context.Context, m api.Module, kind, name, nameLen, value, valueLen uint32) {
+		exchangeFrom(ctx).headers(kind).Add(read(m, name, nameLen), read(m, value, valueLen))
+	})
+	export("remove_header", func(ctx context.Context, m api.Module, kind, name, nameLen uint32) {
+		exchangeFrom(ctx).headers(kind).Del(read(m, name, nameLen))
+	})
+
+	export("get_status", func(ctx context.Context) int32 {
+		return int32(exchangeFrom(ctx).status)
+	})
+	export("set_status", func(ctx context.Context, status int32) {
+		ex := exchangeFrom(ctx)
+		if ex.status == 0 {
+			panic(errors.New("the status can only be set in handle_response"))
+		}
+		if status < 200 || status > 599 {
+			panic(fmt.Errorf("invalid status %d", status))
+		}
+		ex.status = int(status)
+	})
+
+	export("reject", func(ctx context.Context, m api.Module, status int32, msg, msgLen uint32) {
+		ex := exchangeFrom(ctx)
+		if ex.status != 0 {
+			panic(errors.New("requests can only be rejected in handle_request"))
+		}
+		if status < 400 || status > 599 {
+			panic(fmt.Errorf("invalid status %d, requests must be rejected with a 4xx or 5xx status", status))
+		}
+
+		message := read(m, msg, msgLen)
+		err := httperr.New(int(status)).WithErr(errors.New("request rejected by module"))
+		if message != "" {
+			err = err.WithDetail(message)
+		}
+		ex.rejected = err
+	})
+
+	_, err := b.Instantiate(ctx)
+	return err
+}
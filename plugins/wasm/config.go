@@ -0,0 +1,64 @@
+package wasm
+
+import (
+	"cmp"
+	"errors"
+	"time"
+)
+
+type pConfig struct {
+	// Path is the path of the WebAssembly module to load.
+	Path string `json:"path"`
+
+	// Config is passed to the module, encoded as JSON.
+	Config map[string]any `json:"config"`
+
+	// MemoryLimit is the largest linear memory in bytes an instance of the module may use,
+	// rounded up to whole WebAssembly pages of 64 KiB.
+	//
+	// Defaults to 64 MiB
+	MemoryLimit int64 `json:"memoryLimit"`
+
+	// Timeout limits how long a single call into the module may take.
+	//
+	// Defaults to 100ms
+	Timeout time.Duration `json:"timeout"`
+
+	// MaxIdleInstances is the number of idle instances of the module kept for later requests.
+	// Every request in flight uses its own instance.
+	//
+	// Defaults to 16
+	MaxIdleInstances int `json:"maxIdleInstances"`
+
+	// MaxInstances is the largest number of instances of the module, idle or in use.
+	// Requests needing an instance beyond it fail with 503 Service Unavailable.
+	//
+	// Defaults to 256
+	MaxInstances int `json:"maxInstances"`
+}
+
+func (c *pConfig) SetDefaults() {
+	c.MemoryLimit = cmp.Or(c.MemoryLimit, 64<<20)
+	c.Timeout = cmp.Or(c.Timeout, 100*time.Millisecond)
+	c.MaxIdleInstances = cmp.Or(c.MaxIdleInstances, 16)
+	c.MaxInstances = cmp.Or(c.MaxInstances, 256)
+}
+
+func (c *pConfig) Validate() error {
+	if c.Path == "" {
+		return errors.New("path is required")
+	}
+	if c.MemoryLimit < 0 || c.MemoryLimit > 4<<30 {
+		return errors.New("memoryLimit must be between 0 and 4 GiB")
+	}
+	if c.Timeout < 0 {
+		return errors.New("timeout must not be negative")
+	}
+	if c.MaxIdleInstances < 0 {
+		return errors.New("maxIdleInstances must not be negative")
+	}
+	if c.MaxInstances < 0 {
+		return errors.New("maxInstances must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,286 @@
+// Package wasm contains a plugin running WebAssembly modules in the ika API Gateway.
+package wasm
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/alx99/ika"
+	"github.com/alx99/ika/jsonschema"
+	"github.com/alx99/ika/pluginutil"
+	"github.com/alx99/ika/pluginutil/httperr"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// pageSize is the size of a WebAssembly memory page.
+const pageSize = 64 << 10
+
+type plugin struct {
+	cfg pConfig
+	log *slog.Logger
+	// cache holds the compiled modules of all plugins created by the factory,
+	// so a module is not compiled again when the configuration is reloaded
+	cache wazero.CompilationCache
+
+	runtime  wazero.Runtime
+	module   wazero.CompiledModule
+	exported map[string]bool
+	// idle holds instances of the module not used by any request
+	idle chan api.Module
+	// instances holds a token for every instance of the module, limiting their number
+	instances chan struct{}
+}
+
+func Factory() ika.PluginFactory {
+	return &plugin{cache: wazero.NewCompilationCache()}
+}
+
+func (*plugin) Name() string {
+	return "wasm"
+}
+
+func (*plugin) ConfigSchema() map[string]any {
+	return jsonschema.Reflect(pConfig{}).Map()
+}
+
+func (f *plugin) New(ctx context.Context, ictx ika.InjectionContext, config map[string]any) (ika.Plugin, error) {
+	p := &plugin{
+		log:   ictx.Logger,
+		cache: f.cache,
+	}
+
+	if err := pluginutil.UnmarshalCfg(config, &p.cfg); err != nil {
+		return nil, err
+	}
+
+	if err := p.load(ctx); err != nil {
+		if p.runtime != nil {
+			err = errors.Join(err, p.runtime.Close(ctx))
+		}
+		return nil, err
+	}
+	return p, nil
+}
+
+// load compiles the module and creates its first instance,
+// so modules which cannot be instantiated are rejected early.
+func (p *plugin) load(ctx context.Context) error {
+	bin, err := os.ReadFile(p.cfg.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read module: %w", err)
+	}
+	guestCfg, err := json.Marshal(p.cfg.Config)
+	if err != nil {
+		return fmt.Errorf("failed to encode module config: %w", err)
+	}
+
+	p.runtime = wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithCompilationCache(p.cache).
+		WithMemoryLimitPages(uint32((p.cfg.MemoryLimit+pageSize-1)/pageSize)).
+		WithCloseOnContextDone(true))
+
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, p.runtime); err != nil {
+		return fmt.Errorf("failed to instantiate WASI: %w", err)
+	}
+	if err := instantiateHost(ctx, p.runtime, p.log, string(guestCfg)); err != nil {
+		return fmt.Errorf("failed to instantiate host module: %w", err)
+	}
+
+	p.module, err = p.runtime.CompileModule(ctx, bin)
+	if err != nil {
+		return fmt.Errorf("failed to compile module: %w", err)
+	}
+
+	p.exported = make(map[string]bool)
+	for _, name := range []string{handleRequest, handleResponse} {
+		fn, ok := p.module.ExportedFunctions()[name]
+		if !ok {
+			continue
+		}
+		if len(fn.ParamTypes()) > 0 || len(fn.ResultTypes()) > 0 {
+			return fmt.Errorf("exported function %s must not have parameters or results", name)
+		}
+		p.exported[name] = true
+	}
+	if len(p.exported) == 0 {
+		return fmt.Errorf("module exports neither %s nor %s", handleRequest, handleResponse)
+	}
+
+	p.idle = make(chan api.Module, p.cfg.MaxIdleInstances)
+	p.instances = make(chan struct{}, p.cfg.MaxInstances)
+	m, err := p.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	p.release(ctx, m)
+	return nil
+}
+
+// instantiate creates a new instance of the module, initializing it if it is a WASI reactor.
+func (p *plugin) instantiate(ctx context.Context) (api.Module, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.Timeout)
+	defer cancel()
+
+	m, err := p.runtime.InstantiateModule(ctx, p.module, wazero.NewModuleConfig().
+		WithName(""). // instances are anonymous, so the module can be instantiated more than once
+		WithStartFunctions("_initialize").
+		WithSysWalltime().
+		WithSysNanotime().
+		WithRandSource(rand.Reader))
+	if err != nil {
+		return nil, fmt.Errorf("failed to instantiate module: %w", err)
+	}
+	return m, nil
+}
+
+// acquire returns an idle instance of the module, or a new one if there is none.
+// It fails with 503 Service Unavailable if the module has MaxInstances instances already.
+func (p *plugin) acquire(ctx context.Context) (api.Module, error) {
+	select {
+	case m := <-p.idle:
+		return m, nil
+	default:
+	}
+
+	select {
+	case p.instances <- struct{}{}:
+	default:
+		return nil, httperr.New(http.StatusServiceUnavailable).
+			WithErr(fmt.Errorf("module %s has %d instances in use", p.cfg.Path, p.cfg.MaxInstances)).
+			WithTitle("Too many concurrent requests")
+	}
+	m, err := p.instantiate(ctx)
+	if err != nil {
+		<-p.instances
+		return nil, err
+	}
+	return m, nil
+}
+
+// release makes m available to other requests, unless it was closed after a failed call.
+func (p *plugin) release(ctx context.Context, m api.Module) {
+	if !m.IsClosed() {
+		select {
+		case p.idle <- m:
+			return
+		default:
+			_ = m.Close(ctx)
+		}
+	}
+	<-p.instances
+}
+
+// call calls the function name of m for ex, if the module exports it.
+// m is closed if the call fails, as its state is unknown afterwards.
+func (p *plugin) call(m api.Module, name string, ex *exchange) error {
+	if !p.exported[name] {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ex.r.Context(), p.cfg.Timeout)
+	defer cancel()
+
+	if _, err := m.ExportedFunction(name).Call(withExchange(ctx, ex)); err != nil {
+		_ = m.Close(context.WithoutCancel(ctx))
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("module %s timed out after %s in %s", p.cfg.Path, p.cfg.Timeout, name)
+		}
+		return fmt.Errorf("module %s failed in %s: %w", p.cfg.Path, name, err)
+	}
+	return nil
+}
+
+// ModifyRequest calls handle_request of the module, handle_response is not called for request modifiers.
+func (p *plugin) ModifyRequest(r *http.Request) error {
+	m, err := p.acquire(r.Context())
+	if err != nil {
+		return err
+	}
+	defer p.release(r.Context(), m)
+
+	// response headers set by the module are discarded, as there is no response yet
+	ex := &exchange{r: r, header: make(http.Header)}
+	if err := p.call(m, handleRequest, ex); err != nil {
+		return err
+	}
+	return ex.rejected
+}
+
+func (p *plugin) Handler(next ika.Handler) ika.Handler {
+	return ika.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		m, err := p.acquire(r.Context())
+		if err != nil {
+			return err
+		}
+		// the instance handles the response of the request as well
+		defer p.release(r.Context(), m)
+
+		ex := &exchange{r: r, header: w.Header()}
+		if err := p.call(m, handleRequest, ex); err != nil {
+			return err
+		}
+		if ex.rejected != nil {
+			return ex.rejected
+		}
+
+		if !p.exported[handleResponse] {
+			return next.ServeHTTP(w, r)
+		}
+		return next.ServeHTTP(&responseWriter{ResponseWriter: w, onHeader: func(code int) int {
+			ex.status = code
+			if err := p.call(m, handleResponse, ex); err != nil {
+				// the response cannot be replaced by an error anymore, so it is passed on unmodified
+				p.log.LogAttrs(r.Context(), slog.LevelError, "Failed to handle response", slog.String("error", err.Error()))
+				return code
+			}
+			return ex.status
+		}}, r)
+	})
+}
+
+func (p *plugin) Teardown(ctx context.Context) error {
+	return p.runtime.Close(ctx)
+}
+
+// responseWriter calls onHeader before the header of the final response is written.
+// onHeader may modify the header and returns the status code to write.
+type responseWriter struct {
+	http.ResponseWriter
+	onHeader    func(code int) int
+	wroteHeader bool
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	// informational responses may precede the final one
+	if code >= http.StatusOK && !w.wroteHeader {
+		w.wroteHeader = true
+		code = w.onHeader(code)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
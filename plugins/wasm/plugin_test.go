@@ -0,0 +1,265 @@
+package wasm
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alx99/ika"
+	"github.com/alx99/ika/pluginutil/httperr"
+	"github.com/matryer/is"
+)
+
+// guest is the path of the module built from testdata/guest.
+var guest string
+
+// factory is shared by the tests, so the module is compiled once.
+var factory = Factory()
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "ika-wasm")
+	if err != nil {
+		panic(err)
+	}
+
+	guest = filepath.Join(dir, "guest.wasm")
+	cmd := exec.Command("go", "build", "-buildmode=c-shared", "-o", guest, "./testdata/guest")
+	cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		_ = os.RemoveAll(dir)
+		panic(fmt.Sprintf("failed to build guest: %v\n%s", err, out))
+	}
+
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func newPlugin(t *testing.T, config map[string]any) *plugin {
+	t.Helper()
+
+	config["path"] = guest
+	p, err := factory.New(t.Context(), ika.InjectionContext{Logger: slog.New(slog.DiscardHandler)}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = p.Teardown(t.Context()) })
+	return p.(*plugin)
+}
+
+func TestPlugin_Setup(t *testing.T) {
+	t.Parallel()
+
+	empty := filepath.Join(t.TempDir(), "empty.wasm")
+	if err := os.WriteFile(empty, []byte("\x00asm\x01\x00\x00\x00"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		config    map[string]any
+		wantError bool
+	}{
+		{name: "valid config", config: map[string]any{"path": guest, "config": map[string]any{"header": "value"}, "timeout": "1s"}},
+		{name: "missing path", config: map[string]any{}, wantError: true},
+		{name: "missing module", config: map[string]any{"path": filepath.Join(t.TempDir(), "missing.wasm")}, wantError: true},
+		{name: "module without handlers", config: map[string]any{"path": empty}, wantError: true},
+		{name: "memory limit below module minimum", config: map[string]any{"path": guest, "memoryLimit": 1 << 16}, wantError: true},
+		{name: "negative timeout", config: map[string]any{"path": guest, "timeout": "-1s"}, wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			is := is.New(t)
+
+			p, err := factory.New(t.Context(), ika.InjectionContext{Logger: slog.New(slog.DiscardHandler)}, tt.config)
+			if tt.wantError {
+				is.True(err != nil) // expected an error
+			} else {
+				is.NoErr(err)
+				is.NoErr(p.Teardown(t.Context()))
+			}
+		})
+	}
+}
+
+func TestPlugin_Handler(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		target         string
+		header         http.Header
+		upstreamStatus int
+		wantStatus     int
+		wantUpstream   bool
+		wantRequest    http.Header // headers received by the upstream
+		wantURI        string
+		wantResponse   http.Header
+	}{
+		{
+			name:         "request and response are modified",
+			target:       "/old/path?a=1",
+			wantStatus:   http.StatusOK,
+			wantUpstream: true,
+			wantRequest:  http.Header{"X-Wasm-Config": {"value"}, "X-Wasm-Client-Ip": {"192.0.2.1"}},
+			wantURI:      "/new/path?a=1&wasm=1",
+			wantResponse: http.Header{"X-Wasm-Method": {"GET"}, "X-Wasm-Status": {"200"}, "X-Internal": nil},
+		},
+		{
+			name:           "status is replaced",
+			target:         "/missing",
+			upstreamStatus: http.StatusNotFound,
+			wantStatus:     http.StatusGone,
+			wantUpstream:   true,
+			wantURI:        "/missing",
+			wantResponse:   http.Header{"X-Wasm-Status": {"404"}},
+		},
+		{
+			name:       "request is rejected",
+			target:     "/",
+			header:     http.Header{"X-Reject": {"true"}},
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			is := is.New(t)
+
+			p := newPlugin(t, map[string]any{"config": map[string]any{"header": "value"}})
+
+			var upstream *http.Request
+			h := p.Handler(ika.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+				upstream = r
+				w.Header().Set("X-Internal", "secret")
+				if tt.upstreamStatus != 0 {
+					w.WriteHeader(tt.upstreamStatus)
+				}
+				_, err := w.Write([]byte("ok"))
+				return err
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+			for name, values := range tt.header {
+				req.Header[name] = values
+			}
+			rec := httptest.NewRecorder()
+			ika.ToHTTPHandler(h, nil).ServeHTTP(rec, req)
+
+			is.Equal(rec.Code, tt.wantStatus)
+			is.Equal(upstream != nil, tt.wantUpstream) // whether the request reached the upstream
+			if !tt.wantUpstream {
+				return
+			}
+			for name, values := range tt.wantRequest {
+				is.Equal(upstream.Header.Values(name), values)
+			}
+			is.Equal(upstream.URL.RequestURI(), tt.wantURI)
+			for name, values := range tt.wantResponse {
+				is.Equal(rec.Header().Values(name), values)
+			}
+		})
+	}
+}
+
+func TestPlugin_ModifyRequest(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	p := newPlugin(t, map[string]any{"config": map[string]any{"header": "value"}})
+
+	req := httptest.NewRequest(http.MethodGet, "/old/path", nil)
+	is.NoErr(p.ModifyRequest(req))
+	is.Equal(req.Header.Get("X-Wasm-Config"), "value")
+	is.Equal(req.URL.Path, "/new/path")
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Reject", "true")
+	var httpErr *httperr.Error
+	is.True(errors.As(p.ModifyRequest(req), &httpErr))
+	is.Equal(httpErr.Status(), http.StatusForbidden)
+	is.Equal(httpErr.Detail(), "rejected by guest")
+}
+
+func TestPlugin_instances(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	p := newPlugin(t, map[string]any{"config": map[string]any{}})
+
+	for i := range 3 {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		is.NoErr(p.ModifyRequest(req))
+		is.Equal(req.Header.Get("X-Wasm-Handled"), fmt.Sprint(i+1)) // the idle instance is reused
+	}
+}
+
+func TestPlugin_maxInstances(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	p := newPlugin(t, map[string]any{"config": map[string]any{}, "maxInstances": 2})
+
+	// both instances are in use by requests in flight
+	a, err := p.acquire(t.Context())
+	is.NoErr(err)
+	b, err := p.acquire(t.Context())
+	is.NoErr(err)
+
+	var httpErr *httperr.Error
+	is.True(errors.As(p.ModifyRequest(httptest.NewRequest(http.MethodGet, "/", nil)), &httpErr))
+	is.Equal(httpErr.Status(), http.StatusServiceUnavailable) // no instance is left
+
+	p.release(t.Context(), a)
+	_ = b.Close(t.Context()) // a failed call closes its instance
+	p.release(t.Context(), b)
+	is.NoErr(p.ModifyRequest(httptest.NewRequest(http.MethodGet, "/", nil)))
+	is.NoErr(p.ModifyRequest(httptest.NewRequest(http.MethodGet, "/", nil)))
+}
+
+func TestPlugin_limits(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		mode   string
+		config map[string]any
+	}{
+		{name: "timeout", mode: "loop", config: map[string]any{"timeout": "50ms"}},
+		{name: "memory limit", mode: "alloc", config: map[string]any{"memoryLimit": 64 << 20}},
+		{name: "trap", mode: "trap"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			is := is.New(t)
+
+			config := tt.config
+			if config == nil {
+				config = map[string]any{}
+			}
+			config["config"] = map[string]any{"mode": tt.mode}
+			p := newPlugin(t, config)
+
+			start := time.Now()
+			is.True(p.ModifyRequest(httptest.NewRequest(http.MethodGet, "/", nil)) != nil) // the call fails
+			is.True(time.Since(start) < 5*time.Second)
+			is.Equal(len(p.idle), 0) // the failed instance is not reused
+
+			// later requests get a new instance
+			is.True(p.ModifyRequest(httptest.NewRequest(http.MethodGet, "/", nil)) != nil)
+		})
+	}
+}
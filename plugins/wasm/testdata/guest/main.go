@@ -0,0 +1,160 @@
+//go:build wasip1
+
+// Command guest is the module used by the tests of the wasm plugin.
+// It is built by the tests with GOOS=wasip1 GOARCH=wasm -buildmode=c-shared.
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+//go:wasmimport ika log
+func hostLog(level int32, msg unsafe.Pointer, msgLen uint32)
+
+//go:wasmimport ika get_config
+func getConfig(buf unsafe.Pointer, bufLen uint32) int32
+
+//go:wasmimport ika get_method
+func getMethod(buf unsafe.Pointer, bufLen uint32) int32
+
+//go:wasmimport ika get_path
+func getPath(buf unsafe.Pointer, bufLen uint32) int32
+
+//go:wasmimport ika set_path
+func setPath(path unsafe.Pointer, pathLen uint32)
+
+//go:wasmimport ika get_query
+func getQuery(buf unsafe.Pointer, bufLen uint32) int32
+
+//go:wasmimport ika set_query
+func setQuery(query unsafe.Pointer, queryLen uint32)
+
+//go:wasmimport ika get_client_ip
+func getClientIP(buf unsafe.Pointer, bufLen uint32) int32
+
+//go:wasmimport ika get_header
+func getHeader(kind uint32, name unsafe.Pointer, nameLen uint32, buf unsafe.Pointer, bufLen uint32) int32
+
+//go:wasmimport ika set_header
+func setHeader(kind uint32, name unsafe.Pointer, nameLen uint32, value unsafe.Pointer, valueLen uint32)
+
+//go:wasmimport ika remove_header
+func removeHeader(kind uint32, name unsafe.Pointer, nameLen uint32)
+
+//go:wasmimport ika get_status
+func getStatus() int32
+
+//go:wasmimport ika set_status
+func setStatus(status int32)
+
+//go:wasmimport ika reject
+func reject(status int32, msg unsafe.Pointer, msgLen uint32)
+
+const (
+	kindRequest uint32 = iota
+	kindResponse
+)
+
+var config struct {
+	Header string `json:"header"`
+	Mode   string `json:"mode"`
+}
+
+// handled is the number of requests handled by this instance.
+var handled int
+
+func ptr(s string) (unsafe.Pointer, uint32) {
+	return unsafe.Pointer(unsafe.StringData(s)), uint32(len(s))
+}
+
+// get calls fn with a buffer large enough for the value it returns.
+func get(fn func(buf unsafe.Pointer, bufLen uint32) int32) (string, bool) {
+	buf := make([]byte, 64)
+	for {
+		n := fn(unsafe.Pointer(unsafe.SliceData(buf)), uint32(len(buf)))
+		if n < 0 {
+			return "", false
+		}
+		if int(n) <= len(buf) {
+			return string(buf[:n]), true
+		}
+		buf = make([]byte, n)
+	}
+}
+
+func header(kind uint32, name string) (string, bool) {
+	return get(func(buf unsafe.Pointer, bufLen uint32) int32 {
+		p, n := ptr(name)
+		return getHeader(kind, p, n, buf, bufLen)
+	})
+}
+
+func set(kind uint32, name, value string) {
+	np, nn := ptr(name)
+	vp, vn := ptr(value)
+	setHeader(kind, np, nn, vp, vn)
+}
+
+func init() {
+	cfg, _ := get(getConfig)
+	if err := json.Unmarshal([]byte(cfg), &config); err != nil {
+		panic(err)
+	}
+}
+
+//go:wasmexport handle_request
+func handleRequest() {
+	msg := "handling request"
+	p, n := ptr(msg)
+	hostLog(0, p, n)
+
+	switch config.Mode {
+	case "loop":
+		for {
+		}
+	case "alloc":
+		buf := make([]byte, 128<<20)
+		buf[len(buf)-1] = 1
+	case "trap":
+		panic("trap")
+	}
+
+	if _, ok := header(kindRequest, "X-Reject"); ok {
+		p, n := ptr("rejected by guest")
+		reject(403, p, n)
+		return
+	}
+
+	handled++
+	method, _ := get(getMethod)
+	clientIP, _ := get(getClientIP)
+	set(kindRequest, "X-Wasm-Config", config.Header)
+	set(kindRequest, "X-Wasm-Handled", strconv.Itoa(handled))
+	set(kindRequest, "X-Wasm-Client-Ip", clientIP)
+	set(kindResponse, "X-Wasm-Method", method)
+
+	if path, _ := get(getPath); strings.HasPrefix(path, "/old/") {
+		p, n := ptr("/new/" + strings.TrimPrefix(path, "/old/"))
+		setPath(p, n)
+	}
+	if query, _ := get(getQuery); query != "" {
+		p, n := ptr(query + "&wasm=1")
+		setQuery(p, n)
+	}
+}
+
+//go:wasmexport handle_response
+func handleResponse() {
+	status := getStatus()
+	set(kindResponse, "X-Wasm-Status", strconv.Itoa(int(status)))
+	p, n := ptr("X-Internal")
+	removeHeader(kindResponse, p, n)
+	if status == 404 {
+		setStatus(410)
+	}
+}
+
+func main() {}
@@ -0,0 +1,135 @@
+package request
+
+import (
+	"context"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+)
+
+// attributes holds the typed attributes plugins use to share what they know about a request
+// with the plugins running before or after them, such as the principal authenticated by basic-auth
+// or the ID assigned by request-id, see [Key].
+//
+// The attributes of a request are stored in its context. Ika attaches them to every request
+// before any plugin runs, so a plugin reading attributes after calling the next handler sees
+// the ones set by the plugins after it, even if they pass on copies of the request.
+// They may be read and written concurrently, for example while mirroring a request.
+type attributes struct {
+	mu     sync.RWMutex
+	values map[any]any
+}
+
+type keyAttributes struct{}
+
+// WithAttributes returns a shallow copy of r that attributes can be set on, or r if it has attributes already.
+// Ika attaches attributes to every request before any plugin runs, so plugins only need it in tests.
+func WithAttributes(r *http.Request) *http.Request {
+	if attributesFrom(r) != nil {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), keyAttributes{}, &attributes{values: make(map[any]any)}))
+}
+
+func attributesFrom(r *http.Request) *attributes {
+	a, _ := r.Context().Value(keyAttributes{}).(*attributes)
+	return a
+}
+
+// Key is the key of an attribute holding values of type T.
+// Keys are compared by identity, so two keys with the same name are different attributes.
+type Key[T any] struct {
+	name string
+	// fallback returns the value of the attribute if it is not set, if it is not nil
+	fallback func(r *http.Request) (T, bool)
+}
+
+// NewKey returns a new key for an attribute named name.
+// The name describes the attribute, for example in logs.
+func NewKey[T any](name string) *Key[T] {
+	return &Key[T]{name: name}
+}
+
+// String returns the name of the attribute.
+func (k *Key[T]) String() string {
+	return k.name
+}
+
+// Set sets the attribute of r to v.
+// It does nothing if r has no attributes attached, see [WithAttributes].
+func (k *Key[T]) Set(r *http.Request, v T) {
+	a := attributesFrom(r)
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.values[k] = v
+}
+
+// Get returns the attribute of r and whether it is set.
+func (k *Key[T]) Get(r *http.Request) (T, bool) {
+	if a := attributesFrom(r); a != nil {
+		a.mu.RLock()
+		v, ok := a.values[k]
+		a.mu.RUnlock()
+		if ok {
+			return v.(T), true
+		}
+	}
+	if k.fallback != nil {
+		return k.fallback(r)
+	}
+	var zero T
+	return zero, false
+}
+
+// Attributes set by the built-in plugins.
+var (
+	// Principal is the name of the identity the request is authenticated as,
+	// such as the name of the credential matched by basic-auth.
+	Principal = NewKey[string]("principal")
+
+	// RequestID is the ID of the request, as assigned by request-id.
+	RequestID = NewKey[string]("requestID")
+
+	// ClientIP is the address of the client. Unless a plugin sets it, it is the address
+	// of the remote address of the request, which is the address sent by the trusted proxy
+	// if the server accepts the PROXY protocol.
+	// Plugins may only replace it with addresses from trusted sources.
+	ClientIP = &Key[netip.Addr]{name: "clientIP", fallback: remoteIP}
+)
+
+// remoteIP returns the address of the remote address of r.
+func remoteIP(r *http.Request) (netip.Addr, bool) {
+	addr, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Addr().Unmap(), true
+}
+
+// RouteParams returns the values of the wildcards of the route pattern matched by r,
+// such as {"id": "42"} for the pattern /users/{id} and the path /users/42.
+func RouteParams(r *http.Request) map[string]string {
+	var params map[string]string
+	pattern := r.Pattern
+	for {
+		start := strings.IndexByte(pattern, '{')
+		end := strings.IndexByte(pattern, '}')
+		if start < 0 || end < start {
+			return params
+		}
+		name := strings.TrimSuffix(pattern[start+1:end], "...")
+		pattern = pattern[end+1:]
+		if name == "" || name == "$" {
+			continue
+		}
+
+		if params == nil {
+			params = make(map[string]string)
+		}
+		params[name] = r.PathValue(name)
+	}
+}
@@ -0,0 +1,110 @@
+package request
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestKey(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	r := WithAttributes(httptest.NewRequest(http.MethodGet, "/", nil))
+	_, ok := Principal.Get(r)
+	is.True(!ok) // nothing is set yet
+	ip, ok := ClientIP.Get(r)
+	is.True(ok)
+	is.Equal(ip, netip.MustParseAddr("192.0.2.1")) // client IP defaults to the remote address
+
+	Principal.Set(r, "alice")
+	ClientIP.Set(r, netip.MustParseAddr("198.51.100.1"))
+
+	principal, ok := Principal.Get(r)
+	is.True(ok)
+	is.Equal(principal, "alice")
+	ip, _ = ClientIP.Get(r)
+	is.Equal(ip, netip.MustParseAddr("198.51.100.1"))
+
+	other := NewKey[string]("principal")
+	_, ok = other.Get(r)
+	is.True(!ok) // keys with the same name are different attributes
+	is.Equal(other.String(), "principal")
+}
+
+func TestKey_Set(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		attached bool
+		copied   bool
+		want     bool
+	}{
+		{name: "same request", attached: true, want: true},
+		{name: "copied request", attached: true, copied: true, want: true},
+		{name: "request without attributes", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			is := is.New(t)
+
+			// next stands for the plugins a plugin passes the request on to
+			next := func(r *http.Request) {
+				if tt.copied {
+					r = r.WithContext(r.Context())
+				}
+				RequestID.Set(r, "id")
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.attached {
+				r = WithAttributes(r)
+				is.Equal(WithAttributes(r), r) // attributes are attached once
+			}
+			next(r)
+
+			id, ok := RequestID.Get(r)
+			is.Equal(ok, tt.want)
+			if tt.want {
+				is.Equal(id, "id")
+			}
+		})
+	}
+}
+
+func TestRouteParams(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		pattern string
+		path    string
+		want    map[string]string
+	}{
+		{name: "no wildcards", pattern: "GET /users", path: "/users"},
+		{name: "wildcard", pattern: "GET /users/{id}", path: "/users/42", want: map[string]string{"id": "42"}},
+		{name: "rest", pattern: "/files/{dir}/{path...}", path: "/files/a/b/c", want: map[string]string{"dir": "a", "path": "b/c"}},
+		{name: "end", pattern: "/{$}", path: "/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			is := is.New(t)
+
+			var got map[string]string
+			mux := http.NewServeMux()
+			mux.HandleFunc(tt.pattern, func(_ http.ResponseWriter, r *http.Request) {
+				got = RouteParams(r)
+			})
+			mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+			is.Equal(got, tt.want)
+		})
+	}
+}
@@ -0,0 +1,15 @@
+// Package request provides helpers for the requests handled by Ika, which plugins use as well.
+package request
+
+import (
+	"net/http"
+)
+
+// GetPath returns the escaped path of r if it has one, or its path otherwise.
+func GetPath(r *http.Request) string {
+	path := r.URL.RawPath
+	if path == "" {
+		path = r.URL.Path
+	}
+	return path
+}
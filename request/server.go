@@ -0,0 +1,17 @@
+package request
+
+import "context"
+
+type keyServer struct{}
+
+// WithServer returns a copy of ctx for a request received by the server with the given name.
+func WithServer(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, keyServer{}, name)
+}
+
+// Server returns the name of the server the request ctx belongs to was received by,
+// or an empty string if it is unknown.
+func Server(ctx context.Context) string {
+	name, _ := ctx.Value(keyServer{}).(string)
+	return name
+}
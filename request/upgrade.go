@@ -0,0 +1,38 @@
+package request
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// UpgradeStats describes the traffic of a connection upgraded to another protocol, such as WebSockets.
+// The counters are updated while the connection is open.
+type UpgradeStats struct {
+	// Protocol is the protocol the request asked to upgrade to, in lower case.
+	Protocol string
+
+	// Upgraded is set once the connection has been hijacked.
+	Upgraded atomic.Bool
+	// BytesIn and BytesOut count the bytes read from and written to the client.
+	// BytesOut includes the 101 response.
+	BytesIn  atomic.Int64
+	BytesOut atomic.Int64
+	// MessagesIn and MessagesOut count the WebSocket messages read from and written to the client.
+	// Fragmented messages are counted once and control frames are not counted.
+	MessagesIn  atomic.Int64
+	MessagesOut atomic.Int64
+}
+
+type keyUpgradeStats struct{}
+
+// WithUpgradeStats returns a copy of ctx for an upgrade request whose traffic is counted by s.
+func WithUpgradeStats(ctx context.Context, s *UpgradeStats) context.Context {
+	return context.WithValue(ctx, keyUpgradeStats{}, s)
+}
+
+// UpgradeStatsFrom returns the stats of the upgrade request ctx belongs to,
+// or nil if it does not belong to one.
+func UpgradeStatsFrom(ctx context.Context) *UpgradeStats {
+	s, _ := ctx.Value(keyUpgradeStats{}).(*UpgradeStats)
+	return s
+}